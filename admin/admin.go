@@ -0,0 +1,206 @@
+// Package admin provides the admin server of the services, which serves
+// profiles, the build and the effective configuration of a service. It is
+// bound to localhost unless remote access is allowed explicitly.
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/heetch/FabianG-technical-test/httpserver"
+	"github.com/rs/zerolog"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Config configures the admin server of a service.
+type Config struct {
+	Service string
+	Version string // version of the build, set by ldflags
+	// Config is the effective configuration of the service served at
+	// /config; it must not contain secrets, see Flags.
+	Config interface{}
+	TLS    *tls.Config // serves TLS if not nil
+	// AllowRemote allows addresses which are not bound to localhost; the
+	// endpoints are not authenticated, so access must be restricted
+	// otherwise, e.g. by the network
+	AllowRemote bool
+}
+
+// Server serves the admin endpoints of a service:
+//
+//	/debug/pprof/ profiles of net/http/pprof
+//	/buildinfo    the version and the Go modules of the build
+//	/config       the effective configuration
+type Server struct {
+	mux    *http.ServeMux
+	srv    *http.Server
+	logger zerolog.Logger
+}
+
+// New returns a Server listening on addr. Addresses which are not bound to
+// localhost are rejected unless cfg allows remote access.
+func New(addr string, cfg Config, logger zerolog.Logger) (*Server, error) {
+	if !isLoopback(addr) {
+		if !cfg.AllowRemote {
+			return nil, fmt.Errorf("admin address %s is not bound to localhost; remote access must be allowed explicitly", addr)
+		}
+		logger.Warn().Msgf("admin server listening on %s is not bound to localhost", addr)
+	}
+	s := &Server{
+		mux:    http.NewServeMux(),
+		logger: logger,
+	}
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	s.mux.Handle("/buildinfo", jsonHandler(NewBuildInfo(cfg.Service, cfg.Version)))
+	s.mux.Handle("/config", jsonHandler(cfg.Config))
+	// profiles are written for the duration requested by clients, so
+	// responses are not limited
+	srvCfg := httpserver.DefaultConfig
+	srvCfg.WriteTimeout = 0
+	srvCfg.RequestTimeout = 0
+	srvCfg.TLS = cfg.TLS
+	s.srv = httpserver.New(addr, s.mux, srvCfg)
+	return s, nil
+}
+
+// Handle registers h for pattern in addition to the admin endpoints; it must
+// be called before Run.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+// Run serves the admin endpoints until s is shut down.
+func (s *Server) Run() error {
+	s.logger.Info().Msgf("admin server listening on %s", s.srv.Addr)
+	if err := httpserver.ListenAndServe(s.srv); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Shutdown(ctx context.Context) {
+	s.logger.Info().Msg("shutting admin server down")
+	if err := s.srv.Shutdown(ctx); err != nil {
+		s.logger.Error().Err(err).Msg("admin server shutdown error")
+		// profiles do not finish before their duration
+		s.srv.Close()
+	}
+}
+
+// isLoopback reports whether addr is bound to a loopback address only.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// jsonHandler responds with v encoded as JSON.
+func jsonHandler(v interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+	})
+}
+
+// Module is a Go module of a build.
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+}
+
+// BuildInfo is the build of a service.
+type BuildInfo struct {
+	Service   string   `json:"service"`
+	Version   string   `json:"version"`
+	GoVersion string   `json:"go_version"`
+	Path      string   `json:"path,omitempty"` // package path of main
+	Main      *Module  `json:"main,omitempty"`
+	Deps      []Module `json:"deps,omitempty"`
+}
+
+// NewBuildInfo returns the build of the running binary of service at
+// version. Modules are missing if the binary is not built in module mode.
+func NewBuildInfo(service, version string) BuildInfo {
+	bi := BuildInfo{
+		Service:   service,
+		Version:   version,
+		GoVersion: runtime.Version(),
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return bi
+	}
+	bi.Path = info.Path
+	bi.Main = &Module{Path: info.Main.Path, Version: info.Main.Version, Sum: info.Main.Sum}
+	for _, d := range info.Deps {
+		if d.Replace != nil {
+			d = d.Replace
+		}
+		bi.Deps = append(bi.Deps, Module{Path: d.Path, Version: d.Version, Sum: d.Sum})
+	}
+	return bi
+}
+
+// redacted replaces secrets of the configuration.
+const redacted = "REDACTED"
+
+// secretNames are the parts of the names of flags whose values are secrets.
+// They are broad, so that secret flags added later are redacted as well.
+var secretNames = []string{"secret", "password", "token", "credential", "key", "dsn", "auth"}
+
+// Flags returns the effective values of the flags of app by name. Values of
+// flags named like secrets are redacted, except of boolean flags, as well as
+// passwords of URLs. Hidden flags and the help and version flags are omitted.
+func Flags(app *kingpin.Application) map[string]string {
+	flags := make(map[string]string)
+	for _, f := range app.Model().Flags {
+		if f.Hidden || f.Name == "help" || f.Name == "version" {
+			continue
+		}
+		if f.IsBoolFlag() {
+			flags[f.Name] = f.String()
+			continue
+		}
+		flags[f.Name] = redact(f.Name, f.String())
+	}
+	return flags
+}
+
+// redact returns the value of the flag name without secrets.
+func redact(name, value string) string {
+	for _, s := range secretNames {
+		if strings.Contains(name, s) && value != "" {
+			return redacted
+		}
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
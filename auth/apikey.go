@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+)
+
+// APIKeyHeader is the request header carrying an API key.
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is a static API key identified by ID. Claims are the claims of its
+// principal.
+type APIKey struct {
+	ID     string
+	Key    string
+	Claims map[string]interface{}
+}
+
+type apiKey struct {
+	APIKey
+	digest [sha256.Size]byte
+}
+
+// APIKeys authenticates requests by the API key of the APIKeyHeader.
+type APIKeys struct {
+	keys []apiKey
+}
+
+// NewAPIKeys returns an APIKeys accepting keys. Empty keys are ignored.
+func NewAPIKeys(keys ...APIKey) *APIKeys {
+	a := &APIKeys{}
+	for _, k := range keys {
+		if k.Key == "" {
+			continue
+		}
+		a.keys = append(a.keys, apiKey{APIKey: k, digest: sha256.Sum256([]byte(k.Key))})
+	}
+	return a
+}
+
+func (a *APIKeys) Method() string {
+	return MethodAPIKey
+}
+
+func (a *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	// compare digests of equal length in constant time and compare all keys,
+	// so that timing reveals neither the keys nor their lengths
+	digest := sha256.Sum256([]byte(key))
+	var match *apiKey
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(digest[:], a.keys[i].digest[:]) == 1 {
+			match = &a.keys[i]
+		}
+	}
+	if match == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{
+		Method:  MethodAPIKey,
+		Subject: match.ID,
+		Claims:  match.Claims,
+	}, nil
+}
@@ -0,0 +1,124 @@
+// Package auth authenticates HTTP requests by static API keys, HMAC signed
+// requests or JSON Web Tokens (JWT) and authorizes principals by rules on
+// their claims.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// authentication methods
+const (
+	MethodAPIKey = "api_key"
+	MethodHMAC   = "hmac"
+	MethodJWT    = "jwt"
+)
+
+// errors of authentication and authorization. Their messages are safe to be
+// returned to clients.
+var (
+	// ErrNoCredentials is returned by an Authenticator if the request does not
+	// carry credentials of its method.
+	ErrNoCredentials = errors.New("missing credentials")
+	// ErrInvalidCredentials is returned for credentials which are malformed,
+	// unknown, expired or fail verification.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrForbidden is returned by Rule.Check if a principal is not authorized.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Principal is an authenticated client.
+type Principal struct {
+	Method  string                 // authentication method
+	Subject string                 // key ID or the subject of a token
+	Claims  map[string]interface{} // claims of a token or of a key
+}
+
+// Authenticator authenticates requests by a single method.
+type Authenticator interface {
+	Method() string
+	// Authenticate returns the principal of r. It returns ErrNoCredentials if
+	// r carries no credentials of the method and ErrInvalidCredentials, which
+	// may be wrapped, if they are not valid.
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+type anyAuthenticator []Authenticator
+
+// Any returns an Authenticator which authenticates requests by the first of
+// auths whose credentials are present.
+func Any(auths ...Authenticator) Authenticator {
+	return anyAuthenticator(auths)
+}
+
+func (a anyAuthenticator) Method() string {
+	return "any"
+}
+
+func (a anyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	for _, auth := range a {
+		p, err := auth.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// Rule requires the value of the path variable Var of a request to equal the
+// claim Claim of its principal, e.g. that drivers update their own location.
+type Rule struct {
+	Var   string `yaml:"var"`
+	Claim string `yaml:"claim"`
+}
+
+// Check returns ErrForbidden if p may not access a resource identified by the
+// path variables vars.
+func (rule Rule) Check(p *Principal, vars map[string]string) error {
+	v, ok := vars[rule.Var]
+	if !ok {
+		// the route does not define the variable; a configuration error
+		return fmt.Errorf("%w: path variable %s not found", ErrForbidden, rule.Var)
+	}
+	if p == nil || claimString(p.Claims[rule.Claim]) != v || v == "" {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// claimString returns the string representation of a string or numeric claim,
+// since IDs may be encoded as JSON numbers. Other claims are represented by
+// the empty string.
+func claimString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	default:
+		return ""
+	}
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx which carries p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of ctx or nil.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2019, 10, 15, 7, 0, 7, 0, time.UTC)
+
+func TestAPIKeys(t *testing.T) {
+	a := NewAPIKeys(
+		APIKey{ID: "ops", Key: "secret"},
+		APIKey{ID: "driver", Key: "s3cr3t", Claims: map[string]interface{}{"driver_id": "1"}},
+		APIKey{ID: "empty"},
+	)
+	for _, tt := range []struct {
+		d   string // description of test case
+		k   string // API key header
+		s   string // expected subject
+		err error  // expected error
+	}{
+		{d: "expect ops", k: "secret", s: "ops"},
+		{d: "expect driver", k: "s3cr3t", s: "driver"},
+		{d: "expect no credentials", err: ErrNoCredentials},
+		{d: "expect invalid key", k: "secre", err: ErrInvalidCredentials},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.k != "" {
+			r.Header.Set(APIKeyHeader, tt.k)
+		}
+		p, err := a.Authenticate(r)
+		if w, g := tt.err, err; !errors.Is(g, w) || (w == nil) != (g == nil) {
+			t.Errorf("%s: want error %v got %v", tt.d, w, g)
+			continue
+		}
+		if err == nil && p.Subject != tt.s {
+			t.Errorf("%s: want subject %s got %s", tt.d, tt.s, p.Subject)
+		}
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	secret := []byte("secret")
+	h := NewHMAC(5*time.Minute, HMACKey{ID: "app", Secret: secret})
+	h.now = func() time.Time { return now }
+
+	for _, tt := range []struct {
+		d   string                // description of test case
+		f   func(r *http.Request) // modifies the signed request
+		t   time.Time             // time of signing
+		err error                 // expected error
+	}{
+		{d: "expect valid signature", t: now},
+		{d: "expect tolerated clock skew", t: now.Add(4 * time.Minute)},
+		{d: "expect expired signature", t: now.Add(-6 * time.Minute), err: ErrInvalidCredentials},
+		{
+			d:   "expect no credentials",
+			t:   now,
+			f:   func(r *http.Request) { r.Header.Del("Authorization") },
+			err: ErrNoCredentials,
+		},
+		{
+			d:   "expect modified body to be invalid",
+			t:   now,
+			f:   func(r *http.Request) { r.Body = httptest.NewRequest("PATCH", "/", strings.NewReader("{}")).Body },
+			err: ErrInvalidCredentials,
+		},
+		{
+			d:   "expect modified URI to be invalid",
+			t:   now,
+			f:   func(r *http.Request) { r.URL.Path = "/drivers/2/locations" },
+			err: ErrInvalidCredentials,
+		},
+		{
+			d: "expect unknown key to be invalid",
+			t: now,
+			f: func(r *http.Request) {
+				r.Header.Set("Authorization", strings.Replace(r.Header.Get("Authorization"), "app:", "foo:", 1))
+			},
+			err: ErrInvalidCredentials,
+		},
+	} {
+		body := `{"latitude":48.864716,"longitude":2.349014}`
+		r := httptest.NewRequest("PATCH", "/drivers/1/locations", strings.NewReader(body))
+		if err := Sign(r, "app", secret, tt.t); err != nil {
+			t.Fatal(err)
+		}
+		if tt.f != nil {
+			tt.f(r)
+		}
+		p, err := h.Authenticate(r)
+		if w, g := tt.err, err; !errors.Is(g, w) || (w == nil) != (g == nil) {
+			t.Errorf("%s: want error %v got %v", tt.d, w, g)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if w, g := "app", p.Subject; w != g {
+			t.Errorf("%s: want subject %s got %s", tt.d, w, g)
+		}
+		// the body can be read by handlers
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil || string(b) != body {
+			t.Errorf("%s: want body %s got %s", tt.d, body, b)
+		}
+	}
+}
+
+func TestHMACReplay(t *testing.T) {
+	secret := []byte("secret")
+	h := NewHMAC(5*time.Minute, HMACKey{ID: "app", Secret: secret})
+	h.now = func() time.Time { return now }
+	sign := func(ts time.Time) *http.Request {
+		r := httptest.NewRequest("PATCH", "/drivers/1/locations", strings.NewReader("{}"))
+		if err := Sign(r, "app", secret, ts); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	for _, tt := range []struct {
+		d   string        // description of test case
+		n   time.Duration // time of verification since now
+		t   time.Time     // time of signing
+		err error         // expected error
+	}{
+		{d: "expect first request", t: now},
+		{d: "expect replay to be invalid", n: time.Minute, t: now, err: ErrInvalidCredentials},
+		{d: "expect request signed at another time", n: time.Minute, t: now.Add(time.Second)},
+		{d: "expect expired replay to be invalid", n: 6 * time.Minute, t: now.Add(time.Second), err: ErrInvalidCredentials},
+		{d: "expect request after expiry", n: 6 * time.Minute, t: now.Add(6 * time.Minute)},
+	} {
+		h.now = func() time.Time { return now.Add(tt.n) }
+		_, err := h.Authenticate(sign(tt.t))
+		if w, g := tt.err, err; !errors.Is(g, w) || (w == nil) != (g == nil) {
+			t.Errorf("%s: want error %v got %v", tt.d, w, g)
+		}
+	}
+	// expired signatures are removed
+	if w, g := 1, len(h.seen); w != g {
+		t.Errorf("want %d signatures got %d", w, g)
+	}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// signer signs JWTs for tests.
+type signer struct {
+	kid string
+	alg string
+	key crypto.Signer
+}
+
+func (s signer) token(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": s.alg, "kid": s.kid, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := b64(header) + "." + b64(payload)
+	hash := algorithms[s.alg].hash
+	h := hash.New()
+	h.Write([]byte(input))
+	var sig []byte
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, hash, h.Sum(nil))
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+		size := (key.Curve.Params().BitSize + 7) / 8
+		// pad r and s to the size of the curve
+		sig = make([]byte, 2*size)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[size-len(rb):size], rb)
+		copy(sig[2*size-len(sb):], sb)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + b64(sig)
+}
+
+func (s signer) jwk() map[string]string {
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		return map[string]string{
+			"kty": "RSA", "kid": s.kid, "use": "sig", "alg": s.alg,
+			"n": b64(key.N.Bytes()),
+			"e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case *ecdsa.PrivateKey:
+		return map[string]string{
+			"kty": "EC", "kid": s.kid, "crv": "P-256",
+			"x": b64(key.X.Bytes()),
+			"y": b64(key.Y.Bytes()),
+		}
+	}
+	return nil
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := signer{kid: "rsa", alg: "RS256", key: rsaKey}
+	es := signer{kid: "ec", alg: "ES256", key: ecKey}
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []interface{}{
+			rs.jwk(),
+			es.jwk(),
+			map[string]string{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+			map[string]string{"kty": "RSA", "kid": "enc", "use": "enc"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParseJWKS(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := NewJWT(keys, "https://auth.example.com", "gateway", time.Minute)
+	j.now = func() time.Time { return now }
+
+	claims := func(mod map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":       "driver-1",
+			"driver_id": 1,
+			"iss":       "https://auth.example.com",
+			"aud":       []string{"gateway", "other"},
+			"exp":       now.Add(time.Hour).Unix(),
+		}
+		for k, v := range mod {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	for _, tt := range []struct {
+		d   string // description of test case
+		tok string // token
+		err error  // expected error
+	}{
+		{d: "expect valid RS256 token", tok: rs.token(t, claims(nil))},
+		{d: "expect valid ES256 token", tok: es.token(t, claims(nil))},
+		{d: "expect audience string", tok: es.token(t, claims(map[string]interface{}{"aud": "gateway"}))},
+		{d: "expect tolerated expiry", tok: es.token(t, claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}))},
+		{d: "expect no credentials", err: ErrNoCredentials},
+		{d: "expect expired token", tok: es.token(t, claims(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()})), err: ErrInvalidCredentials},
+		{d: "expect missing exp", tok: es.token(t, claims(map[string]interface{}{"exp": nil})), err: ErrInvalidCredentials},
+		{d: "expect token not yet valid", tok: es.token(t, claims(map[string]interface{}{"nbf": now.Add(2 * time.Minute).Unix()})), err: ErrInvalidCredentials},
+		{d: "expect unexpected issuer", tok: es.token(t, claims(map[string]interface{}{"iss": "foo"})), err: ErrInvalidCredentials},
+		{d: "expect unexpected audience", tok: es.token(t, claims(map[string]interface{}{"aud": "foo"})), err: ErrInvalidCredentials},
+		{d: "expect unknown key", tok: signer{kid: "foo", alg: "ES256", key: ecKey}.token(t, claims(nil)), err: ErrInvalidCredentials},
+		{d: "expect invalid signature", tok: signer{kid: "ec", alg: "ES256", key: otherKey}.token(t, claims(nil)), err: ErrInvalidCredentials},
+		{d: "expect algorithm of key", tok: signer{kid: "rsa", alg: "RS512", key: rsaKey}.token(t, claims(nil)), err: ErrInvalidCredentials},
+		{d: "expect none algorithm to be rejected", tok: b64([]byte(`{"alg":"none","kid":"ec"}`)) + "." + b64([]byte(`{"exp":9999999999}`)) + ".", err: ErrInvalidCredentials},
+		{d: "expect malformed token", tok: "foo", err: ErrInvalidCredentials},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.tok != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.tok)
+		}
+		p, err := j.Authenticate(r)
+		if w, g := tt.err, err; !errors.Is(g, w) || (w == nil) != (g == nil) {
+			t.Errorf("%s: want error %v got %v", tt.d, w, g)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if w, g := "driver-1", p.Subject; w != g {
+			t.Errorf("%s: want subject %s got %s", tt.d, w, g)
+		}
+		if err := (Rule{Var: "id", Claim: "driver_id"}).Check(p, map[string]string{"id": "1"}); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.d, err)
+		}
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	for _, tt := range []struct {
+		d string // description of test case
+		s string // JWKS
+	}{
+		{d: "expect invalid JSON", s: `{"keys":`},
+		{d: "expect no keys", s: `{"keys":[]}`},
+		{d: "expect short RSA key", s: `{"keys":[{"kty":"RSA","n":"AQAB","e":"AQAB"}]}`},
+		{d: "expect invalid EC point", s: `{"keys":[{"kty":"EC","crv":"P-256","x":"AQAB","y":"AQAB"}]}`},
+	} {
+		if _, err := ParseJWKS([]byte(tt.s)); err == nil {
+			t.Errorf("%s: want error", tt.d)
+		}
+	}
+}
+
+func TestAny(t *testing.T) {
+	a := Any(NewAPIKeys(APIKey{ID: "ops", Key: "secret"}), NewHMAC(time.Minute))
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, err := a.Authenticate(r); err != ErrNoCredentials {
+		t.Errorf("want error %v got %v", ErrNoCredentials, err)
+	}
+	r.Header.Set(APIKeyHeader, "secret")
+	if p, err := a.Authenticate(r); err != nil || p.Method != MethodAPIKey {
+		t.Errorf("want api key principal got %+v, %v", p, err)
+	}
+	r.Header.Set(APIKeyHeader, "foo")
+	if _, err := a.Authenticate(r); err != ErrInvalidCredentials {
+		t.Errorf("want error %v got %v", ErrInvalidCredentials, err)
+	}
+}
+
+func TestRule(t *testing.T) {
+	rule := Rule{Var: "id", Claim: "driver_id"}
+	for _, tt := range []struct {
+		d  string      // description of test case
+		c  interface{} // claim
+		id string      // path variable
+		ok bool        // expect authorized
+	}{
+		{d: "expect string claim", c: "1", id: "1", ok: true},
+		{d: "expect number claim", c: json.Number("42"), id: "42", ok: true},
+		{d: "expect float claim", c: float64(42), id: "42", ok: true},
+		{d: "expect int claim", c: 42, id: "42", ok: true},
+		{d: "expect other driver", c: "1", id: "2"},
+		{d: "expect missing claim", id: "1"},
+		{d: "expect empty claim", c: "", id: ""},
+		{d: "expect array claim", c: []interface{}{"1"}, id: "1"},
+	} {
+		p := &Principal{Claims: map[string]interface{}{}}
+		if tt.c != nil {
+			p.Claims["driver_id"] = tt.c
+		}
+		err := rule.Check(p, map[string]string{"id": tt.id})
+		if w, g := tt.ok, err == nil; w != g {
+			t.Errorf("%s: want authorized %t got %v", tt.d, w, err)
+		}
+	}
+	if err := rule.Check(nil, map[string]string{"id": "1"}); err == nil {
+		t.Error("want error for missing principal")
+	}
+	if err := rule.Check(&Principal{}, nil); !errors.Is(err, ErrForbidden) {
+		t.Errorf("want error %v got %v", ErrForbidden, err)
+	}
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HMAC signed requests carry the ID of the signing key and the signature in
+// the Authorization header, `HMAC-SHA256 <key ID>:<signature>`, and the time
+// of signing in seconds since the epoch in the TimestampHeader. The signature
+// is the base64 (standard encoding) HMAC-SHA256 of the lines
+//
+//	<method>
+//	<request URI>
+//	<timestamp>
+//	<hex SHA-256 of the body>
+//
+// separated by "\n".
+const (
+	HMACScheme      = "HMAC-SHA256"
+	TimestampHeader = "X-Auth-Timestamp"
+)
+
+// HMACKey is a shared secret identified by ID. Claims are the claims of its
+// principal.
+type HMACKey struct {
+	ID     string
+	Secret []byte
+	Claims map[string]interface{}
+}
+
+// HMAC authenticates HMAC signed requests. Requests signed more than MaxSkew
+// before or after the time of verification are rejected. Within this window,
+// signatures are accepted once, so that captured requests cannot be replayed.
+// Signatures are remembered by the process only, so replays to other
+// instances of a service are rejected by the time window only.
+type HMAC struct {
+	keys    map[string]HMACKey
+	maxSkew time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	seen   map[string]time.Time // expiry of accepted signatures
+	pruned time.Time            // last removal of expired signatures
+}
+
+// NewHMAC returns a HMAC accepting requests signed by keys. Keys without
+// secret are ignored.
+func NewHMAC(maxSkew time.Duration, keys ...HMACKey) *HMAC {
+	h := &HMAC{
+		keys:    make(map[string]HMACKey),
+		maxSkew: maxSkew,
+		now:     time.Now,
+		seen:    make(map[string]time.Time),
+	}
+	for _, k := range keys {
+		if len(k.Secret) > 0 {
+			h.keys[k.ID] = k
+		}
+	}
+	return h
+}
+
+func (h *HMAC) Method() string {
+	return MethodHMAC
+}
+
+func (h *HMAC) Authenticate(r *http.Request) (*Principal, error) {
+	scheme, creds := splitAuthorization(r)
+	if !strings.EqualFold(scheme, HMACScheme) {
+		return nil, ErrNoCredentials
+	}
+	i := strings.LastIndexByte(creds, ':')
+	if i < 0 {
+		return nil, ErrInvalidCredentials
+	}
+	key, ok := h.keys[creds[:i]]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	sig, err := base64.StdEncoding.DecodeString(creds[i+1:])
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	ts := r.Header.Get(TimestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if skew := h.now().Sub(time.Unix(sec, 0)); skew > h.maxSkew || skew < -h.maxSkew {
+		return nil, fmt.Errorf("%w: timestamp out of range", ErrInvalidCredentials)
+	}
+
+	mac, err := signature(r, ts, key.Secret)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(sig, mac) {
+		return nil, ErrInvalidCredentials
+	}
+	if !h.accept(string(sig), time.Unix(sec, 0).Add(h.maxSkew)) {
+		return nil, fmt.Errorf("%w: replayed signature", ErrInvalidCredentials)
+	}
+	return &Principal{
+		Method:  MethodHMAC,
+		Subject: key.ID,
+		Claims:  key.Claims,
+	}, nil
+}
+
+// accept records sig until it expires at exp and reports whether it was not
+// recorded before. Expired signatures are removed once per max skew, so that
+// at most the signatures of two windows are kept.
+func (h *HMAC) accept(sig string, exp time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	if now.Sub(h.pruned) >= h.maxSkew {
+		for s, e := range h.seen {
+			if now.After(e) {
+				delete(h.seen, s)
+			}
+		}
+		h.pruned = now
+	}
+	if _, ok := h.seen[sig]; ok {
+		return false
+	}
+	h.seen[sig] = exp
+	return true
+}
+
+// Sign signs r at t by the key identified by keyID. The body of r is read and
+// replaced, so Sign must be called after the body is set.
+func Sign(r *http.Request, keyID string, secret []byte, t time.Time) error {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac, err := signature(r, ts, secret)
+	if err != nil {
+		return err
+	}
+	r.Header.Set(TimestampHeader, ts)
+	r.Header.Set("Authorization", HMACScheme+" "+keyID+":"+base64.StdEncoding.EncodeToString(mac))
+	return nil
+}
+
+// signature returns the HMAC of r at timestamp ts. The body of r is replaced,
+// so that it can be read by handlers. Errors reading the body, e.g. of a body
+// exceeding its limit, are returned unchanged.
+func signature(r *http.Request, ts string, secret []byte) ([]byte, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", r.Method, r.URL.RequestURI(), ts, hex.EncodeToString(digest[:]))
+	return mac.Sum(nil), nil
+}
+
+// splitAuthorization returns the scheme and the credentials of the
+// Authorization header of r.
+func splitAuthorization(r *http.Request) (string, string) {
+	h := r.Header.Get("Authorization")
+	i := strings.IndexByte(h, ' ')
+	if i < 0 {
+		return h, ""
+	}
+	return h[:i], strings.TrimSpace(h[i+1:])
+}
@@ -0,0 +1,203 @@
+// Package breaker configures the circuit-breakers of hystrix commands from
+// defaults, a YAML file and environment variables.
+package breaker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/rs/zerolog"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Settings of the circuit-breaker of a hystrix command. Zero values are
+// replaced by the defaults of hystrix.
+type Settings struct {
+	Timeout                int `yaml:"timeout"` // ms
+	MaxConcurrentRequests  int `yaml:"max_concurrent_requests"`
+	RequestVolumeThreshold int `yaml:"request_volume_threshold"`
+	SleepWindow            int `yaml:"sleep_window"` // ms
+	ErrorPercentThreshold  int `yaml:"error_percent_threshold"`
+}
+
+// fields returns the settings of s by name of their environment variable
+// suffix.
+func (s *Settings) fields() map[string]*int {
+	return map[string]*int{
+		"TIMEOUT":                  &s.Timeout,
+		"MAX_CONCURRENT_REQUESTS":  &s.MaxConcurrentRequests,
+		"REQUEST_VOLUME_THRESHOLD": &s.RequestVolumeThreshold,
+		"SLEEP_WINDOW":             &s.SleepWindow,
+		"ERROR_PERCENT_THRESHOLD":  &s.ErrorPercentThreshold,
+	}
+}
+
+// merge returns s with all non-zero settings of o.
+func (s Settings) merge(o Settings) Settings {
+	dst, src := s.fields(), o.fields()
+	for name, v := range src {
+		if *v != 0 {
+			*dst[name] = *v
+		}
+	}
+	return s
+}
+
+func (s Settings) validate() error {
+	for name, v := range s.fields() {
+		if *v < 0 {
+			return fmt.Errorf("%s must not be negative", strings.ToLower(name))
+		}
+	}
+	if s.ErrorPercentThreshold > 100 {
+		return fmt.Errorf("error_percent_threshold must not exceed 100")
+	}
+	return nil
+}
+
+// Config holds the settings of hystrix commands by command name.
+type Config map[string]Settings
+
+// file represents a YAML file of breaker settings, e.g.
+//
+//	commands:
+//	  driver_location:
+//	    timeout: 1000
+//	    max_concurrent_requests: 200
+type file struct {
+	Commands Config `yaml:"commands"`
+}
+
+// lookupEnv is replaced in tests.
+var lookupEnv = os.LookupEnv
+
+// Load returns the settings of the commands of defaults. Defaults are
+// overridden by the YAML file at path, if path is not empty, which in turn
+// is overridden by environment variables named HYSTRIX_<COMMAND>_<SETTING>,
+// e.g. HYSTRIX_DRIVER_LOCATION_TIMEOUT. Commands without defaults are
+// rejected as well as invalid settings.
+func Load(path string, defaults Config) (Config, error) {
+	cfg := make(Config, len(defaults))
+	for name, s := range defaults {
+		cfg[name] = s
+	}
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var f file
+		if err := yaml.UnmarshalStrict(data, &f); err != nil {
+			return nil, fmt.Errorf("breaker config %s: %v", path, err)
+		}
+		for name, s := range f.Commands {
+			if _, ok := cfg[name]; !ok {
+				return nil, fmt.Errorf("breaker config %s: unknown command %s", path, name)
+			}
+			cfg[name] = cfg[name].merge(s)
+		}
+	}
+
+	for name, s := range cfg {
+		for field, v := range s.fields() {
+			key := "HYSTRIX_" + strings.ToUpper(name) + "_" + field
+			env, ok := lookupEnv(key)
+			if !ok {
+				continue
+			}
+			n, err := strconv.Atoi(env)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			*v = n
+		}
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("breaker %s: %v", name, err)
+		}
+		cfg[name] = s
+	}
+	return cfg, nil
+}
+
+// Reloader applies breaker settings to hystrix and reloads them on request.
+// It is safe for concurrent use by multiple goroutines.
+type Reloader struct {
+	path     string
+	defaults Config
+	logger   zerolog.Logger
+
+	mu      sync.Mutex
+	current Config
+}
+
+// NewReloader loads the breaker settings, see Load, and applies them.
+func NewReloader(path string, defaults Config, logger zerolog.Logger) (*Reloader, error) {
+	r := &Reloader{
+		path:     path,
+		defaults: defaults,
+		logger:   logger,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads and applies the breaker settings. If they are invalid, the
+// current settings are kept. Changing the max concurrent requests of a
+// command requires to reset all circuits, so their state and statistics are
+// lost.
+func (r *Reloader) Reload() error {
+	cfg, err := Load(r.path, r.defaults)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var flush bool
+	for name, s := range cfg {
+		if old, ok := r.current[name]; ok && old.MaxConcurrentRequests != s.MaxConcurrentRequests {
+			flush = true
+		}
+		hystrix.ConfigureCommand(name, hystrix.CommandConfig{
+			Timeout:                s.Timeout,
+			MaxConcurrentRequests:  s.MaxConcurrentRequests,
+			RequestVolumeThreshold: s.RequestVolumeThreshold,
+			SleepWindow:            s.SleepWindow,
+			ErrorPercentThreshold:  s.ErrorPercentThreshold,
+		})
+	}
+	if flush {
+		hystrix.Flush()
+	}
+	r.current = cfg
+
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.logger.Info().Str("command", name).Interface("settings", cfg[name]).Msg("configured circuit-breaker")
+	}
+	return nil
+}
+
+// Current returns the applied breaker settings.
+func (r *Reloader) Current() Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cfg := make(Config, len(r.current))
+	for name, s := range r.current {
+		cfg[name] = s
+	}
+	return cfg
+}
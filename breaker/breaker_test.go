@@ -0,0 +1,200 @@
+package breaker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/rs/zerolog"
+)
+
+var defaults = Config{
+	"test_fetch": {
+		Timeout:               1000,
+		MaxConcurrentRequests: 200,
+		ErrorPercentThreshold: 25,
+	},
+	"test_publish": {
+		Timeout:               1000,
+		MaxConcurrentRequests: 5000,
+		ErrorPercentThreshold: 25,
+	},
+}
+
+var loadTests = []struct {
+	d string            // description of test case
+	f string            // content of config file; empty for no file
+	e map[string]string // environment variables
+	r Config            // expected result
+	i bool              // expect invalid settings
+}{
+	{
+		d: "expect defaults without file and env",
+		r: defaults,
+	},
+	{
+		d: "expect settings of file to override defaults",
+		f: `commands:
+  test_fetch:
+    timeout: 2000
+    sleep_window: 10000`,
+		r: Config{
+			"test_fetch": {
+				Timeout:               2000,
+				MaxConcurrentRequests: 200,
+				SleepWindow:           10000,
+				ErrorPercentThreshold: 25,
+			},
+			"test_publish": defaults["test_publish"],
+		},
+	},
+	{
+		d: "expect env to override file",
+		f: `commands:
+  test_fetch:
+    timeout: 2000`,
+		e: map[string]string{
+			"HYSTRIX_TEST_FETCH_TIMEOUT":                    "3000",
+			"HYSTRIX_TEST_PUBLISH_REQUEST_VOLUME_THRESHOLD": "5",
+		},
+		r: Config{
+			"test_fetch": {
+				Timeout:               3000,
+				MaxConcurrentRequests: 200,
+				ErrorPercentThreshold: 25,
+			},
+			"test_publish": {
+				Timeout:                1000,
+				MaxConcurrentRequests:  5000,
+				RequestVolumeThreshold: 5,
+				ErrorPercentThreshold:  25,
+			},
+		},
+	},
+	{
+		d: "expect error for unknown command",
+		f: `commands:
+  test_unknown:
+    timeout: 2000`,
+		i: true,
+	},
+	{
+		d: "expect error for unknown setting",
+		f: `commands:
+  test_fetch:
+    timeout_ms: 2000`,
+		i: true,
+	},
+	{
+		d: "expect error for negative setting",
+		e: map[string]string{"HYSTRIX_TEST_FETCH_TIMEOUT": "-1"},
+		i: true,
+	},
+	{
+		d: "expect error for error percent threshold above 100",
+		e: map[string]string{"HYSTRIX_TEST_FETCH_ERROR_PERCENT_THRESHOLD": "101"},
+		i: true,
+	},
+	{
+		d: "expect error for malformed env",
+		e: map[string]string{"HYSTRIX_TEST_FETCH_TIMEOUT": "1s"},
+		i: true,
+	},
+}
+
+// writeConfig writes content to a config file in dir and returns its path;
+// empty content results in an empty path.
+func writeConfig(t *testing.T, dir, content string) string {
+	if content == "" {
+		return ""
+	}
+	path := filepath.Join(dir, "breaker.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return path
+}
+
+// setEnv replaces the environment by env until the returned func is called.
+func setEnv(env map[string]string) func() {
+	lookupEnv = func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+	return func() { lookupEnv = os.LookupEnv }
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "breaker")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range loadTests {
+		t.Run(tt.d, func(t *testing.T) {
+			defer setEnv(tt.e)()
+			cfg, err := Load(writeConfig(t, dir, tt.f), defaults)
+			if tt.i {
+				if err == nil {
+					t.Errorf("expect error got %+v", cfg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w, g := tt.r, cfg; !reflect.DeepEqual(w, g) {
+				t.Errorf("want %+v got %+v", w, g)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "breaker")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer setEnv(nil)()
+
+	path := writeConfig(t, dir, `commands:
+  test_fetch:
+    timeout: 2000`)
+	r, err := NewReloader(path, defaults, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, g := 2*time.Second, hystrix.GetCircuitSettings()["test_fetch"].Timeout; w != g {
+		t.Errorf("want timeout %s got %s", w, g)
+	}
+
+	writeConfig(t, dir, `commands:
+  test_fetch:
+    timeout: 3000`)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, g := 3*time.Second, hystrix.GetCircuitSettings()["test_fetch"].Timeout; w != g {
+		t.Errorf("want timeout %s got %s", w, g)
+	}
+
+	// invalid settings are not applied
+	writeConfig(t, dir, `commands:
+  test_fetch:
+    timeout: -1`)
+	if err := r.Reload(); err == nil {
+		t.Error("expect error for invalid settings")
+	}
+	if w, g := 3*time.Second, hystrix.GetCircuitSettings()["test_fetch"].Timeout; w != g {
+		t.Errorf("want timeout %s got %s", w, g)
+	}
+	if w, g := 3000, r.Current()["test_fetch"].Timeout; w != g {
+		t.Errorf("want current timeout %d got %d", w, g)
+	}
+}
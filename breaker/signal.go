@@ -0,0 +1,31 @@
+package breaker
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ReloadOnSignal reloads the breaker settings of r whenever the process
+// receives SIGHUP until the returned func is called. Failed reloads are logged.
+func (r *Reloader) ReloadOnSignal() (stop func()) {
+	hup := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hup:
+				if err := r.Reload(); err != nil {
+					r.logger.Error().Err(err).Msg("failed to reload circuit-breaker settings")
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hup)
+		close(done)
+	}
+}
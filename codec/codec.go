@@ -0,0 +1,174 @@
+// Package codec encodes the location types exchanged by the services as JSON,
+// Protobuf or MessagePack. The Protobuf schema is defined in locations.proto,
+// the Go types of package pb are generated from it by protoc-gen-go v1.26.0.
+//
+// Messages and stored values are encoded by Encode, which prefixes binary
+// encodings with a tag byte identifying the codec. JSON is not tagged, so
+// Decode reads values encoded before the introduction of codecs as well.
+package codec
+
+//go:generate protoc --go_out=. --go_opt=module=github.com/heetch/FabianG-technical-test/codec locations.proto
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codec marshals and unmarshals values. Codecs other than JSON support the
+// location types only: types.Location, types.LocationUpdate, types.Envelope,
+// []types.LocationUpdate and []string of driver IDs. Unmarshal requires a
+// pointer to one of them.
+type Codec interface {
+	Name() string
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// names of codecs
+const (
+	NameJSON     = "json"
+	NameProtobuf = "protobuf"
+	NameMsgpack  = "msgpack"
+)
+
+// codecs
+var (
+	JSON     Codec = jsonCodec{}
+	Protobuf Codec = protobufCodec{}
+	Msgpack  Codec = msgpackCodec{}
+)
+
+// Names returns the names of all codecs, e.g. for flag validation.
+func Names() []string {
+	return []string{NameJSON, NameProtobuf, NameMsgpack}
+}
+
+// ByName returns the codec identified by name.
+func ByName(name string) (Codec, error) {
+	switch name {
+	case NameJSON:
+		return JSON, nil
+	case NameProtobuf:
+		return Protobuf, nil
+	case NameMsgpack:
+		return Msgpack, nil
+	default:
+		return nil, fmt.Errorf("unknown codec: %s", name)
+	}
+}
+
+// ByContentType returns the codec of the media type of contentType, ignoring
+// parameters. It returns nil if the media type is not supported.
+func ByContentType(contentType string) Codec {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	switch mt {
+	case "application/json":
+		return JSON
+	case "application/x-protobuf", "application/protobuf":
+		return Protobuf
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		return Msgpack
+	default:
+		return nil
+	}
+}
+
+// Accept is the value of an Accept header preferring compact encodings.
+const Accept = "application/x-protobuf, application/msgpack;q=0.9, application/json;q=0.5"
+
+// Negotiate returns the codec of the media range with the highest quality in
+// the Accept header value accept. Wildcards, an empty accept and unsupported
+// media types result in JSON, so clients always get a response.
+func Negotiate(accept string) Codec {
+	type mediaRange struct {
+		c Codec
+		q float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		c := ByContentType(mt)
+		if mt == "*/*" || mt == "application/*" {
+			c = JSON
+		}
+		if c == nil || q <= 0 {
+			continue
+		}
+		ranges = append(ranges, mediaRange{c, q})
+	}
+	if len(ranges) == 0 {
+		return JSON
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	return ranges[0].c
+}
+
+// tags of binary codecs. They are control characters which can not start a
+// JSON value.
+const (
+	tagProtobuf byte = 0x01
+	tagMsgpack  byte = 0x02
+)
+
+// Encode marshals v by c. Binary encodings are prefixed by the tag of c.
+func Encode(c Codec, v interface{}) ([]byte, error) {
+	data, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	switch c.Name() {
+	case NameProtobuf:
+		return append([]byte{tagProtobuf}, data...), nil
+	case NameMsgpack:
+		return append([]byte{tagMsgpack}, data...), nil
+	default:
+		return data, nil
+	}
+}
+
+// Detect returns the codec of data encoded by Encode and the encoded value
+// without tag.
+func Detect(data []byte) (Codec, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errors.New("empty data")
+	}
+	switch data[0] {
+	case tagProtobuf:
+		return Protobuf, data[1:], nil
+	case tagMsgpack:
+		return Msgpack, data[1:], nil
+	default:
+		return JSON, data, nil
+	}
+}
+
+// Decode unmarshals data encoded by Encode into v by the detected codec.
+func Decode(data []byte, v interface{}) error {
+	c, data, err := Detect(data)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(data, v)
+}
+
+// unsupported returns an error for values of an unsupported type.
+func unsupported(c Codec, v interface{}) error {
+	return fmt.Errorf("codec %s does not support %T", c.Name(), v)
+}
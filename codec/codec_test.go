@@ -0,0 +1,227 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+var env = types.Envelope{
+	ID:          "0b0a3c2e-5d1f-4f7e-9a6b-2c7d8e9f0a1b",
+	Version:     types.EnvelopeVersion,
+	Type:        types.EventLocation,
+	Producer:    "gateway/v1",
+	OccurredAt:  "2019-10-15T07:00:07.123Z",
+	PublishedAt: "2019-10-15T07:00:07.125Z",
+	Metadata: map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"b":           "",
+	},
+	Payload: json.RawMessage(`{"id":"3"}`),
+}
+
+// values by name of test case; v is a value, p a pointer to its zero value
+var roundTripTests = map[string]struct {
+	v interface{}
+	p interface{}
+}{
+	"location": {
+		v: types.Location{ID: "1", Lat: 48.864716, Long: -2.349014},
+		p: &types.Location{},
+	},
+	"zero location": {
+		v: types.Location{},
+		p: &types.Location{},
+	},
+	"location update": {
+		v: types.LocationUpdate{UpdatedAt: "2019-10-15T07:00:07Z", Lat: -0.5, Long: 180},
+		p: &types.LocationUpdate{},
+	},
+	"envelope": {
+		v: env,
+		p: &types.Envelope{},
+	},
+	"location updates": {
+		v: []types.LocationUpdate{
+			{UpdatedAt: "2019-10-15T07:00:07Z", Lat: 1, Long: 2},
+			{},
+			{UpdatedAt: "2019-10-15T07:00:12Z", Lat: 3, Long: 4},
+		},
+		p: &[]types.LocationUpdate{},
+	},
+	"driver IDs": {
+		v: []string{"1", "", "42"},
+		p: &[]string{},
+	},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range Names() {
+		c, err := ByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for d, tt := range roundTripTests {
+			b, err := Encode(c, tt.v)
+			if err != nil {
+				t.Errorf("%s: %s: %v", name, d, err)
+				continue
+			}
+			p := reflect.New(reflect.TypeOf(tt.p).Elem())
+			if err := Decode(b, p.Interface()); err != nil {
+				t.Errorf("%s: %s: %v", name, d, err)
+				continue
+			}
+			if w, g := tt.v, p.Elem().Interface(); !reflect.DeepEqual(w, g) {
+				t.Errorf("%s: %s: want %#v got %#v", name, d, w, g)
+			}
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	for _, c := range []Codec{Protobuf, Msgpack} {
+		if _, err := c.Marshal(types.ZombieDriver{}); err == nil {
+			t.Errorf("%s: want error marshaling unsupported type", c.Name())
+		}
+		if err := c.Unmarshal(nil, &types.ZombieDriver{}); err == nil {
+			t.Errorf("%s: want error unmarshaling unsupported type", c.Name())
+		}
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	for _, c := range []Codec{Protobuf, Msgpack} {
+		b, err := c.Marshal(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i < len(b); i++ {
+			var e types.Envelope
+			if err := c.Unmarshal(b[:i], &e); err == nil && reflect.DeepEqual(e, env) {
+				t.Errorf("%s: want truncated data of length %d to differ", c.Name(), i)
+			}
+		}
+	}
+}
+
+func TestProtobufWire(t *testing.T) {
+	l := types.Location{ID: "1", Lat: 1}
+	// field 1 string "1"; field 2 double 1; longitude is omitted
+	w := []byte{0x0a, 0x01, '1', 0x11, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f}
+	g, err := Protobuf.Marshal(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w, g) {
+		t.Errorf("want %x got %x", w, g)
+	}
+
+	// unknown fields of all wire types are skipped
+	b := append([]byte{
+		0x20, 0x96, 0x01, // field 4 varint 150
+		0x29, 0, 0, 0, 0, 0, 0, 0, 0, // field 5 fixed64
+		0x32, 0x02, 'h', 'i', // field 6 bytes
+		0x3d, 0, 0, 0, 0, // field 7 fixed32
+	}, w...)
+	var u types.Location
+	if err := Protobuf.Unmarshal(b, &u); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(l, u) {
+		t.Errorf("want %#v got %#v", l, u)
+	}
+}
+
+func TestMsgpackWire(t *testing.T) {
+	l := types.Location{ID: "1", Lat: 1}
+	w := []byte{0x83,
+		0xa2, 'i', 'd', 0xa1, '1',
+		0xa8, 'l', 'a', 't', 'i', 't', 'u', 'd', 'e', 0xcb, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0,
+		0xa9, 'l', 'o', 'n', 'g', 'i', 't', 'u', 'd', 'e', 0xcb, 0, 0, 0, 0, 0, 0, 0, 0,
+	}
+	g, err := Msgpack.Marshal(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w, g) {
+		t.Errorf("want %x got %x", w, g)
+	}
+
+	// unknown keys are ignored and integers are accepted as coordinates
+	b := []byte{0x83,
+		0xa2, 'i', 'd', 0xa1, '1',
+		0xa8, 'l', 'a', 't', 'i', 't', 'u', 'd', 'e', 0x01,
+		0xa3, 'f', 'o', 'o', 0x92, 0xc3, 0xc0,
+	}
+	var u types.Location
+	if err := Msgpack.Unmarshal(b, &u); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(l, u) {
+		t.Errorf("want %#v got %#v", l, u)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for _, tt := range []struct {
+		d string // description of test case
+		b []byte // data
+		c Codec  // expected codec; nil for error
+	}{
+		{d: "expect JSON", b: []byte(`{"id":"1"}`), c: JSON},
+		{d: "expect JSON with leading whitespace", b: []byte(" {}"), c: JSON},
+		{d: "expect protobuf", b: []byte{tagProtobuf}, c: Protobuf},
+		{d: "expect msgpack", b: []byte{tagMsgpack, 0x80}, c: Msgpack},
+		{d: "expect error for empty data"},
+	} {
+		c, _, err := Detect(tt.b)
+		if tt.c == nil {
+			if err == nil {
+				t.Errorf("%s: want error", tt.d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.d, err)
+			continue
+		}
+		if w, g := tt.c.Name(), c.Name(); w != g {
+			t.Errorf("%s: want %s got %s", tt.d, w, g)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tt := range []struct {
+		a string // Accept header
+		c Codec  // expected codec
+	}{
+		{a: "", c: JSON},
+		{a: "*/*", c: JSON},
+		{a: "text/html", c: JSON},
+		{a: "application/json", c: JSON},
+		{a: "application/x-protobuf", c: Protobuf},
+		{a: "application/protobuf", c: Protobuf},
+		{a: "application/msgpack", c: Msgpack},
+		{a: "application/x-msgpack; charset=binary", c: Msgpack},
+		{a: Accept, c: Protobuf},
+		{a: "application/x-protobuf;q=0.1, application/msgpack", c: Msgpack},
+		{a: "application/x-protobuf;q=0, */*;q=0.1", c: JSON},
+		{a: "application/msgpack;q=0.5, application/json;q=0.5", c: Msgpack},
+		{a: "application/msgpack;q=x, application/json", c: JSON},
+	} {
+		if w, g := tt.c.Name(), Negotiate(tt.a).Name(); w != g {
+			t.Errorf("%q: want %s got %s", tt.a, w, g)
+		}
+	}
+}
+
+func TestByName(t *testing.T) {
+	if _, err := ByName("xml"); err == nil {
+		t.Error("want error for unknown codec")
+	}
+}
@@ -0,0 +1,55 @@
+package codec
+
+import (
+	"bytes"
+
+	"github.com/heetch/FabianG-technical-test/types"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackCodec encodes structs as MessagePack maps keyed by their JSON field
+// names, see https://github.com/msgpack/msgpack/blob/master/spec.md. So values
+// are self-describing like JSON, at a fraction of the size. Unknown keys are
+// ignored.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return NameMsgpack
+}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (c msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v.(type) {
+	case types.Location, *types.Location,
+		types.LocationUpdate, *types.LocationUpdate,
+		types.Envelope, *types.Envelope,
+		[]types.LocationUpdate, *[]types.LocationUpdate,
+		[]string, *[]string:
+	default:
+		return nil, unsupported(c, v)
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	// sorted for deterministic output
+	enc.SetSortMapKeys(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v.(type) {
+	case *types.Location, *types.LocationUpdate, *types.Envelope,
+		*[]types.LocationUpdate, *[]string:
+	default:
+		return unsupported(c, v)
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
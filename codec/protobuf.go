@@ -0,0 +1,136 @@
+package codec
+
+import (
+	"encoding/json"
+
+	"github.com/heetch/FabianG-technical-test/codec/pb"
+	"github.com/heetch/FabianG-technical-test/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// protobufCodec encodes the messages of locations.proto by the generated
+// types of package pb. Fields with default values are omitted as in proto3.
+// Unknown fields are skipped, so fields can be added to the schema.
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string {
+	return NameProtobuf
+}
+
+func (protobufCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+// marshalOptions sort map entries for deterministic output.
+var marshalOptions = proto.MarshalOptions{Deterministic: true}
+
+func (c protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	var m proto.Message
+	switch v := v.(type) {
+	case types.Location:
+		m = toLocation(v)
+	case *types.Location:
+		m = toLocation(*v)
+	case types.LocationUpdate:
+		m = toLocationUpdate(v)
+	case *types.LocationUpdate:
+		m = toLocationUpdate(*v)
+	case types.Envelope:
+		m = toEnvelope(v)
+	case *types.Envelope:
+		m = toEnvelope(*v)
+	case []types.LocationUpdate:
+		m = toLocationUpdates(v)
+	case *[]types.LocationUpdate:
+		m = toLocationUpdates(*v)
+	case []string:
+		m = &pb.DriverIDs{Ids: v}
+	case *[]string:
+		m = &pb.DriverIDs{Ids: *v}
+	default:
+		return nil, unsupported(c, v)
+	}
+	return marshalOptions.Marshal(m)
+}
+
+func (c protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *types.Location:
+		var m pb.Location
+		if err := proto.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		*v = types.Location{ID: m.Id, Lat: m.Latitude, Long: m.Longitude}
+	case *types.LocationUpdate:
+		var m pb.LocationUpdate
+		if err := proto.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		*v = fromLocationUpdate(&m)
+	case *types.Envelope:
+		var m pb.Envelope
+		if err := proto.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		*v = types.Envelope{
+			ID:          m.Id,
+			Version:     int(m.Version),
+			Type:        m.Type,
+			Producer:    m.Producer,
+			OccurredAt:  m.OccurredAt,
+			PublishedAt: m.PublishedAt,
+			Metadata:    m.Metadata,
+			Payload:     json.RawMessage(m.Payload),
+		}
+	case *[]types.LocationUpdate:
+		var m pb.LocationUpdates
+		if err := proto.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		for _, l := range m.Updates {
+			*v = append(*v, fromLocationUpdate(l))
+		}
+	case *[]string:
+		var m pb.DriverIDs
+		if err := proto.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		*v = append(*v, m.Ids...)
+	default:
+		return unsupported(c, v)
+	}
+	return nil
+}
+
+func toLocation(l types.Location) *pb.Location {
+	return &pb.Location{Id: l.ID, Latitude: l.Lat, Longitude: l.Long}
+}
+
+func toLocationUpdate(l types.LocationUpdate) *pb.LocationUpdate {
+	return &pb.LocationUpdate{UpdatedAt: l.UpdatedAt, Latitude: l.Lat, Longitude: l.Long}
+}
+
+func fromLocationUpdate(m *pb.LocationUpdate) types.LocationUpdate {
+	return types.LocationUpdate{UpdatedAt: m.UpdatedAt, Lat: m.Latitude, Long: m.Longitude}
+}
+
+func toEnvelope(e types.Envelope) *pb.Envelope {
+	return &pb.Envelope{
+		Id:          e.ID,
+		Version:     int64(e.Version),
+		Type:        e.Type,
+		Producer:    e.Producer,
+		OccurredAt:  e.OccurredAt,
+		PublishedAt: e.PublishedAt,
+		Metadata:    e.Metadata,
+		Payload:     e.Payload,
+	}
+}
+
+func toLocationUpdates(locs []types.LocationUpdate) *pb.LocationUpdates {
+	m := &pb.LocationUpdates{Updates: make([]*pb.LocationUpdate, len(locs))}
+	for i, l := range locs {
+		m.Updates[i] = toLocationUpdate(l)
+	}
+	return m
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/codec"
+	"github.com/heetch/FabianG-technical-test/handler"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/tracing"
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+// Client is a client of the driver-location service. It is safe for
+// concurrent use by multiple goroutines.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+}
+
+// New returns a Client for the driver-location service at baseURL, e.g.
+// `http://driver-location:8081`. The path of baseURL prefixes the paths of
+// requests, e.g. of a service behind a reverse proxy. If httpClient is nil, a default client is used
+// which propagates the trace context of requests.
+func New(baseURL string, httpClient *http.Client) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid driver-location URL: %s", baseURL)
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Transport: &tracing.Transport{}}
+	}
+	return &Client{
+		baseURL:    u,
+		httpClient: httpClient,
+	}, nil
+}
+
+// Locations returns the location updates of the driver identified by id
+// within the last window, sorted by update time. The window is rounded up to
+// minutes.
+func (c *Client) Locations(ctx context.Context, id string, window time.Duration) ([]types.LocationUpdate, error) {
+	var locs []types.LocationUpdate
+	err := c.get(ctx, "/drivers/"+url.PathEscape(id)+"/locations", minutes(window), &locs)
+	return locs, err
+}
+
+// Active returns the IDs of all drivers which sent location updates within
+// the last window. The window is rounded up to minutes.
+func (c *Client) Active(ctx context.Context, window time.Duration) ([]string, error) {
+	var ids []string
+	err := c.get(ctx, "/drivers", minutes(window), &ids)
+	return ids, err
+}
+
+// Ready returns an error if the driver-location service is not ready to serve
+// requests.
+func (c *Client) Ready(ctx context.Context) error {
+	var r health.Report
+	return c.get(ctx, "/ready", nil, &r)
+}
+
+// minutes returns the query of window in minutes. Windows are rounded up, so
+// that windows of less than a minute do not query zero minutes.
+func minutes(window time.Duration) url.Values {
+	return url.Values{
+		"minutes": []string{strconv.Itoa(int((window + time.Minute - 1) / time.Minute))},
+	}
+}
+
+// get decodes the response of a GET request to the escaped path p, relative
+// to the path of the base URL, into v. Compact
+// encodings are preferred; the response is decoded by the codec of its
+// content type, defaulting to JSON. If the service responds with a status
+// code other than http.StatusOK, the returned error is a *handler.Error.
+func (c *Client) get(ctx context.Context, p string, query url.Values, v interface{}) error {
+	u := *c.baseURL
+	u.RawPath = path.Join("/", c.baseURL.EscapedPath(), p)
+	var err error
+	if u.Path, err = url.PathUnescape(u.RawPath); err != nil {
+		return err
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", codec.Accept)
+	res, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return decodeError(res, data)
+	}
+	dec := codec.ByContentType(res.Header.Get("Content-Type"))
+	if dec == nil {
+		dec = codec.JSON
+	}
+	return dec.Unmarshal(data, v)
+}
+
+// decodeError returns the error of a handler.Error response body. Responses
+// which are not written by handler.WriteError, e.g. the router's not found
+// response, result in an error with the status text of the response.
+func decodeError(res *http.Response, data []byte) error {
+	e := &handler.Error{}
+	if err := json.Unmarshal(data, e); err != nil || e.Err == "" {
+		e.Err = http.StatusText(res.StatusCode)
+	}
+	e.Response = res
+	return e
+}
+
+// IsNotFound reports whether err is caused by a http.StatusNotFound response.
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// StatusCode returns the status code of the response that caused err or zero
+// if err is not caused by an error response.
+func StatusCode(err error) int {
+	if e, ok := err.(*handler.Error); ok && e.Response != nil {
+		return e.Response.StatusCode
+	}
+	return 0
+}
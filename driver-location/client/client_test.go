@@ -0,0 +1,233 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+var testLocations = []types.LocationUpdate{
+	{
+		UpdatedAt: "2019-10-15T07:00:07Z",
+		Lat:       0.40059538,
+		Long:      9.43746775,
+	},
+	{
+		UpdatedAt: "2019-10-15T07:10:07Z",
+		Lat:       0.40073485,
+		Long:      9.43776816,
+	},
+}
+
+// location tests by driver-ID
+var clientTests = map[string]struct {
+	d string                 // description of test case
+	l []types.LocationUpdate // locations of the fake
+	c int                    // status code of the fake
+	r []types.LocationUpdate // expected result
+	s int                    // expected status code of the error
+	e string                 // expected error message
+}{
+	"1": {
+		d: "expect locations",
+		l: testLocations,
+		r: testLocations,
+	},
+	"2": {
+		d: "expect empty result",
+	},
+	"3": {
+		d: "expect decoded internal error",
+		c: http.StatusInternalServerError,
+		s: http.StatusInternalServerError,
+		e: "internal_error",
+	},
+	"4": {
+		d: "expect decoded error",
+		c: http.StatusServiceUnavailable,
+		s: http.StatusServiceUnavailable,
+		e: "fake_error_503",
+	},
+	"foo": {
+		d: "expect not found error for invalid driver-ID",
+		c: http.StatusNotFound,
+		s: http.StatusNotFound,
+		e: "fake_error_404",
+	},
+}
+
+func TestLocations(t *testing.T) {
+	f := NewFake()
+	defer f.Close()
+	for id, tt := range clientTests {
+		if tt.l != nil {
+			f.SetLocations(id, tt.l)
+		}
+		if tt.c != 0 {
+			f.SetError(id, tt.c)
+		}
+	}
+
+	c, err := New(f.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for id, tt := range clientTests {
+		locs, err := c.Locations(context.Background(), id, 5*time.Minute)
+		if w, g := tt.s, StatusCode(err); w != g {
+			t.Errorf("%s: want status code %d got %d", tt.d, w, g)
+		}
+		if err != nil && !strings.HasSuffix(err.Error(), tt.e) {
+			t.Errorf("%s: want error %s got %v", tt.d, tt.e, err)
+		}
+		if tt.s == 0 && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.d, err)
+		}
+		if w, g := tt.r, locs; !reflect.DeepEqual(w, g) {
+			t.Errorf("%s: want %+v got %+v", tt.d, w, g)
+		}
+		if w, g := 1, f.Calls(id); w != g {
+			t.Errorf("%s: want %d calls got %d", tt.d, w, g)
+		}
+	}
+}
+
+func TestActive(t *testing.T) {
+	f := NewFake()
+	defer f.Close()
+	f.SetLocations("2", testLocations)
+	f.SetLocations("1", testLocations)
+
+	c, err := New(f.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ids, err := c.Active(context.Background(), 5*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, g := []string{"1", "2"}, ids; !reflect.DeepEqual(w, g) {
+		t.Errorf("want %v got %v", w, g)
+	}
+}
+
+func TestNegotiation(t *testing.T) {
+	var contentType string
+	f := NewFake()
+	defer f.Close()
+	f.SetLocations("1", testLocations)
+
+	c, err := New(f.URL, &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		res, err := http.DefaultTransport.RoundTrip(r)
+		if err == nil {
+			contentType = res.Header.Get("Content-Type")
+		}
+		return res, err
+	})})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	locs, err := c.Locations(context.Background(), "1", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, g := testLocations, locs; !reflect.DeepEqual(w, g) {
+		t.Errorf("want %+v got %+v", w, g)
+	}
+	if w, g := "application/x-protobuf", contentType; w != g {
+		t.Errorf("want content type %s got %s", w, g)
+	}
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestReady(t *testing.T) {
+	f := NewFake()
+	defer f.Close()
+
+	c, err := New(f.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Ready(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	f.SetReady(false)
+	err = c.Ready(context.Background())
+	if w, g := http.StatusServiceUnavailable, StatusCode(err); w != g {
+		t.Errorf("want status code %d got %d", w, g)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.Locations(ctx, "1", time.Minute)
+	if err == nil {
+		t.Fatal("want error got nil")
+	}
+	if w, g := context.DeadlineExceeded, ctx.Err(); w != g {
+		t.Errorf("want %v got %v", w, g)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, u := range []string{"", "driver-location:8081", "://foo"} {
+		if _, err := New(u, nil); err == nil {
+			t.Errorf("want error for URL %q", u)
+		}
+	}
+}
+
+func TestRequestURI(t *testing.T) {
+	var uri string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uri = r.URL.RequestURI()
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		d string        // description of test case
+		p string        // path of base URL
+		w time.Duration // window
+		u string        // expected request URI
+	}{
+		{d: "expect window in minutes", w: 5 * time.Minute, u: "/drivers/1/locations?minutes=5"},
+		{d: "expect window rounded up", w: 90 * time.Second, u: "/drivers/1/locations?minutes=2"},
+		{d: "expect window below a minute rounded up", w: 30 * time.Second, u: "/drivers/1/locations?minutes=1"},
+		{d: "expect root path", p: "/", w: time.Minute, u: "/drivers/1/locations?minutes=1"},
+		{d: "expect path prefix", p: "/driver-location", w: time.Minute, u: "/driver-location/drivers/1/locations?minutes=1"},
+		{d: "expect path prefix with slash", p: "/driver-location/", w: time.Minute, u: "/driver-location/drivers/1/locations?minutes=1"},
+	} {
+		c, err := New(srv.URL+tt.p, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := c.Locations(context.Background(), "1", tt.w); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.d, err)
+		}
+		if w, g := tt.u, uri; w != g {
+			t.Errorf("%s: want request URI %s got %s", tt.d, w, g)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/heetch/FabianG-technical-test/handler"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+// Fake is an httptest based fake of the driver-location service for use in
+// tests of its clients. Note, the fake ignores the requested time window.
+type Fake struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	locations map[string][]types.LocationUpdate
+	errs      map[string]int
+	calls     map[string]int
+	notReady  bool
+}
+
+// NewFake starts and returns a Fake. The caller should call Close when
+// finished, to shut it down.
+func NewFake() *Fake {
+	f := &Fake{
+		locations: make(map[string][]types.LocationUpdate),
+		errs:      make(map[string]int),
+		calls:     make(map[string]int),
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/drivers/{id}/locations", f.serveLocations).Methods("GET").Queries("minutes", "{minutes:[0-9]+}")
+	router.HandleFunc("/drivers", f.serveActive).Methods("GET").Queries("minutes", "{minutes:[0-9]+}")
+	router.HandleFunc("/ready", f.serveReady).Methods("GET")
+	f.Server = httptest.NewServer(router)
+	return f
+}
+
+// SetLocations sets the location updates of the driver identified by id.
+// Drivers with location updates are considered to be active.
+func (f *Fake) SetLocations(id string, locs []types.LocationUpdate) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.locations[id] = locs
+}
+
+// SetError makes requests for the locations of the driver identified by id
+// fail with the given status code.
+func (f *Fake) SetError(id string, code int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs[id] = code
+}
+
+// SetReady sets the readiness of the fake; it is ready by default.
+func (f *Fake) SetReady(ready bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notReady = !ready
+}
+
+// Calls returns the number of location requests for the driver identified
+// by id.
+func (f *Fake) Calls(id string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[id]
+}
+
+func (f *Fake) serveLocations(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	f.mu.Lock()
+	f.calls[id]++
+	code, failed := f.errs[id]
+	locs := f.locations[id]
+	f.mu.Unlock()
+
+	if failed {
+		handler.WriteError(w, r, errFake(code), code)
+		return
+	}
+	handler.Encode(w, r, locs, http.StatusOK)
+}
+
+func (f *Fake) serveReady(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	notReady := f.notReady
+	f.mu.Unlock()
+
+	if notReady {
+		handler.EncodeJSON(w, r, health.Report{Status: health.StatusFailing}, http.StatusServiceUnavailable)
+		return
+	}
+	handler.EncodeJSON(w, r, health.Report{Status: health.StatusOK}, http.StatusOK)
+}
+
+func (f *Fake) serveActive(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	ids := make([]string, 0, len(f.locations))
+	for id := range f.locations {
+		ids = append(ids, id)
+	}
+	f.mu.Unlock()
+	sort.Strings(ids)
+	handler.Encode(w, r, ids, http.StatusOK)
+}
+
+// errFake is the error responded by the Fake for failing drivers.
+type errFake int
+
+func (e errFake) Error() string {
+	return "fake_error_" + strconv.Itoa(int(e))
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"os"
+	"time"
 
-	"github.com/afex/hystrix-go/hystrix"
-	"github.com/heetch/FabianG-technical-test/driver-location/cmd/driver-location/cli"
+	"github.com/heetch/FabianG-technical-test/admin"
+	"github.com/heetch/FabianG-technical-test/breaker"
+	"github.com/heetch/FabianG-technical-test/codec"
 	"github.com/heetch/FabianG-technical-test/driver-location/consumer"
 	"github.com/heetch/FabianG-technical-test/driver-location/server"
 	"github.com/heetch/FabianG-technical-test/driver-location/store"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/httpserver"
+	"github.com/heetch/FabianG-technical-test/lifecycle"
+	"github.com/heetch/FabianG-technical-test/logging"
 	"github.com/heetch/FabianG-technical-test/metrics"
+	"github.com/heetch/FabianG-technical-test/tlsconfig"
+	"github.com/heetch/FabianG-technical-test/tracing"
 	nsq "github.com/nsqio/go-nsq"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
@@ -17,12 +27,17 @@ import (
 var (
 	version = "unkown"
 
-	service     = kingpin.Flag("service", "service name").Envar("SERVICE").Default("driver-location").String()
-	httpAddr    = kingpin.Flag("http-addr", "address of HTTP server").Envar("HTTP_ADDR").Required().String()
-	metricsAddr = kingpin.Flag("metrics-addr", "address of metrics server").Envar("METRICS_ADDR").Required().String()
+	service          = kingpin.Flag("service", "service name").Envar("SERVICE").Default("driver-location").String()
+	httpAddr         = kingpin.Flag("http-addr", "address of HTTP server").Envar("HTTP_ADDR").Required().String()
+	metricsAddr      = kingpin.Flag("metrics-addr", "address of metrics server").Envar("METRICS_ADDR").Required().String()
+	adminAddr        = kingpin.Flag("admin-addr", "address of admin server, e.g. 127.0.0.1:6060; disabled if empty").Envar("ADMIN_ADDR").String()
+	adminAllowRemote = kingpin.Flag("admin-allow-remote", "allow --admin-addr not bound to localhost").Envar("ADMIN_ALLOW_REMOTE").Bool()
 
 	// Redis
-	redisAddr = kingpin.Flag("redis-addr", "address of Redis instance to connect").Envar("REDIS_ADDR").Required().String()
+	redisAddr    = kingpin.Flag("redis-addr", "address of Redis instance to connect").Envar("REDIS_ADDR").Required().String()
+	storeCodec   = kingpin.Flag("store-codec", "codec of location updates stored in Redis").Envar("STORE_CODEC").Default(codec.NameJSON).Enum(codec.Names()...)
+	storeMigrate = kingpin.Flag("store-migrate", "re-encode stored location updates by the store codec on startup").Envar("STORE_MIGRATE").Bool()
+	activeTTL    = kingpin.Flag("active-retention", "retention of drivers in the set of active drivers in minutes; 0 keeps drivers forever").Envar("ACTIVE_RETENTION").Default("1440").Int()
 
 	// NSQ
 	nsqdTCPAddrs        = kingpin.Flag("nsqd-tcp-addrs", "TCP addresses of NSQ deamon").Envar("NSQD_TCP_ADDRS").Required().Strings()
@@ -31,6 +46,44 @@ var (
 	nsqChan             = kingpin.Flag("nsqd-chan", "NSQ channel").Envar("NSQ_CHAN").Required().String()
 	nsqNumPublishers    = kingpin.Flag("nsq-num-publishers", "NSQ publishers").Envar("NSQ_NUM_PUBLISHERS").Default("100").Int()
 	nsqMaxInflight      = kingpin.Flag("nsq-max-inflight", "NSQ max inflight").Envar("NSQ_MAX_INFLIGHT").Default("250").Int()
+	nsqTLS              = kingpin.Flag("nsq-tls", "connect to NSQ deamon by TLS").Envar("NSQ_TLS").Bool()
+
+	// circuit-breaker
+	breakerCfgPath = kingpin.Flag("breaker-cfg-file", "path to circuit-breaker config file").Envar("BREAKER_CFG_PATH").String()
+
+	// http server
+	httpReadHeaderTimeout = kingpin.Flag("http-read-header-timeout", "max duration of reading request headers in ms").Envar("HTTP_READ_HEADER_TIMEOUT").Default("5000").Int()
+	httpReadTimeout       = kingpin.Flag("http-read-timeout", "max duration of reading requests in ms").Envar("HTTP_READ_TIMEOUT").Default("10000").Int()
+	httpWriteTimeout      = kingpin.Flag("http-write-timeout", "max duration of writing responses in ms").Envar("HTTP_WRITE_TIMEOUT").Default("15000").Int()
+	httpIdleTimeout       = kingpin.Flag("http-idle-timeout", "max idle duration of keep-alive connections in ms").Envar("HTTP_IDLE_TIMEOUT").Default("120000").Int()
+	httpMaxHeaderBytes    = kingpin.Flag("http-max-header-bytes", "max size of request headers").Envar("HTTP_MAX_HEADER_BYTES").Default("1048576").Int()
+	requestTimeout        = kingpin.Flag("request-timeout", "deadline of requests in ms").Envar("REQUEST_TIMEOUT").Default("10000").Int()
+
+	// TLS
+	tlsCertFile       = kingpin.Flag("tls-cert-file", "path to TLS certificate; enables TLS of the HTTP server").Envar("TLS_CERT_FILE").String()
+	tlsKeyFile        = kingpin.Flag("tls-key-file", "path to TLS private key").Envar("TLS_KEY_FILE").String()
+	tlsCAFile         = kingpin.Flag("tls-ca-file", "path to CA certificates verifying clients and services; defaults to system CAs").Envar("TLS_CA_FILE").String()
+	tlsClientAuth     = kingpin.Flag("tls-client-auth", "require client certificates signed by the CAs (mutual TLS)").Envar("TLS_CLIENT_AUTH").Bool()
+	tlsMetrics        = kingpin.Flag("tls-metrics", "serve metrics and admin endpoints by TLS").Envar("TLS_METRICS").Bool()
+	tlsReloadInterval = kingpin.Flag("tls-reload-interval", "interval of checking TLS files for changes in ms").Envar("TLS_RELOAD_INTERVAL").Default("10000").Int()
+
+	// logging
+	logFormat       = kingpin.Flag("log-format", "format of logs").Envar("LOG_FORMAT").Default(logging.FormatConsole).Enum(logging.FormatJSON, logging.FormatConsole)
+	logLevel        = kingpin.Flag("log-level", "min level of logs").Envar("LOG_LEVEL").Default("debug").Enum(logging.Levels...)
+	logLevels       = kingpin.Flag("log-levels", "min levels of logs by component, e.g. http=info,nsq=warn").Envar("LOG_LEVELS").String()
+	logSampleAccess = kingpin.Flag("log-sample-access", "log 1 of n requests to the access log; server errors are always logged").Envar("LOG_SAMPLE_ACCESS").Default("1").Uint32()
+	logSampleNSQ    = kingpin.Flag("log-sample-nsq", "log 1 of n handled NSQ messages; failures are always logged").Envar("LOG_SAMPLE_NSQ").Default("1").Uint32()
+
+	// tracing
+	traceExporter     = kingpin.Flag("trace-exporter", "exporter of trace spans").Envar("TRACE_EXPORTER").Default(tracing.ExporterNone).Enum(tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterHTTP)
+	traceCollectorURL = kingpin.Flag("trace-collector-url", "URL of OTLP/HTTP trace collector of http exporter").Envar("TRACE_COLLECTOR_URL").String()
+
+	// health checks
+	healthTTL     = kingpin.Flag("health-ttl", "cache duration of health check results in ms").Envar("HEALTH_TTL").Default("2000").Int()
+	healthTimeout = kingpin.Flag("health-timeout", "timeout of health checks in ms").Envar("HEALTH_TIMEOUT").Default("1000").Int()
+
+	// readiness drain before the shutdown, e.g. while load balancers update
+	drainDelay = kingpin.Flag("drain-delay", "delay of shutdown after the service reports not ready in ms").Envar("DRAIN_DELAY").Default("0").Int()
 
 	// should be greater than prometheus scrape interval (default 30s); decreased in coding challenge
 	shutdownDelay = kingpin.Flag("shutdown-delay", "shutdown delay in ms").Envar("SHUTDOWN_DELAY").Default("5000").Int()
@@ -40,31 +93,110 @@ func main() {
 	kingpin.Version(version)
 	kingpin.Parse()
 
-	// configure circuit-breaker
-	hystrix.ConfigureCommand("fetch_redis", hystrix.CommandConfig{
-		Timeout:               1000, // ms
-		MaxConcurrentRequests: 1000,
-		ErrorPercentThreshold: 25,
-	})
-	hystrix.ConfigureCommand("handle_nsq_msg", hystrix.CommandConfig{
-		Timeout:               1000, // ms
-		MaxConcurrentRequests: 1000,
-		ErrorPercentThreshold: 25,
+	loggers, err := logging.New(*service, version, logging.Config{
+		Format: *logFormat,
+		Level:  *logLevel,
+		Levels: *logLevels,
 	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+		os.Exit(2)
+	}
+	logger := loggers.Logger()
+	metrics.SetBuildInfo(*service, version)
 
-	logger := cli.NewLogger(*service, version)
+	// configure circuit-breakers; settings are reloaded on SIGHUP
+	breakers, err := breaker.NewReloader(*breakerCfgPath, breaker.Config{
+		"fetch_redis": {
+			Timeout:               1000, // ms
+			MaxConcurrentRequests: 1000,
+			ErrorPercentThreshold: 25,
+		},
+		"handle_nsq_msg": {
+			Timeout:               1000, // ms
+			MaxConcurrentRequests: 1000,
+			ErrorPercentThreshold: 25,
+		},
+	}, loggers.Component("breaker"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+		os.Exit(2)
+	}
+	defer breakers.ReloadOnSignal()()
 
-	redisStore := store.NewRedis(*redisAddr)
-	httpSrv, err := server.New(*httpAddr, redisStore, logger)
+	// certificates are reloaded when their files change
+	certs, err := tlsconfig.NewReloader(tlsconfig.Config{
+		CertFile:   *tlsCertFile,
+		KeyFile:    *tlsKeyFile,
+		CAFile:     *tlsCAFile,
+		ClientAuth: *tlsClientAuth,
+	}, loggers.Component("tls"))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
 		os.Exit(2)
 	}
+	defer certs.Watch(time.Duration(*tlsReloadInterval) * time.Millisecond)()
+	var metricsTLS *tls.Config
+	if *tlsMetrics {
+		if metricsTLS = certs.ServerConfig(); metricsTLS == nil {
+			fmt.Fprintf(os.Stderr, "%s service: TLS of metrics requires a certificate\n", *service)
+			os.Exit(2)
+		}
+	}
 
-	metricsSrv := metrics.New(*metricsAddr, logger)
+	// spans are exported on a best effort basis; trace context is propagated
+	// regardless of the exporter
+	exp, err := tracing.NewExporter(*traceExporter, *traceCollectorURL, loggers.Component("tracing"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+		os.Exit(2)
+	}
+	tracing.Init(*service, exp)
+	defer tracing.Shutdown(context.Background())
+
+	c, err := codec.ByName(*storeCodec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+		os.Exit(2)
+	}
+	redisStore := store.NewRedis(*redisAddr, c)
+	if *storeMigrate {
+		// the store reads all codecs, so the service is ready meanwhile
+		go func() {
+			migrated, skipped, err := redisStore.Migrate(context.Background())
+			if err != nil {
+				logger.Error().Err(err).Int("migrated", migrated).Msg("store migration failed")
+				return
+			}
+			logger.Info().Int("migrated", migrated).Int("skipped", skipped).Str("codec", c.Name()).Msg("store migration done")
+		}()
+	}
+	hc := health.New(time.Duration(*healthTTL)*time.Millisecond, time.Duration(*healthTimeout)*time.Millisecond)
+	hc.Register("redis", health.Func(redisStore.Ping))
+	srvCfg := httpserver.Config{
+		ReadHeaderTimeout: time.Duration(*httpReadHeaderTimeout) * time.Millisecond,
+		ReadTimeout:       time.Duration(*httpReadTimeout) * time.Millisecond,
+		WriteTimeout:      time.Duration(*httpWriteTimeout) * time.Millisecond,
+		IdleTimeout:       time.Duration(*httpIdleTimeout) * time.Millisecond,
+		MaxHeaderBytes:    *httpMaxHeaderBytes,
+		RequestTimeout:    time.Duration(*requestTimeout) * time.Millisecond,
+		TLS:               certs.ServerConfig(),
+		AccessLogSampler:  logging.Sampler(*logSampleAccess),
+	}
+	httpSrv, err := server.New(*httpAddr, srvCfg, redisStore, hc, loggers.Component("http"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+		os.Exit(2)
+	}
+
+	metricsSrv := metrics.New(*metricsAddr, metricsTLS, loggers.Component("metrics"))
 
 	cfg := nsq.NewConfig()
 	cfg.MaxInFlight = *nsqMaxInflight
+	if *nsqTLS {
+		cfg.TlsV1 = true
+		cfg.TlsConfig = certs.ClientConfig()
+	}
 	ncfg := &consumer.NSQConfig{
 		NumPublishers:    *nsqNumPublishers,
 		Topic:            *nsqTopic,
@@ -72,15 +204,49 @@ func main() {
 		LookupdHTTPAddrs: *nsqLookupdHTTPAddrs,
 		NsqdTCPAddrs:     *nsqdTCPAddrs,
 		Cfg:              cfg,
+		Sampler:          logging.Sampler(*logSampleNSQ),
 	}
 	handler := &consumer.LocationUpdater{
 		Publisher: redisStore,
 	}
-	nsqConsumer, err := consumer.NewNSQ(ncfg, handler, logger)
+	nsqConsumer, err := consumer.NewNSQ(ncfg, handler, loggers.Component("nsq"))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
 		os.Exit(2)
 	}
+	hc.Register("nsq", nsqConsumer.Check)
 
-	cli.RunServer(httpSrv, metricsSrv, nsqConsumer, *shutdownDelay)
+	// the http server is shut down first, so that its final metrics are
+	// scraped
+	lc := lifecycle.New(lifecycle.Config{
+		DrainDelay:      time.Duration(*drainDelay) * time.Millisecond,
+		ShutdownTimeout: time.Duration(*shutdownDelay) * time.Millisecond,
+	}, logger)
+	lc.Register("http", httpSrv)
+	lc.Register("nsq", nsqConsumer)
+	if *activeTTL > 0 {
+		lc.Register("trimmer", store.NewTrimmer(redisStore, time.Duration(*activeTTL)*time.Minute, loggers.Component("store")))
+	}
+	lc.Register("metrics", metricsSrv)
+	if *adminAddr != "" {
+		adminSrv, err := admin.New(*adminAddr, admin.Config{
+			Service:     *service,
+			Version:     version,
+			Config:      map[string]interface{}{"flags": admin.Flags(kingpin.CommandLine)},
+			TLS:         metricsTLS,
+			AllowRemote: *adminAllowRemote,
+		}, loggers.Component("admin"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+			os.Exit(2)
+		}
+		// log levels are changed at runtime by PUT /log/level?component=http&level=info
+		adminSrv.Handle("/log/level", loggers)
+		lc.Register("admin", adminSrv)
+	}
+	if err := lc.Run(context.Background()); err != nil {
+		// deferred funcs do not run on exit
+		tracing.Shutdown(context.Background())
+		os.Exit(1)
+	}
 }
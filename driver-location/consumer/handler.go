@@ -1,14 +1,35 @@
 package consumer
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/afex/hystrix-go/hystrix"
+	"github.com/heetch/FabianG-technical-test/codec"
+	"github.com/heetch/FabianG-technical-test/tracing"
 	"github.com/heetch/FabianG-technical-test/types"
 	nsq "github.com/nsqio/go-nsq"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+var (
+	messageCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "driver_location_messages_total",
+			Help: "counts location messages by format; legacy or envelope version, and codec",
+		},
+		[]string{"format", "codec"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(messageCounter)
+}
+
 // Publisher provides a method that is used in nsq-handlers to publish messages.
 type Publisher interface {
 	Publish(timestamp int64, key string, l types.LocationUpdate) error
@@ -21,15 +42,26 @@ type LocationUpdater struct {
 }
 
 // HandleMessage publishes a location update extracted from a nsq-message.
+// The message is handled within a span which continues the trace of the
+// publisher, if the message carries trace context. The update time is the
+// time the event occurred, if known, else the time the message was published.
 func (h *LocationUpdater) HandleMessage(m *nsq.Message) error {
-	var l types.Location
-	// marshal instead of decode since we expect a single JSON string only not
-	// a stream or additional data
-	err := json.Unmarshal(m.Body, &l)
+	env, l, c, err := decode(m.Body)
 	if err != nil {
 		return err
 	}
-	t := time.Unix(0, m.Timestamp)
+	messageCounter.WithLabelValues(format(env), c.Name()).Inc()
+	ctx := tracing.Extract(context.Background(), tracing.MapCarrier(env.Metadata))
+	_, span := tracing.Start(ctx, "handle location update", tracing.KindConsumer)
+	defer span.End()
+	if env.ID != "" {
+		span.SetAttribute("event.id", env.ID)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, env.OccurredAt)
+	if err != nil {
+		t = time.Unix(0, m.Timestamp)
+	}
 	lu := types.LocationUpdate{
 		UpdatedAt: t.Format(time.RFC3339),
 		Lat:       l.Lat,
@@ -38,7 +70,54 @@ func (h *LocationUpdater) HandleMessage(m *nsq.Message) error {
 	// we add a circuit breaker here although we are currently working with
 	// redis handler only which does not require it
 	// see: https://github.com/go-redis/redis/issues/675
-	return hystrix.Do("handle_nsq_msg", func() error {
+	err = hystrix.Do("handle_nsq_msg", func() error {
 		return h.Publish(t.UnixNano(), l.ID, lu)
 	}, nil)
+	span.SetError(err)
+	return err
+}
+
+// formatLegacy is the format of messages without envelope
+const formatLegacy = "legacy"
+
+// format returns the format of the message of env for metrics.
+func format(env types.Envelope) string {
+	if env.Payload == nil {
+		return formatLegacy
+	}
+	return "v" + strconv.Itoa(env.Version)
+}
+
+// decode returns the envelope, the location and the codec of a message body
+// encoded by codec.Encode. JSON bodies without a payload are legacy messages of
+// a bare location; their envelope has no payload. Binary codecs encode the
+// payload by the codec of the envelope. Envelopes of unknown versions or types
+// are rejected.
+func decode(body []byte) (types.Envelope, types.Location, codec.Codec, error) {
+	var l types.Location
+	var env types.Envelope
+	c, data, err := codec.Detect(body)
+	if err != nil {
+		return env, l, c, err
+	}
+	// unmarshal instead of decode since we expect a single value only not a
+	// stream or additional data
+	if err := c.Unmarshal(data, &env); err != nil {
+		return env, l, c, err
+	}
+	if env.Payload == nil {
+		if c != codec.JSON {
+			return env, l, c, errors.New("missing payload")
+		}
+		return types.Envelope{}, l, c, json.Unmarshal(data, &l)
+	}
+	if env.Version > types.EnvelopeVersion {
+		return env, l, c, fmt.Errorf("unsupported envelope version %d", env.Version)
+	}
+	// the type is known since version 1
+	if env.Version > 0 && env.Type != types.EventLocation {
+		return env, l, c, fmt.Errorf("unsupported event type %q", env.Type)
+	}
+	err = c.Unmarshal(env.Payload, &l)
+	return env, l, c, err
 }
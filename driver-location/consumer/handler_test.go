@@ -4,6 +4,7 @@ import (
 	"regexp"
 	"testing"
 
+	"github.com/heetch/FabianG-technical-test/codec"
 	"github.com/heetch/FabianG-technical-test/types"
 	nsq "github.com/nsqio/go-nsq"
 )
@@ -37,6 +38,17 @@ var nsqHandlerTests = map[string]struct {
 			Long: 9.53746775,
 		},
 	},
+	"3": {
+		d: "expect LocationUpdates of enveloped message to equal",
+		m: nsq.NewMessage(
+			nsq.MessageID{},
+			[]byte(`{"id":"0b0a3c2e-5d1f-4f7e-9a6b-2c7d8e9f0a1b","version":1,"type":"location","producer":"gateway/v1","occurred_at":"2019-10-15T07:00:07.123Z","published_at":"2019-10-15T07:00:07.125Z","metadata":{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},"payload":{"id":"3","latitude":0.60059538,"longitude":9.63746775}}`)),
+		l: types.LocationUpdate{
+			UpdatedAt: "2019-10-15T07:00:07Z",
+			Lat:       0.60059538,
+			Long:      9.63746775,
+		},
+	},
 }
 
 // testPublisher mocks a Publisher. It checks for message equality and timestamp format.
@@ -56,6 +68,10 @@ func (t *testPublisher) Publish(timestamp int64, key string, l types.LocationUpd
 	if w, g := 1, len(r.FindAllString(l.UpdatedAt, -1)); w != g {
 		t.t.Errorf("%s: want %d match got %d", nsqHandlerTests[key].d, w, g)
 	}
+	// the time an enveloped event occurred is known
+	if w, g := nsqHandlerTests[key].l.UpdatedAt, l.UpdatedAt; w != "" && w != g {
+		t.t.Errorf("%s: want update time %s got %s", nsqHandlerTests[key].d, w, g)
+	}
 	return nil
 }
 
@@ -74,3 +90,122 @@ func TestLocationUpdater(t *testing.T) {
 		}
 	}
 }
+
+var decodeTests = []struct {
+	d   string         // test case description
+	b   string         // message body
+	l   types.Location // expected location
+	f   string         // expected format
+	tp  string         // expected traceparent
+	err bool           // expect error
+}{
+	{
+		d: "expect legacy location",
+		b: `{"id":"1","latitude":0.4,"longitude":9.4}`,
+		l: types.Location{ID: "1", Lat: 0.4, Long: 9.4},
+		f: "legacy",
+	},
+	{
+		d:  "expect unversioned envelope with trace context",
+		b:  `{"metadata":{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},"payload":{"id":"1","latitude":0.4,"longitude":9.4}}`,
+		l:  types.Location{ID: "1", Lat: 0.4, Long: 9.4},
+		f:  "v0",
+		tp: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	},
+	{
+		d:  "expect envelope of version 1",
+		b:  `{"id":"0b0a3c2e-5d1f-4f7e-9a6b-2c7d8e9f0a1b","version":1,"type":"location","producer":"gateway/v1","occurred_at":"2019-10-15T07:00:07.123Z","published_at":"2019-10-15T07:00:07.125Z","metadata":{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},"payload":{"id":"1","latitude":0.4,"longitude":9.4}}`,
+		l:  types.Location{ID: "1", Lat: 0.4, Long: 9.4},
+		f:  "v1",
+		tp: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	},
+	{
+		d:   "expect error for unsupported version",
+		b:   `{"version":2,"type":"location","payload":{"id":"1","latitude":0.4,"longitude":9.4}}`,
+		err: true,
+	},
+	{
+		d:   "expect error for unsupported type",
+		b:   `{"version":1,"type":"trip","payload":{"id":"1","latitude":0.4,"longitude":9.4}}`,
+		err: true,
+	},
+	{
+		d:   "expect error for invalid payload",
+		b:   `{"payload":"foo"}`,
+		err: true,
+	},
+	{
+		d:   "expect error for invalid JSON",
+		b:   `{"id":"1"`,
+		err: true,
+	},
+}
+
+func TestDecode(t *testing.T) {
+	for _, tt := range decodeTests {
+		env, l, c, err := decode([]byte(tt.b))
+		if w, g := tt.err, err != nil; w != g {
+			t.Errorf("%s: want error %t got %v", tt.d, w, err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		if w, g := tt.l, l; w != g {
+			t.Errorf("%s: want %+v got %+v", tt.d, w, g)
+		}
+		if w, g := tt.f, format(env); w != g {
+			t.Errorf("%s: want format %s got %s", tt.d, w, g)
+		}
+		if w, g := codec.NameJSON, c.Name(); w != g {
+			t.Errorf("%s: want codec %s got %s", tt.d, w, g)
+		}
+		if w, g := tt.tp, env.Metadata["traceparent"]; w != g {
+			t.Errorf("%s: want traceparent %s got %s", tt.d, w, g)
+		}
+	}
+}
+
+func TestDecodeBinary(t *testing.T) {
+	l := types.Location{ID: "1", Lat: 0.4, Long: 9.4}
+	for _, c := range []codec.Codec{codec.Protobuf, codec.Msgpack} {
+		payload, err := c.Marshal(l)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		env := types.Envelope{
+			ID:          "0b0a3c2e-5d1f-4f7e-9a6b-2c7d8e9f0a1b",
+			Version:     types.EnvelopeVersion,
+			Type:        types.EventLocation,
+			OccurredAt:  "2019-10-15T07:00:07.123Z",
+			PublishedAt: "2019-10-15T07:00:07.125Z",
+			Payload:     payload,
+		}
+		b, err := codec.Encode(c, env)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		denv, dl, dc, err := decode(b)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.Name(), err)
+		}
+		if w, g := l, dl; w != g {
+			t.Errorf("%s: want %+v got %+v", c.Name(), w, g)
+		}
+		if w, g := env.ID, denv.ID; w != g {
+			t.Errorf("%s: want ID %s got %s", c.Name(), w, g)
+		}
+		if w, g := c.Name(), dc.Name(); w != g {
+			t.Errorf("want codec %s got %s", w, g)
+		}
+
+		// binary messages are always enveloped
+		env.Payload = nil
+		if b, err = codec.Encode(c, env); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, _, _, err := decode(b); err == nil {
+			t.Errorf("%s: want error for missing payload", c.Name())
+		}
+	}
+}
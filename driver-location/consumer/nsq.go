@@ -1,6 +1,10 @@
 package consumer
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	nsq "github.com/nsqio/go-nsq"
 	"github.com/rs/zerolog"
 )
@@ -13,6 +17,8 @@ type NSQConfig struct {
 	LookupdHTTPAddrs []string
 	NsqdTCPAddrs     []string
 	Cfg              *nsq.Config
+	// Sampler samples the logs of handled messages; all are logged if nil
+	Sampler zerolog.Sampler
 }
 
 // NSQ consumes a nsq-channel.
@@ -29,8 +35,16 @@ func NewNSQ(cfg *NSQConfig, handler nsq.Handler, logger zerolog.Logger) (*NSQ, e
 	if err != nil {
 		return nil, err
 	}
+	logger = logger.
+		With().
+		Interface("topic", cfg.Topic).
+		Interface("channel", cfg.Channel).
+		Logger()
 	// todo: set logger on consumer
-	con.AddConcurrentHandlers(handler, cfg.NumPublishers)
+	con.AddConcurrentHandlers(&logHandler{
+		h:      handler,
+		logger: logger.Sample(cfg.Sampler),
+	}, cfg.NumPublishers)
 	err = con.ConnectToNSQDs(cfg.NsqdTCPAddrs)
 	if err != nil {
 		return nil, err
@@ -39,11 +53,6 @@ func NewNSQ(cfg *NSQConfig, handler nsq.Handler, logger zerolog.Logger) (*NSQ, e
 	if err != nil {
 		return nil, err
 	}
-	logger = logger.
-		With().
-		Interface("topic", cfg.Topic).
-		Interface("channel", cfg.Channel).
-		Logger()
 	return &NSQ{
 		c:      con,
 		cfg:    cfg,
@@ -51,14 +60,49 @@ func NewNSQ(cfg *NSQConfig, handler nsq.Handler, logger zerolog.Logger) (*NSQ, e
 	}, nil
 }
 
+// logHandler logs the messages handled by h. Successfully handled messages
+// are logged at debug level, failures at error level.
+type logHandler struct {
+	h      nsq.Handler
+	logger zerolog.Logger
+}
+
+func (h *logHandler) HandleMessage(m *nsq.Message) error {
+	start := time.Now()
+	err := h.h.HandleMessage(m)
+	e := h.logger.Debug()
+	if err != nil {
+		e = h.logger.Error().Err(err)
+	}
+	e.Str("msg_id", string(m.ID[:])).
+		Uint16("attempts", m.Attempts).
+		Dur("duration", time.Since(start)).
+		Msg("message handled")
+	return err
+}
+
+// errNoConnections is returned by Check if the consumer is not connected to
+// any nsqd.
+var errNoConnections = errors.New("no nsqd connections")
+
+// Check returns an error if the consumer of n has no connections to nsqd.
+func (n *NSQ) Check(ctx context.Context) error {
+	if n.c.Stats().Connections == 0 {
+		return errNoConnections
+	}
+	return nil
+}
+
 // Run waits for the consumer of n to stop.
-func (n *NSQ) Run() {
+func (n *NSQ) Run() error {
 	n.logger.Info().Msg("running nsq consumer")
 	<-n.c.StopChan
+	return nil
 }
 
-// Shutdown stops the consumer of n.
-func (n *NSQ) Shutdown() {
+// Shutdown stops the consumer of n. In-flight messages are handled before the
+// consumer stops, which Run waits for.
+func (n *NSQ) Shutdown(ctx context.Context) {
 	for _, addr := range n.cfg.NsqdTCPAddrs {
 		err := n.c.DisconnectFromNSQD(addr)
 		if err != nil {
@@ -2,6 +2,7 @@ package consumer
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -88,7 +89,7 @@ func TestNSQ(t *testing.T) {
 	go func() {
 		for range ticker.C {
 			if int(atomic.LoadUint32(&h.received)) == msgCount {
-				consumer.Shutdown()
+				consumer.Shutdown(context.Background())
 				ticker.Stop()
 				return
 			}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/httpserver"
 	"github.com/rs/zerolog"
 )
 
@@ -13,27 +15,27 @@ type HTTPServer struct {
 	logger zerolog.Logger
 }
 
-// New returns an HTTPServer instance with a locationHandler.
-func New(httpAddr string, rf RangeFetcher, logger zerolog.Logger) (*HTTPServer, error) {
-	router, err := newLocationHandler(rf, logger)
+// New returns an HTTPServer instance with a locationHandler, which is
+// configured by srvCfg. The readiness of the server is reported by hc.
+func New(httpAddr string, srvCfg httpserver.Config, s Store, hc *health.Health, logger zerolog.Logger) (*HTTPServer, error) {
+	router, err := newLocationHandler(s, hc, srvCfg.AccessLogSampler, logger)
 	if err != nil {
 		return nil, err
 	}
-	server := &http.Server{
-		Addr:    httpAddr,
-		Handler: router,
-	}
+	server := httpserver.New(httpAddr, router, srvCfg)
 	return &HTTPServer{
 		server: server,
 		logger: logger,
 	}, nil
 }
 
-func (s *HTTPServer) Run() {
+// Run serves http requests until s is shut down.
+func (s *HTTPServer) Run() error {
 	s.logger.Info().Msgf("http server listening on %s", s.server.Addr)
-	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
-		s.logger.Fatal().Err(err).Msg("http server exited with error")
+	if err := httpserver.ListenAndServe(s.server); err != http.ErrServerClosed {
+		return err
 	}
+	return nil
 }
 
 func (s *HTTPServer) Shutdown(ctx context.Context) {
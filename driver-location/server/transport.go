@@ -1,14 +1,17 @@
 package server
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/afex/hystrix-go/hystrix"
 	"github.com/gorilla/mux"
+	"github.com/heetch/FabianG-technical-test/codec"
 	"github.com/heetch/FabianG-technical-test/handler"
+	"github.com/heetch/FabianG-technical-test/health"
 	"github.com/heetch/FabianG-technical-test/middleware"
 	"github.com/heetch/FabianG-technical-test/types"
 	"github.com/prometheus/client_golang/prometheus"
@@ -22,25 +25,48 @@ var (
 			Help:    "histogram of response times for driver-location http handler",
 			Buckets: prometheus.ExponentialBuckets(0.5e-3, 2, 14), // 0.5ms to 4s
 		},
-		[]string{"path", "status_code"},
+		[]string{"path", "method", "status_code"},
+	)
+	requestsInFlightGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "driver_location_requests_in_flight",
+			Help: "number of requests being handled by driver-location http handler",
+		},
+		[]string{"path", "method"},
+	)
+	responseCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "driver_location_responses_total",
+			Help: "number of responses of driver-location http handler",
+		},
+		[]string{"path", "method", "status_code"},
 	)
 )
 
 func init() {
 	prometheus.MustRegister(responseTimeHistogram)
+	prometheus.MustRegister(requestsInFlightGauge)
+	prometheus.MustRegister(responseCounter)
 }
 
-func newLocationHandler(rf RangeFetcher, logger zerolog.Logger) (http.Handler, error) {
+func newLocationHandler(s Store, hc *health.Health, sampler zerolog.Sampler, logger zerolog.Logger) (http.Handler, error) {
 	var mw []middleware.Middleware
 	mw = append(mw, middleware.NewRecoverHandler())
-	mw = append(mw, middleware.NewContextLog(logger)...)
-	mc := middleware.NewMetricsConfig().WithTimeHist(responseTimeHistogram)
+	mw = append(mw, middleware.NewTracing())
+	mw = append(mw, middleware.NewContextLog(logger, sampler)...)
+	mc := middleware.NewMetricsConfig().
+		WithGauge(requestsInFlightGauge).
+		WithCounter(responseCounter).
+		WithTimeHist(responseTimeHistogram)
 	mw = append(mw, middleware.NewMetricsHandler(mc))
 
-	lh := &locationHandler{rf}
+	lh := &locationHandler{s}
+	ah := &activeHandler{s}
 	router := mux.NewRouter()
 	router.Handle("/drivers/{id:[0-9]+}/locations", middleware.Use(lh, mw...)).Methods("GET").Queries("minutes", "{minutes}")
-	router.Handle("/ready", &handler.ReadinessHandler{})
+	router.Handle("/drivers", middleware.Use(ah, mw...)).Methods("GET").Queries("minutes", "{minutes}")
+	router.Handle("/live", hc.Live())
+	router.Handle("/ready", hc)
 	return router, nil
 }
 
@@ -51,6 +77,18 @@ type RangeFetcher interface {
 	FetchRange(key string, min, max int64) ([]string, error)
 }
 
+// ActiveFetcher provides a method to fetch the IDs of all drivers that sent a
+// location update between min and max (including updates at min or max).
+type ActiveFetcher interface {
+	FetchActive(min, max int64) ([]string, error)
+}
+
+// Store combines the lookups required by the http handlers.
+type Store interface {
+	RangeFetcher
+	ActiveFetcher
+}
+
 // locationHandler respondes to driver location requests.
 type locationHandler struct {
 	RangeFetcher
@@ -67,23 +105,62 @@ func (l *locationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	min := t.Add(-1 * time.Duration(minutes) * time.Minute).UnixNano()
 
 	var locations []string
-	if err := hystrix.Do("fetch_redis", func() error { // circuit-breaker
+	// the command gives up once the request exceeds its deadline
+	if err := hystrix.DoC(r.Context(), "fetch_redis", func(context.Context) error { // circuit-breaker
 		locations, err = l.FetchRange(id, min, t.UnixNano())
 		return err
 	}, nil); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			handler.WriteError(w, r, handler.ErrTimeout, http.StatusServiceUnavailable)
+			return
+		}
 		handler.WriteError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
+	// locations may be stored by different codecs during a migration
 	var locs []types.LocationUpdate
 	for _, s := range locations {
 		var l types.LocationUpdate
-		err = json.Unmarshal([]byte(s), &l)
+		err = codec.Decode([]byte(s), &l)
 		if err != nil {
 			handler.WriteError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 		locs = append(locs, l)
 	}
-	handler.EncodeJSON(w, r, locs, 200)
+	handler.Encode(w, r, locs, 200)
+}
+
+// activeHandler responds to requests for drivers that recently sent location
+// updates.
+type activeHandler struct {
+	ActiveFetcher
+}
+
+// ServeHTTP responds with the IDs of all drivers which sent a location update
+// within the last `minutes`.
+func (a *activeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	minutes, err := strconv.Atoi(r.FormValue("minutes"))
+	if err != nil {
+		handler.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	t := time.Now()
+	min := t.Add(-1 * time.Duration(minutes) * time.Minute).UnixNano()
+
+	var ids []string
+	// the command gives up once the request exceeds its deadline
+	if err := hystrix.DoC(r.Context(), "fetch_redis", func(context.Context) error { // circuit-breaker
+		ids, err = a.FetchActive(min, t.UnixNano())
+		return err
+	}, nil); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			handler.WriteError(w, r, handler.ErrTimeout, http.StatusServiceUnavailable)
+			return
+		}
+		handler.WriteError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	handler.Encode(w, r, ids, http.StatusOK)
 }
@@ -1,15 +1,22 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/heetch/FabianG-technical-test/codec"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/middleware"
 	"github.com/heetch/FabianG-technical-test/testdata"
+	"github.com/heetch/FabianG-technical-test/types"
 	"github.com/rs/zerolog"
 )
 
@@ -21,6 +28,11 @@ func (r *redisTestClient) FetchRange(key string, min, max int64) ([]string, erro
 	return locationTests[key][mins].l, locationTests[key][mins].e
 }
 
+func (r *redisTestClient) FetchActive(min, max int64) ([]string, error) {
+	mins := (max - min) / 60 / 1000000000 // minutes
+	return activeTests[mins].l, activeTests[mins].e
+}
+
 // location/error by driver ID and minutes
 var locationTests = map[string]map[int64]struct {
 	l []string // input locations
@@ -101,7 +113,7 @@ func TestServeHTTP(t *testing.T) {
 	log.SetOutput(logger)
 
 	// handler to test
-	h, err := newLocationHandler(&redisTestClient{}, logger)
+	h, err := newLocationHandler(&redisTestClient{}, health.New(time.Second, time.Second), nil, logger)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -142,3 +154,155 @@ func TestServeHTTP(t *testing.T) {
 		}
 	})
 }
+
+// active drivers by minutes
+var activeTests = map[int64]struct {
+	l []string // driver IDs returned by redis
+	d string   // description of test case
+	p string   // request path
+	r string   // expected response data
+	e error    // expected error
+	s int      // expected response status code
+}{
+	1: {
+		l: []string{},
+		d: "expect empty list of active drivers",
+		p: "/drivers?minutes=1",
+		r: "[]",
+		s: http.StatusOK,
+	},
+	2: {
+		l: []string{"1", "2", "3"},
+		d: "expect list of active drivers",
+		p: "/drivers?minutes=2",
+		r: `["1","2","3"]`,
+		s: http.StatusOK,
+	},
+	3: {
+		d: "expect error in redis lookup of active drivers",
+		p: "/drivers?minutes=3",
+		r: `{"error":"internal_error"}`,
+		e: errors.New("redis_test_error"),
+		s: http.StatusInternalServerError,
+	},
+	4: {
+		d: "expect StatusBadRequest for invalid minutes",
+		p: "/drivers?minutes=foo",
+		r: `{"error":"bad_request"}`,
+		s: http.StatusBadRequest,
+	},
+}
+
+func TestActiveHandler(t *testing.T) {
+	// mute logger
+	logger := zerolog.New(ioutil.Discard)
+	log.SetFlags(0)
+	log.SetOutput(logger)
+
+	h, err := newLocationHandler(&redisTestClient{}, health.New(time.Second, time.Second), nil, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	locationService := httptest.NewServer(h)
+	defer locationService.Close()
+	locationClient := locationService.Client()
+
+	for _, tt := range activeTests {
+		res, err := locationClient.Get(locationService.URL + tt.p)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.d, err)
+		}
+		if w, g := tt.s, res.StatusCode; w != g {
+			t.Errorf("%s: want status code %d got %d", tt.d, w, g)
+		}
+		data, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: failed to read response %v", tt.d, err)
+		}
+		if w, g := tt.r, strings.TrimSpace(string(data)); w != g {
+			t.Errorf("%s: want response\n%s\ngot\n%s", tt.d, w, g)
+		}
+	}
+}
+
+// negotiation tests by Accept header
+var negotiationTests = []struct {
+	a string // Accept header
+	c string // expected content type
+}{
+	{a: "", c: "application/json"},
+	{a: "application/json", c: "application/json"},
+	{a: "application/x-protobuf", c: "application/x-protobuf"},
+	{a: "application/msgpack", c: "application/msgpack"},
+	{a: codec.Accept, c: "application/x-protobuf"},
+}
+
+func TestNegotiation(t *testing.T) {
+	logger := zerolog.New(ioutil.Discard)
+	h, err := newLocationHandler(&redisTestClient{}, health.New(time.Second, time.Second), nil, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tt := locationTests["1"][1]
+	for _, n := range negotiationTests {
+		r := httptest.NewRequest("GET", tt.p, nil)
+		r.Header.Set("Accept", n.a)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w, g := http.StatusOK, w.Code; w != g {
+			t.Fatalf("%q: want status code %d got %d", n.a, w, g)
+		}
+		if w, g := n.c, w.Header().Get("Content-Type"); w != g {
+			t.Errorf("%q: want content type %s got %s", n.a, w, g)
+		}
+		if w, g := "Accept", w.Header().Get("Vary"); w != g {
+			t.Errorf("%q: want Vary %s got %s", n.a, w, g)
+		}
+
+		// responses of all codecs are equal
+		var want, got []types.LocationUpdate
+		if err := json.Unmarshal([]byte(tt.r), &want); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := codec.ByContentType(n.c).Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%q: unexpected error: %v", n.a, err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%q: want %+v got %+v", n.a, want, got)
+		}
+	}
+}
+
+// slowStore responds after d
+type slowStore struct {
+	d time.Duration
+}
+
+func (s slowStore) FetchRange(key string, min, max int64) ([]string, error) {
+	time.Sleep(s.d)
+	return nil, nil
+}
+
+func (s slowStore) FetchActive(min, max int64) ([]string, error) {
+	time.Sleep(s.d)
+	return nil, nil
+}
+
+func TestTimeout(t *testing.T) {
+	h, err := newLocationHandler(slowStore{d: 200 * time.Millisecond}, health.New(time.Second, time.Second), nil, zerolog.New(ioutil.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h = middleware.NewTimeout(10 * time.Millisecond)(h)
+	for _, p := range []string{"/drivers/1/locations?minutes=1", "/drivers?minutes=1"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+		if w, g := http.StatusServiceUnavailable, w.Code; w != g {
+			t.Errorf("%s: want status code %d got %d", p, w, g)
+		}
+		if w, g := `{"error":"timeout"}`, strings.TrimSpace(w.Body.String()); w != g {
+			t.Errorf("%s: want response %s got %s", p, w, g)
+		}
+	}
+}
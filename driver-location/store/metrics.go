@@ -0,0 +1,114 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics of the store must not be labeled by driver IDs since the number of
+// drivers is unbounded.
+var (
+	redisCmdCounter = prom.NewCounterVec(prom.CounterOpts{
+		Name: "redis_commands_total",
+		Help: "counts the redis commands executed by command and status"},
+		[]string{"cmd", "status"})
+	redisCmdDuration = prom.NewHistogramVec(prom.HistogramOpts{
+		Name:    "redis_command_duration_seconds",
+		Help:    "histogram of durations of redis commands by command",
+		Buckets: prom.ExponentialBuckets(0.1e-3, 2, 14), // 0.1ms to 0.8s
+	},
+		[]string{"cmd"})
+	fetchRangeSize = prom.NewHistogram(prom.HistogramOpts{
+		Name:    "redis_fetch_range_size",
+		Help:    "histogram of the number of location updates returned by FetchRange",
+		Buckets: prom.ExponentialBuckets(1, 2, 12), // 1 to 2048
+	})
+
+	poolHitsDesc = prom.NewDesc(
+		"redis_pool_hits_total",
+		"number of times a free connection was found in the pool", nil, nil)
+	poolMissesDesc = prom.NewDesc(
+		"redis_pool_misses_total",
+		"number of times a free connection was not found in the pool", nil, nil)
+	poolTimeoutsDesc = prom.NewDesc(
+		"redis_pool_timeouts_total",
+		"number of times a wait timeout occurred", nil, nil)
+	poolStaleConnsDesc = prom.NewDesc(
+		"redis_pool_stale_conns_total",
+		"number of stale connections removed from the pool", nil, nil)
+	poolTotalConnsDesc = prom.NewDesc(
+		"redis_pool_conns",
+		"number of connections in the pool", nil, nil)
+	poolIdleConnsDesc = prom.NewDesc(
+		"redis_pool_idle_conns",
+		"number of idle connections in the pool", nil, nil)
+)
+
+func init() {
+	prom.MustRegister(redisCmdCounter)
+	prom.MustRegister(redisCmdDuration)
+	prom.MustRegister(fetchRangeSize)
+	prom.MustRegister(pools)
+}
+
+// observe counts the redis command cmd by the status of err and records the
+// duration since start.
+func observe(cmd string, start time.Time, err error) {
+	status := "ok"
+	if err != nil && err != redis.Nil {
+		status = "error"
+	}
+	redisCmdCounter.WithLabelValues(cmd, status).Inc()
+	redisCmdDuration.WithLabelValues(cmd).Observe(time.Since(start).Seconds())
+}
+
+// pools exports the stats of the connection pools of all clients created by
+// NewRedis.
+var pools = &poolCollector{}
+
+// poolCollector collects the summed pool stats of its clients on scrape.
+type poolCollector struct {
+	mu      sync.Mutex
+	clients []*redis.Client
+}
+
+func (p *poolCollector) add(c *redis.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clients = append(p.clients, c)
+}
+
+// Describe implements prometheus.Collector.
+func (p *poolCollector) Describe(ch chan<- *prom.Desc) {
+	ch <- poolHitsDesc
+	ch <- poolMissesDesc
+	ch <- poolTimeoutsDesc
+	ch <- poolStaleConnsDesc
+	ch <- poolTotalConnsDesc
+	ch <- poolIdleConnsDesc
+}
+
+// Collect implements prometheus.Collector.
+func (p *poolCollector) Collect(ch chan<- prom.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var sum redis.PoolStats
+	for _, c := range p.clients {
+		s := c.PoolStats()
+		sum.Hits += s.Hits
+		sum.Misses += s.Misses
+		sum.Timeouts += s.Timeouts
+		sum.StaleConns += s.StaleConns
+		sum.TotalConns += s.TotalConns
+		sum.IdleConns += s.IdleConns
+	}
+	ch <- prom.MustNewConstMetric(poolHitsDesc, prom.CounterValue, float64(sum.Hits))
+	ch <- prom.MustNewConstMetric(poolMissesDesc, prom.CounterValue, float64(sum.Misses))
+	ch <- prom.MustNewConstMetric(poolTimeoutsDesc, prom.CounterValue, float64(sum.Timeouts))
+	ch <- prom.MustNewConstMetric(poolStaleConnsDesc, prom.CounterValue, float64(sum.StaleConns))
+	ch <- prom.MustNewConstMetric(poolTotalConnsDesc, prom.GaugeValue, float64(sum.TotalConns))
+	ch <- prom.MustNewConstMetric(poolIdleConnsDesc, prom.GaugeValue, float64(sum.IdleConns))
+}
@@ -1,33 +1,41 @@
 package store
 
 import (
-	"encoding/json"
+	"context"
 	"strconv"
+	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/heetch/FabianG-technical-test/codec"
 	"github.com/heetch/FabianG-technical-test/types"
-	prom "github.com/prometheus/client_golang/prometheus"
 )
 
-var (
-	redisExcCounter = prom.NewCounterVec(prom.CounterOpts{
-		Name: "redis_commands",
-		Help: "counts the number redis commands executed per driver"},
-		[]string{"cmd", "id"})
-)
-
-func init() {
-	prom.MustRegister(redisExcCounter)
-}
+// activeKey identifies the sorted set which holds the IDs of all drivers that
+// sent location updates. The score of a member is the time of the most recent
+// update of the driver. Note, driver IDs are numeric so they can not collide
+// with the key.
+const activeKey = "drivers:active"
 
 // MiniRedis is an abstraction for unit tests only. I would prefer a little
 // dependency here over too much abstraction. So this should be replaced by a
 // mock-library.
 type MiniRedis interface {
-	// add members to the sorted set stored at key
-	ZAddNX(key string, member redis.Z) error
+	// add member to the sorted set stored at key unless it exists and raise
+	// the score of latest in the sorted set stored at latestKey to the score
+	// of member
+	ZAddNXLatest(key string, member redis.Z, latestKey, latest string) error
+	// remove range from the sorted set stored at key
+	ZRemRangeByScore(key, min, max string) (int64, error)
 	// fetch range from the sorted set stored at key
 	ZRangeByScore(key string, opt redis.ZRangeBy) ([]string, error)
+	// fetch range with scores from the sorted set stored at key
+	ZRangeByScoreWithScores(key string, opt redis.ZRangeBy) ([]redis.Z, error)
+	// iterate the keys matching match
+	Scan(cursor uint64, match string, count int64) ([]string, uint64, error)
+	// atomically replace a member of the sorted set stored at key
+	ZReplace(key string, old string, member redis.Z) error
+	// check the connection
+	Ping() error
 }
 
 // RedisClient represents a pool of zero or more underlying connections.
@@ -36,13 +44,34 @@ type RedisClient struct {
 	c *redis.Client
 }
 
-// ZAddNX adds all the specified members with the specified scores to the sorted
-// set stored at key. It doesn't update already existing elements but always
-// adds new elements.
-func (rc *RedisClient) ZAddNX(key string, member redis.Z) error {
-	// O(log(N)) for each item added, where N is the number of elements in the
+// zaddNXLatest adds ARGV[2] with the score ARGV[1] to the sorted set
+// KEYS[1] unless it exists and sets the score of ARGV[3] in the sorted set
+// KEYS[2] to ARGV[1] unless its score is higher already. Redis before 6.2 has
+// no ZADD GT, hence the script.
+var zaddNXLatest = redis.NewScript(`
+local n = redis.call('ZADD', KEYS[1], 'NX', ARGV[1], ARGV[2])
+local s = redis.call('ZSCORE', KEYS[2], ARGV[3])
+if not s or tonumber(s) < tonumber(ARGV[1]) then
+	redis.call('ZADD', KEYS[2], ARGV[1], ARGV[3])
+end
+return n
+`)
+
+// ZAddNXLatest adds member to the sorted set stored at key unless it exists
+// and raises the score of latest in the sorted set stored at latestKey to the
+// score of member. Both sets are updated atomically in a single round-trip, so
+// an older member never lowers the score of latest.
+func (rc *RedisClient) ZAddNXLatest(key string, member redis.Z, latestKey, latest string) error {
+	// O(log(N)) for each sorted set, where N is the number of elements in the
 	// sorted set.
-	return rc.c.ZAddNX(key, member).Err()
+	score := strconv.FormatFloat(member.Score, 'f', -1, 64)
+	return zaddNXLatest.Run(rc.c, []string{key, latestKey}, score, member.Member, latest).Err()
+}
+
+// ZRemRangeByScore removes all elements in the sorted set stored at key with
+// a score between min and max and returns the number of removed elements.
+func (rc *RedisClient) ZRemRangeByScore(key, min, max string) (int64, error) {
+	return rc.c.ZRemRangeByScore(key, min, max).Result()
 }
 
 // ZRangeByScore returns all the elements in the sorted set at key with a score
@@ -52,24 +81,64 @@ func (rc *RedisClient) ZRangeByScore(key string, opt redis.ZRangeBy) ([]string,
 	return rc.c.ZRangeByScore(key, opt).Result()
 }
 
+// ZRangeByScoreWithScores returns all the elements with their scores in the
+// sorted set at key with a score between min and max.
+func (rc *RedisClient) ZRangeByScoreWithScores(key string, opt redis.ZRangeBy) ([]redis.Z, error) {
+	return rc.c.ZRangeByScoreWithScores(key, opt).Result()
+}
+
+// Scan returns the next batch of keys matching match and the cursor of the
+// batch after it; the iteration is complete when the cursor is 0. Keys may
+// be returned more than once.
+func (rc *RedisClient) Scan(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	return rc.c.Scan(cursor, match, count).Result()
+}
+
+// ZReplace removes old from the sorted set stored at key and adds member in a
+// transaction.
+func (rc *RedisClient) ZReplace(key string, old string, member redis.Z) error {
+	_, err := rc.c.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.ZRem(key, old)
+		pipe.ZAdd(key, member)
+		return nil
+	})
+	return err
+}
+
+// Ping checks the connection to the redis server.
+func (rc *RedisClient) Ping() error {
+	return rc.c.Ping().Err()
+}
+
 // Redis provides limited functionality to publish and fetch LocationUpdates.
+// LocationUpdates are stored encoded by codec.Encode, so members of different
+// codecs can be read by codec.Decode.
 type Redis struct {
 	MiniRedis
+	Codec codec.Codec // encodes published LocationUpdates; defaults to JSON
 }
 
-// NewRedis returns a wrapper around a redis Client instance.
-func NewRedis(addr string) *Redis {
+// NewRedis returns a wrapper around a redis Client instance which encodes
+// LocationUpdates by c.
+func NewRedis(addr string, c codec.Codec) *Redis {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	pools.add(client)
 	return &Redis{
-		&RedisClient{
-			c: redis.NewClient(&redis.Options{Addr: addr}),
-		},
+		MiniRedis: &RedisClient{c: client},
+		Codec:     c,
 	}
 }
 
-// Publish publishes a JSON string representation of a LocationUpdate to the
-// sorted set stored at key.
+func (r *Redis) codec() codec.Codec {
+	if r.Codec == nil {
+		return codec.JSON
+	}
+	return r.Codec
+}
+
+// Publish publishes an encoded LocationUpdate to the sorted set stored at key.
 func (r *Redis) Publish(timestamp int64, key string, l types.LocationUpdate) error {
-	value, err := json.Marshal(l)
+	value, err := codec.Encode(r.codec(), l)
 	if err != nil {
 		return err
 	}
@@ -78,13 +147,11 @@ func (r *Redis) Publish(timestamp int64, key string, l types.LocationUpdate) err
 		Member: string(value),
 	}
 
-	lb := prom.Labels{
-		"cmd": "pub",
-		"id":  key,
-	}
-	redisExcCounter.With(lb).Inc()
-
-	return r.ZAddNX(key, member)
+	// keep track of the last update of the driver
+	start := time.Now()
+	err = r.ZAddNXLatest(key, member, activeKey, key)
+	observe("publish", start, err)
+	return err
 }
 
 // FetchRange returns all the elements in the sorted set at key with a score
@@ -95,11 +162,117 @@ func (r *Redis) FetchRange(key string, min, max int64) ([]string, error) {
 		Max: strconv.FormatInt(max, 10),
 	}
 
-	lb := prom.Labels{
-		"cmd": "fetch",
-		"id":  key,
+	start := time.Now()
+	res, err := r.ZRangeByScore(key, opt)
+	observe("zrangebyscore", start, err)
+	if err == nil {
+		fetchRangeSize.Observe(float64(len(res)))
 	}
-	redisExcCounter.With(lb).Inc()
+	return res, err
+}
+
+// FetchActive returns the IDs of all drivers which published a location update
+// between min and max (including updates with timestamp equal to min or max).
+func (r *Redis) FetchActive(min, max int64) ([]string, error) {
+	opt := redis.ZRangeBy{
+		Min: strconv.FormatInt(min, 10),
+		Max: strconv.FormatInt(max, 10),
+	}
+
+	start := time.Now()
+	res, err := r.ZRangeByScore(activeKey, opt)
+	observe("zrangebyscore", start, err)
+	return res, err
+}
 
-	return r.ZRangeByScore(key, opt)
+// TrimActive removes the drivers whose last location update was published
+// before max from the set of active drivers and returns their number. Their
+// location updates are kept.
+func (r *Redis) TrimActive(max int64) (int64, error) {
+	start := time.Now()
+	n, err := r.ZRemRangeByScore(activeKey, "-inf", "("+strconv.FormatInt(max, 10))
+	observe("zremrangebyscore", start, err)
+	return n, err
+}
+
+// all is the range of all scores.
+var all = redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+
+// scanCount is the number of keys requested per SCAN by Migrate.
+const scanCount = 1000
+
+// Migrate re-encodes the LocationUpdates of all drivers stored by other codecs
+// than the codec of r. The keys of drivers are found by SCAN, so drivers
+// missing from the set of active drivers are migrated too. Members are
+// replaced atomically, so readers see either encoding. Members which can not
+// be decoded are skipped. Migrate returns the number of migrated and skipped
+// members; it stops early if ctx is done.
+func (r *Redis) Migrate(ctx context.Context) (migrated, skipped int, err error) {
+	var cursor uint64
+	for {
+		var keys []string
+		start := time.Now()
+		keys, cursor, err = r.Scan(cursor, "[0-9]*", scanCount)
+		observe("scan", start, err)
+		if err != nil {
+			return migrated, skipped, err
+		}
+		m, s, err := r.migrate(ctx, keys)
+		migrated, skipped = migrated+m, skipped+s
+		if err != nil || cursor == 0 {
+			return migrated, skipped, err
+		}
+	}
+}
+
+// migrate re-encodes the LocationUpdates of the drivers stored at keys; keys
+// which are no driver IDs are ignored.
+func (r *Redis) migrate(ctx context.Context, keys []string) (migrated, skipped int, err error) {
+	c := r.codec()
+	for _, id := range keys {
+		if err := ctx.Err(); err != nil {
+			return migrated, skipped, err
+		}
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			continue
+		}
+		start := time.Now()
+		members, err := r.ZRangeByScoreWithScores(id, all)
+		observe("zrangebyscore", start, err)
+		if err != nil {
+			return migrated, skipped, err
+		}
+		for _, m := range members {
+			old, ok := m.Member.(string)
+			if !ok {
+				skipped++
+				continue
+			}
+			from, data, err := codec.Detect([]byte(old))
+			if err != nil {
+				skipped++
+				continue
+			}
+			if from.Name() == c.Name() {
+				continue
+			}
+			var l types.LocationUpdate
+			if err := from.Unmarshal(data, &l); err != nil {
+				skipped++
+				continue
+			}
+			value, err := codec.Encode(c, l)
+			if err != nil {
+				return migrated, skipped, err
+			}
+			start := time.Now()
+			err = r.ZReplace(id, old, redis.Z{Score: m.Score, Member: string(value)})
+			observe("zreplace", start, err)
+			if err != nil {
+				return migrated, skipped, err
+			}
+			migrated++
+		}
+	}
+	return migrated, skipped, nil
 }
@@ -1,11 +1,18 @@
 package store
 
 import (
+	"context"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/go-redis/redis"
+	"github.com/heetch/FabianG-technical-test/codec"
 	"github.com/heetch/FabianG-technical-test/types"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 // publish tests by driver-ID
@@ -76,21 +83,57 @@ var rangeTests = map[string]struct {
 	},
 }
 
+// active drivers test
+var activeTest = struct {
+	d   string         // test case description
+	min int64          // input min score
+	max int64          // input max score
+	z   redis.ZRangeBy // expected range
+}{
+	d:   "expect active drivers range",
+	min: 1257894000,
+	max: 1257895000,
+	z: redis.ZRangeBy{
+		Min: "1257894000",
+		Max: "1257895000",
+	},
+}
+
 type testRedis struct {
 	t *testing.T
 }
 
-func (r *testRedis) ZAddNX(key string, member redis.Z) error {
+func (r *testRedis) ZAddNXLatest(key string, member redis.Z, latestKey, latest string) error {
 	if w, g := publishTests[key].k, key; w != g {
 		r.t.Errorf("%s: want %s got %s", publishTests[key].d, w, g)
 	}
 	if w, g := publishTests[key].m, member; !reflect.DeepEqual(w, g) {
 		r.t.Errorf("%s: want %+v got %+v", publishTests[key].d, w, g)
 	}
+	if w, g := activeKey, latestKey; w != g {
+		r.t.Errorf("want active key %s got %s", w, g)
+	}
+	if w, g := key, latest; w != g {
+		r.t.Errorf("%s: want active driver %s got %s", publishTests[key].d, w, g)
+	}
+	return nil
+}
+
+func (r *testRedis) ZRemRangeByScore(key, min, max string) (int64, error) {
+	return 0, nil
+}
+
+func (r *testRedis) Ping() error {
 	return nil
 }
 
 func (r *testRedis) ZRangeByScore(key string, opt redis.ZRangeBy) ([]string, error) {
+	if key == activeKey {
+		if w, g := activeTest.z, opt; !reflect.DeepEqual(w, g) {
+			r.t.Errorf("%s: want %+v got %+v", activeTest.d, w, g)
+		}
+		return nil, nil
+	}
 	if w, g := rangeTests[key].k, key; w != g {
 		r.t.Errorf("%s: want %s got %s", publishTests[key].d, w, g)
 	}
@@ -100,9 +143,21 @@ func (r *testRedis) ZRangeByScore(key string, opt redis.ZRangeBy) ([]string, err
 	return nil, nil
 }
 
+func (r *testRedis) ZRangeByScoreWithScores(key string, opt redis.ZRangeBy) ([]redis.Z, error) {
+	return nil, nil
+}
+
+func (r *testRedis) Scan(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	return nil, 0, nil
+}
+
+func (r *testRedis) ZReplace(key string, old string, member redis.Z) error {
+	return nil
+}
+
 func TestPublish(t *testing.T) {
 	r := Redis{
-		&testRedis{t: t},
+		MiniRedis: &testRedis{t: t},
 	}
 	for k, tt := range publishTests {
 		err := r.Publish(tt.t, k, tt.l)
@@ -114,7 +169,7 @@ func TestPublish(t *testing.T) {
 
 func TestFetchRange(t *testing.T) {
 	r := Redis{
-		&testRedis{t: t},
+		MiniRedis: &testRedis{t: t},
 	}
 	for k, tt := range rangeTests {
 		_, err := r.FetchRange(k, tt.min, tt.max)
@@ -123,3 +178,241 @@ func TestFetchRange(t *testing.T) {
 		}
 	}
 }
+
+func TestFetchActive(t *testing.T) {
+	r := Redis{
+		MiniRedis: &testRedis{t: t},
+	}
+	_, err := r.FetchActive(activeTest.min, activeTest.max)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	r := Redis{
+		MiniRedis: &testRedis{t: t},
+	}
+	pub := testutil.ToFloat64(redisCmdCounter.WithLabelValues("publish", "ok"))
+	fetch := testutil.ToFloat64(redisCmdCounter.WithLabelValues("zrangebyscore", "ok"))
+	for k, tt := range publishTests {
+		if err := r.Publish(tt.t, k, tt.l); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for k, tt := range rangeTests {
+		if _, err := r.FetchRange(k, tt.min, tt.max); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if w, g := float64(len(publishTests)), testutil.ToFloat64(redisCmdCounter.WithLabelValues("publish", "ok"))-pub; w != g {
+		t.Errorf("want %v publish commands got %v", w, g)
+	}
+	if w, g := float64(len(rangeTests)), testutil.ToFloat64(redisCmdCounter.WithLabelValues("zrangebyscore", "ok"))-fetch; w != g {
+		t.Errorf("want %v zrangebyscore commands got %v", w, g)
+	}
+
+	// series are labeled by command and status only
+	reg := prom.NewRegistry()
+	reg.MustRegister(redisCmdCounter, fetchRangeSize, pools)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "redis_fetch_range_size" {
+			if g := mf.GetMetric()[0].GetHistogram().GetSampleCount(); g < uint64(len(rangeTests)) {
+				t.Errorf("want at least %d fetch range sizes got %d", len(rangeTests), g)
+			}
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() != "cmd" && l.GetName() != "status" {
+					t.Errorf("%s: unexpected label %s", mf.GetName(), l.GetName())
+				}
+			}
+		}
+	}
+}
+
+// memRedis is an in-memory MiniRedis of sorted sets by key.
+type memRedis map[string]map[string]float64
+
+func (r memRedis) ZAddNXLatest(key string, member redis.Z, latestKey, latest string) error {
+	if _, ok := r[key][member.Member.(string)]; !ok {
+		r.ZAdd(key, member)
+	}
+	if s, ok := r[latestKey][latest]; !ok || s < member.Score {
+		r.ZAdd(latestKey, redis.Z{Score: member.Score, Member: latest})
+	}
+	return nil
+}
+
+func (r memRedis) ZRemRangeByScore(key, min, max string) (int64, error) {
+	// only exclusive max of integer scores
+	m, err := strconv.ParseFloat(strings.TrimPrefix(max, "("), 64)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for member, s := range r[key] {
+		if s < m {
+			delete(r[key], member)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r memRedis) ZAdd(key string, member redis.Z) error {
+	if r[key] == nil {
+		r[key] = make(map[string]float64)
+	}
+	r[key][member.Member.(string)] = member.Score
+	return nil
+}
+
+func (r memRedis) ZRangeByScore(key string, opt redis.ZRangeBy) ([]string, error) {
+	var res []string
+	for m := range r[key] {
+		res = append(res, m)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (r memRedis) ZRangeByScoreWithScores(key string, opt redis.ZRangeBy) ([]redis.Z, error) {
+	var res []redis.Z
+	for m, s := range r[key] {
+		res = append(res, redis.Z{Score: s, Member: m})
+	}
+	return res, nil
+}
+
+// Scan returns one key per call and ignores match.
+func (r memRedis) Scan(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	var keys []string
+	for k := range r {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if int(cursor) >= len(keys) {
+		return nil, 0, nil
+	}
+	next := cursor + 1
+	if int(next) == len(keys) {
+		next = 0
+	}
+	return keys[cursor : cursor+1], next, nil
+}
+
+func (r memRedis) ZReplace(key string, old string, member redis.Z) error {
+	delete(r[key], old)
+	return r.ZAdd(key, member)
+}
+
+func (r memRedis) Ping() error {
+	return nil
+}
+
+func TestMigrate(t *testing.T) {
+	mem := make(memRedis)
+	// existing members are JSON encoded
+	for k, tt := range publishTests {
+		r := Redis{MiniRedis: mem}
+		if err := r.Publish(tt.t, k, tt.l); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	mem.ZAdd("0", redis.Z{Score: 1, Member: "{invalid"})
+	// drivers published before the set of active drivers existed
+	legacy := publishTests["1"]
+	legacy.d, legacy.k = "expect driver missing from active drivers", "2"
+	mem.ZAdd(legacy.k, legacy.m)
+
+	r := Redis{MiniRedis: mem, Codec: codec.Protobuf}
+	// members of different codecs are read alike
+	if err := r.Publish(1257896000, "0", publishTests["1"].l); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	migrated, skipped, err := r.Migrate(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, g := len(publishTests)+1, migrated; w != g {
+		t.Errorf("want %d migrated members got %d", w, g)
+	}
+	if w, g := 1, skipped; w != g {
+		t.Errorf("want %d skipped members got %d", w, g)
+	}
+	for _, k := range []string{"0", "1", legacy.k} {
+		tt, ok := publishTests[k]
+		if !ok {
+			tt = legacy
+		}
+		var found bool
+		for m, s := range mem[k] {
+			if m == "{invalid" {
+				continue
+			}
+			if c, _, _ := codec.Detect([]byte(m)); c.Name() != codec.NameProtobuf {
+				t.Errorf("%s: want protobuf member got %s", tt.d, c.Name())
+			}
+			var l types.LocationUpdate
+			if err := codec.Decode([]byte(m), &l); err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.d, err)
+			}
+			found = found || s == tt.m.Score && reflect.DeepEqual(tt.l, l)
+		}
+		if !found {
+			t.Errorf("%s: want migrated member %+v", tt.d, tt.l)
+		}
+	}
+
+	// migration is idempotent
+	if migrated, _, _ := r.Migrate(context.Background()); migrated != 0 {
+		t.Errorf("want no migrated members got %d", migrated)
+	}
+}
+
+func TestActive(t *testing.T) {
+	mem := make(memRedis)
+	r := Redis{MiniRedis: mem}
+	for _, tt := range []struct {
+		d string // description of test case
+		k string // driver-ID
+		t int64  // timestamp of update
+		w int64  // expected score of driver
+	}{
+		{d: "expect new driver", k: "0", t: 1000, w: 1000},
+		{d: "expect newer update to raise score", k: "0", t: 2000, w: 2000},
+		{d: "expect older update to keep score", k: "0", t: 1500, w: 2000},
+		{d: "expect other driver", k: "1", t: 3000, w: 3000},
+	} {
+		l := types.LocationUpdate{UpdatedAt: strconv.FormatInt(tt.t, 10)}
+		if err := r.Publish(tt.t, tt.k, l); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.d, err)
+		}
+		if g := mem[activeKey][tt.k]; float64(tt.w) != g {
+			t.Errorf("%s: want score %d got %v", tt.d, tt.w, g)
+		}
+	}
+
+	n, err := r.TrimActive(3000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("want 1 trimmed driver got %d", n)
+	}
+	if _, ok := mem[activeKey]["0"]; ok {
+		t.Error("want driver 0 to be trimmed")
+	}
+	if _, ok := mem[activeKey]["1"]; !ok {
+		t.Error("want driver 1 to be kept")
+	}
+	// location updates are kept
+	if w, g := 3, len(mem["0"]); w != g {
+		t.Errorf("want %d location updates got %d", w, g)
+	}
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Trimmer periodically removes the drivers which did not publish location
+// updates within the retention from the set of active drivers, so that the
+// set does not grow with every driver ever seen.
+type Trimmer struct {
+	store     *Redis
+	retention time.Duration
+	interval  time.Duration
+	done      chan struct{}
+	logger    zerolog.Logger
+}
+
+// NewTrimmer returns a Trimmer of the active drivers of r which trims every
+// minute, or every retention if it is shorter.
+func NewTrimmer(r *Redis, retention time.Duration, logger zerolog.Logger) *Trimmer {
+	interval := time.Minute
+	if retention < interval {
+		interval = retention
+	}
+	return &Trimmer{
+		store:     r,
+		retention: retention,
+		interval:  interval,
+		done:      make(chan struct{}),
+		logger:    logger,
+	}
+}
+
+// Run trims the active drivers until t is shut down.
+func (t *Trimmer) Run() error {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return nil
+		case now := <-ticker.C:
+			t.trim(now)
+		}
+	}
+}
+
+func (t *Trimmer) trim(now time.Time) {
+	n, err := t.store.TrimActive(now.Add(-t.retention).UnixNano())
+	if err != nil {
+		t.logger.Error().Err(err).Msg("could not trim active drivers")
+		return
+	}
+	t.logger.Debug().Int64("trimmed", n).Msg("trimmed active drivers")
+}
+
+func (t *Trimmer) Shutdown(ctx context.Context) {
+	close(t.done)
+}
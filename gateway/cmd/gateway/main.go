@@ -2,26 +2,72 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
+	"time"
 
-	"github.com/afex/hystrix-go/hystrix"
-	"github.com/heetch/FabianG-technical-test/gateway/cmd/gateway/cli"
+	"github.com/heetch/FabianG-technical-test/admin"
+	"github.com/heetch/FabianG-technical-test/breaker"
 	"github.com/heetch/FabianG-technical-test/gateway/config"
 	"github.com/heetch/FabianG-technical-test/gateway/server"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/httpserver"
+	"github.com/heetch/FabianG-technical-test/lifecycle"
+	"github.com/heetch/FabianG-technical-test/logging"
 	"github.com/heetch/FabianG-technical-test/metrics"
+	"github.com/heetch/FabianG-technical-test/tlsconfig"
+	"github.com/heetch/FabianG-technical-test/tracing"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
 var (
 	version = "unkown"
 
-	cfgPath     = kingpin.Flag("cfg-file", "path to config file").Envar("CFG_PATH").Required().String()
-	httpAddr    = kingpin.Flag("http-addr", "address of HTTP server").Envar("HTTP_ADDR").Required().String()
-	metricsAddr = kingpin.Flag("metrics-addr", "address of metrics server").Envar("METRICS_ADDR").Required().String()
-	service     = kingpin.Flag("service", "service name").Envar("SERVICE").Default("gateway").String()
+	cfgPath          = kingpin.Flag("cfg-file", "path to config file").Envar("CFG_PATH").Required().String()
+	httpAddr         = kingpin.Flag("http-addr", "address of HTTP server").Envar("HTTP_ADDR").Required().String()
+	metricsAddr      = kingpin.Flag("metrics-addr", "address of metrics server").Envar("METRICS_ADDR").Required().String()
+	adminAddr        = kingpin.Flag("admin-addr", "address of admin server, e.g. 127.0.0.1:6060; disabled if empty").Envar("ADMIN_ADDR").String()
+	adminAllowRemote = kingpin.Flag("admin-allow-remote", "allow --admin-addr not bound to localhost").Envar("ADMIN_ALLOW_REMOTE").Bool()
+	service          = kingpin.Flag("service", "service name").Envar("SERVICE").Default("gateway").String()
+
+	breakerCfgPath = kingpin.Flag("breaker-cfg-file", "path to circuit-breaker config file").Envar("BREAKER_CFG_PATH").String()
+
+	// rate limits are kept in memory unless a redis instance is given
+	rateLimitRedisAddr = kingpin.Flag("rate-limit-redis-addr", "address of redis instance keeping rate limits").Envar("RATE_LIMIT_REDIS_ADDR").String()
+
+	// http server
+	httpReadHeaderTimeout = kingpin.Flag("http-read-header-timeout", "max duration of reading request headers in ms").Envar("HTTP_READ_HEADER_TIMEOUT").Default("5000").Int()
+	httpReadTimeout       = kingpin.Flag("http-read-timeout", "max duration of reading requests in ms").Envar("HTTP_READ_TIMEOUT").Default("10000").Int()
+	httpWriteTimeout      = kingpin.Flag("http-write-timeout", "max duration of writing responses in ms").Envar("HTTP_WRITE_TIMEOUT").Default("15000").Int()
+	httpIdleTimeout       = kingpin.Flag("http-idle-timeout", "max idle duration of keep-alive connections in ms").Envar("HTTP_IDLE_TIMEOUT").Default("120000").Int()
+	httpMaxHeaderBytes    = kingpin.Flag("http-max-header-bytes", "max size of request headers").Envar("HTTP_MAX_HEADER_BYTES").Default("1048576").Int()
+	requestTimeout        = kingpin.Flag("request-timeout", "deadline of requests in ms").Envar("REQUEST_TIMEOUT").Default("10000").Int()
+
+	// TLS
+	tlsCertFile       = kingpin.Flag("tls-cert-file", "path to TLS certificate; enables TLS of the HTTP server").Envar("TLS_CERT_FILE").String()
+	tlsKeyFile        = kingpin.Flag("tls-key-file", "path to TLS private key").Envar("TLS_KEY_FILE").String()
+	tlsCAFile         = kingpin.Flag("tls-ca-file", "path to CA certificates verifying clients and services; defaults to system CAs").Envar("TLS_CA_FILE").String()
+	tlsClientAuth     = kingpin.Flag("tls-client-auth", "require client certificates signed by the CAs (mutual TLS)").Envar("TLS_CLIENT_AUTH").Bool()
+	tlsMetrics        = kingpin.Flag("tls-metrics", "serve metrics and admin endpoints by TLS").Envar("TLS_METRICS").Bool()
+	tlsReloadInterval = kingpin.Flag("tls-reload-interval", "interval of checking TLS files for changes in ms").Envar("TLS_RELOAD_INTERVAL").Default("10000").Int()
+
+	// logging
+	logFormat       = kingpin.Flag("log-format", "format of logs").Envar("LOG_FORMAT").Default(logging.FormatConsole).Enum(logging.FormatJSON, logging.FormatConsole)
+	logLevel        = kingpin.Flag("log-level", "min level of logs").Envar("LOG_LEVEL").Default("debug").Enum(logging.Levels...)
+	logLevels       = kingpin.Flag("log-levels", "min levels of logs by component, e.g. http=info,nsq=warn").Envar("LOG_LEVELS").String()
+	logSampleAccess = kingpin.Flag("log-sample-access", "log 1 of n requests to the access log; server errors are always logged").Envar("LOG_SAMPLE_ACCESS").Default("1").Uint32()
+
+	// tracing
+	traceExporter     = kingpin.Flag("trace-exporter", "exporter of trace spans").Envar("TRACE_EXPORTER").Default(tracing.ExporterNone).Enum(tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterHTTP)
+	traceCollectorURL = kingpin.Flag("trace-collector-url", "URL of OTLP/HTTP trace collector of http exporter").Envar("TRACE_COLLECTOR_URL").String()
+
+	// health checks
+	healthTTL     = kingpin.Flag("health-ttl", "cache duration of health check results in ms").Envar("HEALTH_TTL").Default("2000").Int()
+	healthTimeout = kingpin.Flag("health-timeout", "timeout of health checks in ms").Envar("HEALTH_TIMEOUT").Default("1000").Int()
+
+	// readiness drain before the shutdown, e.g. while load balancers update
+	drainDelay = kingpin.Flag("drain-delay", "delay of shutdown after the service reports not ready in ms").Envar("DRAIN_DELAY").Default("0").Int()
 
 	// should be greater than prometheus scrape interval (default 30s); decreased in coding challenge
 	shutdownDelay = kingpin.Flag("shutdown-delay", "shutdown delay in ms").Envar("SHUTDOWN_DELAY").Default("5000").Int()
@@ -31,35 +77,118 @@ func main() {
 	kingpin.Version(version)
 	kingpin.Parse()
 
-	// configure circuit-breaker
-	hystrix.ConfigureCommand("publish_nsq", hystrix.CommandConfig{
-		Timeout:               1000, // ms
-		MaxConcurrentRequests: 5000,
-		ErrorPercentThreshold: 25,
+	cfg, err := config.FromFile(*cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *service, err)
+		os.Exit(2)
+	}
+	loggers, err := logging.New(*service, version, logging.Config{
+		Format: *logFormat,
+		Level:  *logLevel,
+		Levels: *logLevels,
 	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *service, err)
+		os.Exit(2)
+	}
+	logger := loggers.Logger()
+	metrics.SetBuildInfo(*service, version)
+	cfg.Producer = *service + "/" + version
+	cfg.RateLimitRedisAddr = *rateLimitRedisAddr
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	go func() {
-		quit := make(chan os.Signal, 1)
-		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	// configure circuit-breakers; settings are reloaded on SIGHUP
+	breakers, err := breaker.NewReloader(*breakerCfgPath, breaker.Config{
+		"publish_nsq": {
+			Timeout:               1000, // ms
+			MaxConcurrentRequests: 5000,
+			ErrorPercentThreshold: 25,
+		},
+	}, loggers.Component("breaker"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *service, err)
+		os.Exit(2)
+	}
+	defer breakers.ReloadOnSignal()()
 
-		<-quit
-		cancel()
-	}()
+	// certificates are reloaded when their files change
+	certs, err := tlsconfig.NewReloader(tlsconfig.Config{
+		CertFile:   *tlsCertFile,
+		KeyFile:    *tlsKeyFile,
+		CAFile:     *tlsCAFile,
+		ClientAuth: *tlsClientAuth,
+	}, loggers.Component("tls"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *service, err)
+		os.Exit(2)
+	}
+	defer certs.Watch(time.Duration(*tlsReloadInterval) * time.Millisecond)()
+	var metricsTLS *tls.Config
+	if *tlsMetrics {
+		if metricsTLS = certs.ServerConfig(); metricsTLS == nil {
+			fmt.Fprintf(os.Stderr, "%s: TLS of metrics requires a certificate\n", *service)
+			os.Exit(2)
+		}
+	}
 
-	cfg, err := config.FromFile(*cfgPath)
+	// spans are exported on a best effort basis; trace context is propagated
+	// regardless of the exporter
+	exp, err := tracing.NewExporter(*traceExporter, *traceCollectorURL, loggers.Component("tracing"))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", *service, err)
 		os.Exit(2)
 	}
-	logger := cli.NewLogger(*service, version)
-	httpSrv, err := server.New(ctx, *httpAddr, cfg, logger)
+	tracing.Init(*service, exp)
+	defer tracing.Shutdown(context.Background())
+
+	hc := health.New(time.Duration(*healthTTL)*time.Millisecond, time.Duration(*healthTimeout)*time.Millisecond)
+	srvCfg := httpserver.Config{
+		ReadHeaderTimeout: time.Duration(*httpReadHeaderTimeout) * time.Millisecond,
+		ReadTimeout:       time.Duration(*httpReadTimeout) * time.Millisecond,
+		WriteTimeout:      time.Duration(*httpWriteTimeout) * time.Millisecond,
+		IdleTimeout:       time.Duration(*httpIdleTimeout) * time.Millisecond,
+		MaxHeaderBytes:    *httpMaxHeaderBytes,
+		RequestTimeout:    time.Duration(*requestTimeout) * time.Millisecond,
+		TLS:               certs.ServerConfig(),
+		AccessLogSampler:  logging.Sampler(*logSampleAccess),
+	}
+	cfg.ClientTLS = certs.ClientConfig()
+	httpSrv, err := server.New(*httpAddr, srvCfg, cfg, hc, loggers.Component("http"))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", *service, err)
 		os.Exit(2)
 	}
 
-	cli.RunServer(ctx, httpSrv, metrics.New(*metricsAddr, logger), *shutdownDelay)
+	// the http server is shut down first, so that its final metrics are
+	// scraped; the nsq producers are stopped once its requests are published
+	lc := lifecycle.New(lifecycle.Config{
+		DrainDelay:      time.Duration(*drainDelay) * time.Millisecond,
+		ShutdownTimeout: time.Duration(*shutdownDelay) * time.Millisecond,
+	}, logger)
+	lc.Register("http", httpSrv)
+	lc.Register("nsq", httpSrv.Producers())
+	lc.Register("metrics", metrics.New(*metricsAddr, metricsTLS, loggers.Component("metrics")))
+	if *adminAddr != "" {
+		adminSrv, err := admin.New(*adminAddr, admin.Config{
+			Service: *service,
+			Version: version,
+			Config: map[string]interface{}{
+				"flags":  admin.Flags(kingpin.CommandLine),
+				"routes": cfg.URLs,
+			},
+			TLS:         metricsTLS,
+			AllowRemote: *adminAllowRemote,
+		}, loggers.Component("admin"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *service, err)
+			os.Exit(2)
+		}
+		// log levels are changed at runtime by PUT /log/level?component=http&level=info
+		adminSrv.Handle("/log/level", loggers)
+		lc.Register("admin", adminSrv)
+	}
+	if err := lc.Run(context.Background()); err != nil {
+		// deferred funcs do not run on exit
+		tracing.Shutdown(context.Background())
+		os.Exit(1)
+	}
 }
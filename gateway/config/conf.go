@@ -2,6 +2,7 @@ package config
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"io"
 	"os"
@@ -22,21 +23,63 @@ func (p protocol) String() string {
 	return [...]string{"_", "NSQ", "HTTP"}[p]
 }
 
+// formats of published messages
+const (
+	FormatLegacy   = "legacy"   // the bare location; JSON only
+	FormatEnvelope = "envelope" // the location wrapped by a types.Envelope
+)
+
 type NSQConf struct {
 	Topic    string   `yaml:"topic"`
 	TCPAddrs []string `yaml:"dest_tcp_addr"`
+	Codec    string   `yaml:"codec"`  // json (default), protobuf or msgpack
+	Format   string   `yaml:"format"` // legacy (default) or envelope
+	TLS      bool     `yaml:"tls"`    // connect to nsqd by TLS
 }
 
 type HTTPConf struct {
 	Host string `yaml:"host"`
+	TLS  bool   `yaml:"tls"` // proxy to https
+}
+
+// RouteAuthConf configures the authentication and authorization of a URL.
+// Requests are not authenticated if no methods are given.
+type RouteAuthConf struct {
+	Methods []string    `yaml:"methods"` // api_key, hmac or jwt
+	Match   []MatchConf `yaml:"match"`
+}
+
+// MatchConf requires the path variable Var to equal the claim Claim of the
+// client, e.g. `{var: id, claim: driver_id}`.
+type MatchConf struct {
+	Var   string `yaml:"var"`
+	Claim string `yaml:"claim"`
+}
+
+// RateLimitConf limits requests of a URL to Rate per second with bursts of
+// up to Burst requests per client. Clients are identified by the path
+// variable Var, their IP or their auth subject, depending on By.
+type RateLimitConf struct {
+	Name  string  `yaml:"name"` // defaults to By
+	By    string  `yaml:"by"`   // var, ip or subject
+	Var   string  `yaml:"var"`
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"` // defaults to 1
 }
 
 // Does not support query params.
 type URL struct {
-	Path   string   `yaml:"path"`
-	Method string   `yaml:"method"`
-	NSQ    NSQConf  `yaml:"nsq"`
-	HTTP   HTTPConf `yaml:"http"`
+	Path       string          `yaml:"path"`
+	Method     string          `yaml:"method"`
+	NSQ        NSQConf         `yaml:"nsq"`
+	HTTP       HTTPConf        `yaml:"http"`
+	Auth       RouteAuthConf   `yaml:"auth"`
+	RateLimits []RateLimitConf `yaml:"rate_limits"`
+	// MaxBodyBytes limits request bodies; defaults to Config.MaxBodyBytes
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// Timeout shortens the deadline of requests in ms; zero keeps the
+	// request timeout of the server
+	Timeout int `yaml:"timeout"`
 }
 
 func (u URL) Protocol() (protocol, error) {
@@ -48,9 +91,58 @@ func (u URL) Protocol() (protocol, error) {
 	return 0, errors.New("URL is missing protocol")
 }
 
+// APIKeyConf is a static API key read from the environment variable KeyEnv.
+// Claims are the claims of its clients, e.g. `{driver_id: "1"}`.
+type APIKeyConf struct {
+	ID     string                 `yaml:"id"`
+	KeyEnv string                 `yaml:"key_env"`
+	Claims map[string]interface{} `yaml:"claims"`
+}
+
+// HMACKeyConf is a shared secret of HMAC signed requests read from the
+// environment variable SecretEnv.
+type HMACKeyConf struct {
+	ID        string                 `yaml:"id"`
+	SecretEnv string                 `yaml:"secret_env"`
+	Claims    map[string]interface{} `yaml:"claims"`
+}
+
+// JWTConf configures the validation of JWTs. Tokens are verified by the keys
+// of the JWKS file JWKSFile.
+type JWTConf struct {
+	JWKSFile string `yaml:"jwks_file"`
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	Leeway   int    `yaml:"leeway"` // seconds
+}
+
+// AuthConf configures the credentials accepted by URLs. Secrets are read from
+// the environment, so that the file can be shared.
+type AuthConf struct {
+	APIKeys     []APIKeyConf  `yaml:"api_keys"`
+	HMACKeys    []HMACKeyConf `yaml:"hmac_keys"`
+	HMACMaxSkew int           `yaml:"hmac_max_skew"` // seconds
+	JWT         JWTConf       `yaml:"jwt"`
+}
+
 // config represents a server configuration read from a YAML file.
 type Config struct {
-	URLs []URL `yaml:"urls"`
+	URLs []URL    `yaml:"urls"`
+	Auth AuthConf `yaml:"auth"`
+	// MaxBodyBytes limits request bodies of URLs which do not set a limit;
+	// defaults to 1 MiB
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// Producer identifies the gateway in published events, e.g.
+	// `gateway/v1.2.0`; set by the service, not by the file.
+	Producer string `yaml:"-"`
+	// RateLimitRedisAddr is the address of the Redis instance keeping rate
+	// limits shared by replicas; limits are kept in memory if empty. Set by
+	// the service.
+	RateLimitRedisAddr string `yaml:"-"`
+	// ClientTLS is the TLS configuration of connections to backends and
+	// nsqd with TLS enabled; nil uses the defaults of crypto/tls. Set by the
+	// service.
+	ClientTLS *tls.Config `yaml:"-"`
 }
 
 // FromFile loads a configuration from file.
@@ -16,6 +16,7 @@ var testURLs = []string{
       topic: "locations"
       dest_tcp_addr:
           - "127.0.0.1:4150"
+      codec: "msgpack"
   -
     path: "/drivers/{id:[0-9]+}"
     method: "GET"
@@ -50,6 +51,7 @@ var cfgtests = []struct {
 					NSQ: NSQConf{
 						Topic:    "locations",
 						TCPAddrs: []string{"127.0.0.1:4150"},
+						Codec:    "msgpack",
 					},
 				},
 				p: NSQ,
@@ -117,3 +119,131 @@ func TestLoad(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadAuth(t *testing.T) {
+	in := `urls:
+  -
+    path: "/drivers/{id:[0-9]+}/locations"
+    method: "PATCH"
+    nsq:
+      topic: "locations"
+    auth:
+      methods: ["jwt", "hmac"]
+      match:
+        - var: "id"
+          claim: "driver_id"
+auth:
+  api_keys:
+    - id: "ops"
+      key_env: "OPS_API_KEY"
+  hmac_keys:
+    - id: "driver-app"
+      secret_env: "DRIVER_APP_SECRET"
+      claims:
+        driver_id: 1
+  hmac_max_skew: 60
+  jwt:
+    jwks_file: "/config/jwks.json"
+    issuer: "https://auth.example.com"
+    audience: "gateway"
+    leeway: 30`
+	cfg, err := load(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantRoute := RouteAuthConf{
+		Methods: []string{"jwt", "hmac"},
+		Match:   []MatchConf{{Var: "id", Claim: "driver_id"}},
+	}
+	if g := cfg.URLs[0].Auth; !reflect.DeepEqual(wantRoute, g) {
+		t.Errorf("want route auth %+v got %+v", wantRoute, g)
+	}
+	want := AuthConf{
+		APIKeys: []APIKeyConf{{ID: "ops", KeyEnv: "OPS_API_KEY"}},
+		HMACKeys: []HMACKeyConf{{
+			ID:        "driver-app",
+			SecretEnv: "DRIVER_APP_SECRET",
+			Claims:    map[string]interface{}{"driver_id": 1},
+		}},
+		HMACMaxSkew: 60,
+		JWT: JWTConf{
+			JWKSFile: "/config/jwks.json",
+			Issuer:   "https://auth.example.com",
+			Audience: "gateway",
+			Leeway:   30,
+		},
+	}
+	if g := cfg.Auth; !reflect.DeepEqual(want, g) {
+		t.Errorf("want auth %+v got %+v", want, g)
+	}
+}
+
+func TestLoadRateLimits(t *testing.T) {
+	in := `urls:
+  -
+    path: "/drivers/{id:[0-9]+}/locations"
+    method: "PATCH"
+    nsq:
+      topic: "locations"
+    rate_limits:
+      - by: "var"
+        var: "id"
+        rate: 0.5
+        burst: 5
+      - name: "clients"
+        by: "ip"
+        rate: 100`
+	cfg, err := load(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []RateLimitConf{
+		{By: "var", Var: "id", Rate: 0.5, Burst: 5},
+		{Name: "clients", By: "ip", Rate: 100},
+	}
+	if g := cfg.URLs[0].RateLimits; !reflect.DeepEqual(want, g) {
+		t.Errorf("want rate limits %+v got %+v", want, g)
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	in := `urls:
+  -
+    path: "/drivers/{id:[0-9]+}/locations"
+    method: "PATCH"
+    nsq:
+      topic: "locations"
+      tls: true
+  -
+    path: "/drivers/{id:[0-9]+}"
+    method: "GET"
+    http:
+      host: "zombie-driver:8082"
+      tls: true`
+	cfg, err := load(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.URLs[0].NSQ.TLS || !cfg.URLs[1].HTTP.TLS {
+		t.Errorf("want TLS of nsq and http got %+v", cfg.URLs)
+	}
+}
+
+// The shipped config must restrict drivers to their own location.
+func TestShippedConfig(t *testing.T) {
+	cfg, err := FromFile("../config.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, u := range cfg.URLs {
+		if u.Method != "PATCH" {
+			continue
+		}
+		if w, g := []MatchConf{{Var: "id", Claim: "driver_id"}}, u.Auth.Match; !reflect.DeepEqual(w, g) {
+			t.Errorf("%s %s: want match rules %+v got %+v", u.Method, u.Path, w, g)
+		}
+	}
+	if len(cfg.Auth.HMACKeys) > 0 || len(cfg.Auth.APIKeys) > 0 {
+		t.Errorf("want no shared keys got %+v", cfg.Auth)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/auth"
+	"github.com/heetch/FabianG-technical-test/gateway/config"
+	"github.com/heetch/FabianG-technical-test/middleware"
+)
+
+// defaultHMACMaxSkew is the tolerated age of HMAC signatures, if not
+// configured.
+const defaultHMACMaxSkew = 5 * time.Minute
+
+// newAuthenticators returns the authenticators of cfg by method. Only
+// configured methods are returned. Secrets missing from the environment are
+// errors, so that the gateway does not start with routes nobody can access.
+func newAuthenticators(cfg config.AuthConf) (map[string]auth.Authenticator, error) {
+	auths := make(map[string]auth.Authenticator)
+	if len(cfg.APIKeys) > 0 {
+		var keys []auth.APIKey
+		for _, k := range cfg.APIKeys {
+			key := os.Getenv(k.KeyEnv)
+			if key == "" {
+				return nil, fmt.Errorf("API key %s: environment variable %q is not set", k.ID, k.KeyEnv)
+			}
+			keys = append(keys, auth.APIKey{ID: k.ID, Key: key, Claims: k.Claims})
+		}
+		auths[auth.MethodAPIKey] = auth.NewAPIKeys(keys...)
+	}
+	if len(cfg.HMACKeys) > 0 {
+		var keys []auth.HMACKey
+		for _, k := range cfg.HMACKeys {
+			secret := os.Getenv(k.SecretEnv)
+			if secret == "" {
+				return nil, fmt.Errorf("HMAC key %s: environment variable %q is not set", k.ID, k.SecretEnv)
+			}
+			keys = append(keys, auth.HMACKey{ID: k.ID, Secret: []byte(secret), Claims: k.Claims})
+		}
+		skew := defaultHMACMaxSkew
+		if cfg.HMACMaxSkew > 0 {
+			skew = time.Duration(cfg.HMACMaxSkew) * time.Second
+		}
+		auths[auth.MethodHMAC] = auth.NewHMAC(skew, keys...)
+	}
+	if cfg.JWT.JWKSFile != "" {
+		keys, err := auth.LoadJWKS(cfg.JWT.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS %s: %v", cfg.JWT.JWKSFile, err)
+		}
+		leeway := time.Duration(cfg.JWT.Leeway) * time.Second
+		auths[auth.MethodJWT] = auth.NewJWT(keys, cfg.JWT.Issuer, cfg.JWT.Audience, leeway)
+	}
+	return auths, nil
+}
+
+// newAuthCheck returns the auth middleware of u, or nil if requests to u are
+// not authenticated.
+func newAuthCheck(u config.URL, auths map[string]auth.Authenticator) (middleware.Middleware, error) {
+	if len(u.Auth.Methods) == 0 {
+		if len(u.Auth.Match) > 0 {
+			return nil, fmt.Errorf("%s %s: match rules require auth methods", u.Method, u.Path)
+		}
+		return nil, nil
+	}
+	var selected []auth.Authenticator
+	for _, m := range u.Auth.Methods {
+		a, ok := auths[m]
+		if !ok {
+			return nil, fmt.Errorf("%s %s: auth method %q is not configured", u.Method, u.Path, m)
+		}
+		selected = append(selected, a)
+	}
+	var rules []auth.Rule
+	for _, m := range u.Auth.Match {
+		if !hasPathVar(u.Path, m.Var) {
+			return nil, fmt.Errorf("%s %s: path variable %q of match rule not found", u.Method, u.Path, m.Var)
+		}
+		rules = append(rules, auth.Rule{Var: m.Var, Claim: m.Claim})
+	}
+	return middleware.NewAuthCheck(auth.Any(selected...), rules...), nil
+}
+
+// hasPathVar reports whether the mux path template has the variable name.
+// Variables may have patterns, e.g. `{id:[0-9]+}`.
+func hasPathVar(path, name string) bool {
+	return name != "" && (strings.Contains(path, "{"+name+"}") || strings.Contains(path, "{"+name+":"))
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/auth"
+	"github.com/heetch/FabianG-technical-test/gateway/config"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/rs/zerolog"
+)
+
+func TestAuth(t *testing.T) {
+	os.Setenv("TEST_GATEWAY_API_KEY", "key-1")
+	os.Setenv("TEST_GATEWAY_HMAC_SECRET", "secret")
+	defer os.Unsetenv("TEST_GATEWAY_API_KEY")
+	defer os.Unsetenv("TEST_GATEWAY_HMAC_SECRET")
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer backend.Close()
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		URLs: []config.URL{{
+			Path:   "/drivers/{id:[0-9]+}",
+			Method: "POST",
+			HTTP:   config.HTTPConf{Host: u.Host},
+			Auth: config.RouteAuthConf{
+				Methods: []string{auth.MethodAPIKey, auth.MethodHMAC},
+				Match:   []config.MatchConf{{Var: "id", Claim: "driver_id"}},
+			},
+		}},
+		Auth: config.AuthConf{
+			APIKeys: []config.APIKeyConf{
+				{ID: "driver-1", KeyEnv: "TEST_GATEWAY_API_KEY", Claims: map[string]interface{}{"driver_id": 1}},
+			},
+			HMACKeys: []config.HMACKeyConf{
+				{ID: "driver-2", SecretEnv: "TEST_GATEWAY_HMAC_SECRET", Claims: map[string]interface{}{"driver_id": "2"}},
+			},
+		},
+	}
+	h, err := newGatewayHandler(newProducers(zerolog.Nop()), cfg, health.New(time.Second, time.Second), nil, zerolog.New(ioutil.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		d string                // description of test case
+		p string                // request path
+		f func(r *http.Request) // adds credentials
+		s int                   // expected status code
+	}{
+		{
+			d: "expect API key of driver",
+			p: "/drivers/1",
+			f: func(r *http.Request) { r.Header.Set(auth.APIKeyHeader, "key-1") },
+			s: http.StatusOK,
+		},
+		{
+			d: "expect API key of other driver to be forbidden",
+			p: "/drivers/2",
+			f: func(r *http.Request) { r.Header.Set(auth.APIKeyHeader, "key-1") },
+			s: http.StatusForbidden,
+		},
+		{
+			d: "expect signed request of driver",
+			p: "/drivers/2",
+			f: func(r *http.Request) { auth.Sign(r, "driver-2", []byte("secret"), time.Now()) },
+			s: http.StatusOK,
+		},
+		{
+			d: "expect invalid signature to be unauthorized",
+			p: "/drivers/2",
+			f: func(r *http.Request) { auth.Sign(r, "driver-2", []byte("foo"), time.Now()) },
+			s: http.StatusUnauthorized,
+		},
+		{
+			d: "expect missing credentials to be unauthorized",
+			p: "/drivers/1",
+			s: http.StatusUnauthorized,
+		},
+	} {
+		r := httptest.NewRequest("POST", tt.p, strings.NewReader(`{"latitude":1}`))
+		if tt.f != nil {
+			tt.f(r)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if g := w.Code; tt.s != g {
+			t.Errorf("%s: want status code %d got %d", tt.d, tt.s, g)
+		}
+		// signed bodies are passed on
+		if tt.s == http.StatusOK && w.Body.String() != `{"latitude":1}` {
+			t.Errorf("%s: want body passed on got %s", tt.d, w.Body)
+		}
+	}
+}
+
+func TestAuthConfig(t *testing.T) {
+	for _, tt := range []struct {
+		d string     // description of test case
+		u config.URL // URL config
+		a config.AuthConf
+	}{
+		{
+			d: "expect error for unconfigured method",
+			u: config.URL{Path: "/drivers/{id}", Auth: config.RouteAuthConf{Methods: []string{"jwt"}}},
+		},
+		{
+			d: "expect error for unknown path variable",
+			u: config.URL{Path: "/drivers", Auth: config.RouteAuthConf{
+				Methods: []string{"api_key"},
+				Match:   []config.MatchConf{{Var: "id", Claim: "sub"}},
+			}},
+			a: config.AuthConf{APIKeys: []config.APIKeyConf{{ID: "k", KeyEnv: "PATH"}}},
+		},
+		{
+			d: "expect error for match rule without methods",
+			u: config.URL{Path: "/drivers/{id}", Auth: config.RouteAuthConf{
+				Match: []config.MatchConf{{Var: "id", Claim: "sub"}},
+			}},
+		},
+		{
+			d: "expect error for missing secret",
+			a: config.AuthConf{APIKeys: []config.APIKeyConf{{ID: "k", KeyEnv: "TEST_GATEWAY_UNSET"}}},
+		},
+		{
+			d: "expect error for missing JWKS file",
+			a: config.AuthConf{JWT: config.JWTConf{JWKSFile: "testdata/missing.json"}},
+		},
+	} {
+		auths, err := newAuthenticators(tt.a)
+		if err == nil {
+			_, err = newAuthCheck(tt.u, auths)
+		}
+		if err == nil {
+			t.Errorf("%s: want error", tt.d)
+		}
+	}
+}
@@ -2,18 +2,24 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"time"
 
 	"github.com/afex/hystrix-go/hystrix"
 	"github.com/gorilla/mux"
+	"github.com/heetch/FabianG-technical-test/codec"
 	"github.com/heetch/FabianG-technical-test/gateway/config"
 	"github.com/heetch/FabianG-technical-test/handler"
+	"github.com/heetch/FabianG-technical-test/health"
 	"github.com/heetch/FabianG-technical-test/middleware"
+	"github.com/heetch/FabianG-technical-test/tracing"
 	"github.com/heetch/FabianG-technical-test/types"
 	nsq "github.com/nsqio/go-nsq"
 	"github.com/prometheus/client_golang/prometheus"
@@ -27,69 +33,167 @@ var (
 			Help:    "histogram of response times for gateway http handlers",
 			Buckets: prometheus.ExponentialBuckets(0.5e-3, 2, 14), // 0.5ms to 4s
 		},
-		[]string{"path", "status_code"},
+		[]string{"path", "method", "status_code"},
+	)
+	requestsInFlightGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_requests_in_flight",
+			Help: "number of requests being handled by gateway http handlers",
+		},
+		[]string{"path", "method"},
+	)
+	responseCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_responses_total",
+			Help: "number of responses of gateway http handlers",
+		},
+		[]string{"path", "method", "status_code"},
+	)
+	rateLimitedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_rate_limited_total",
+			Help: "number of requests rejected by rate limits of gateway http handlers",
+		},
+		[]string{"path", "method", "limit"},
 	)
 )
 
 func init() {
 	prometheus.MustRegister(responseTimeHistogram)
+	prometheus.MustRegister(requestsInFlightGauge)
+	prometheus.MustRegister(responseCounter)
+	prometheus.MustRegister(rateLimitedCounter)
 }
 
-func newGatewayHandler(ctx context.Context, cfg *config.Config, logger zerolog.Logger) (http.Handler, error) {
+func newGatewayHandler(ps *Producers, cfg *config.Config, hc *health.Health, sampler zerolog.Sampler, logger zerolog.Logger) (http.Handler, error) {
 	// initialize middleware common to all handlers
 	var mw []middleware.Middleware
 	mw = append(mw, middleware.NewRecoverHandler())
-	mw = append(mw, middleware.NewContextLog(logger)...)
-	// we measure response time for all handlers
-	mc := middleware.NewMetricsConfig().WithTimeHist(responseTimeHistogram)
+	mw = append(mw, middleware.NewTracing())
+	mw = append(mw, middleware.NewContextLog(logger, sampler)...)
+	// we measure requests in flight, responses and response time for all
+	// handlers
+	mc := middleware.NewMetricsConfig().
+		WithGauge(requestsInFlightGauge).
+		WithCounter(responseCounter).
+		WithTimeHist(responseTimeHistogram)
 	mw = append(mw, middleware.NewMetricsHandler(mc))
 
+	auths, err := newAuthenticators(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	limiter := newRateLimiter(cfg)
+
 	router := mux.NewRouter()
 	for _, url := range cfg.URLs {
-		h, err := newHandler(ctx, url, logger)
+		h, err := newHandler(ps, url, cfg, hc, logger)
+		if err != nil {
+			return nil, err
+		}
+		// requests are authenticated and rate limited inside of the common
+		// middleware, so that rejected requests are logged and measured. rate
+		// limits by IP and path variable apply before authentication, so that
+		// floods are rejected cheaply; limits by subject apply after it
+		am, err := newAuthCheck(url, auths)
+		if err != nil {
+			return nil, err
+		}
+		rlPre, rlPost, err := newRateLimit(url, limiter)
+		if err != nil {
+			return nil, err
+		}
+		// bodies are limited before they are read for authentication
+		bl, to, err := newLimits(url, cfg.MaxBodyBytes)
 		if err != nil {
 			return nil, err
 		}
 		// relies on valid URL configuration; does not support query params
-		router.Handle(url.Path, middleware.Use(h, mw...)).Methods(url.Method)
+		router.Handle(url.Path, middleware.Use(h, append([]middleware.Middleware{rlPost, am, rlPre, bl, to}, mw...)...)).Methods(url.Method)
 	}
-	router.Handle("/ready", &handler.ReadinessHandler{})
+	router.Handle("/live", hc.Live())
+	router.Handle("/ready", hc)
 	return router, nil
 }
 
-func newHandler(ctx context.Context, u config.URL, logger zerolog.Logger) (http.Handler, error) {
+func newHandler(ps *Producers, u config.URL, cfg *config.Config, hc *health.Health, logger zerolog.Logger) (http.Handler, error) {
 	p, err := u.Protocol()
 	if err != nil {
 		return nil, err
 	}
 	switch p {
 	case config.NSQ:
-		return newNSQHandler(ctx, u, logger)
+		return newNSQHandler(ps, u, cfg, hc, logger)
 	case config.HTTP:
 		// in a real world scenario we would factor this out to perform more
 		// sophisticated operations like rewriting headers for HTTPS connections.
 		// we ignore Transfer-Encoding hop-by-hop header; expecting `chunked` to
 		// be applied if required. returns http.StatusBadGateway if backend is
-		// not reachable.
+		// not reachable. the transport propagates the trace context of the
+		// request.
 		// TODO: add circuit-breaker
-		return httputil.NewSingleHostReverseProxy(&url.URL{
+		target := &url.URL{
 			Scheme: "http",
 			Host:   u.HTTP.Host,
-		}), nil
+		}
+		// target is final before it is handed to the proxy
+		if u.HTTP.TLS {
+			target.Scheme = "https"
+		}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.Transport = &tracing.Transport{}
+		if u.HTTP.TLS {
+			// presents the client certificate of the gateway to backends
+			// requiring mutual TLS
+			t := http.DefaultTransport.(*http.Transport).Clone()
+			t.TLSClientConfig = cfg.ClientTLS
+			proxy.Transport = &tracing.Transport{Base: t}
+		}
+		return proxy, nil
 	default:
 		return nil, fmt.Errorf("no handler found for %s", p)
 	}
 }
 
-// nsqHandler transforms locations from http-requests to nsq-messages.
+// nsqHandler transforms locations from http-requests to nsq-messages. The
+// locations are published bare or wrapped by a versioned envelope; both are
+// encoded by codec.
 type nsqHandler struct {
 	topic     string
+	codec     codec.Codec
+	envelope  bool                     // wrap locations by an envelope
+	producer  string                   // identifies the gateway in envelopes
 	producers map[string]*nsq.Producer // safe for concurrent reads
 }
 
-func newNSQHandler(ctx context.Context, u config.URL, logger zerolog.Logger) (*nsqHandler, error) {
+func newNSQHandler(ps *Producers, u config.URL, gcfg *config.Config, hc *health.Health, logger zerolog.Logger) (*nsqHandler, error) {
+	c := codec.JSON
+	if u.NSQ.Codec != "" {
+		var err error
+		if c, err = codec.ByName(u.NSQ.Codec); err != nil {
+			return nil, err
+		}
+	}
+	// legacy consumers expect bare JSON locations; the format is switched to
+	// envelope once all consumers accept envelopes
+	var envelope bool
+	switch u.NSQ.Format {
+	case "", config.FormatLegacy:
+		if c != codec.JSON {
+			return nil, fmt.Errorf("%s %s: legacy format requires the json codec", u.Method, u.Path)
+		}
+	case config.FormatEnvelope:
+		envelope = true
+	default:
+		return nil, fmt.Errorf("%s %s: unknown format %q", u.Method, u.Path, u.NSQ.Format)
+	}
+
 	cfg := nsq.NewConfig()
 	cfg.UserAgent = fmt.Sprintf("go-nsq/%s", nsq.VERSION)
+	if u.NSQ.TLS {
+		cfg.TlsV1 = true
+		cfg.TlsConfig = gcfg.ClientTLS
+	}
 
 	// producers will lazily connect to the nsqd instance (and re-connect) when
 	// Publish commands are executed. note, that throttling is not enabled
@@ -104,25 +208,26 @@ func newNSQHandler(ctx context.Context, u config.URL, logger zerolog.Logger) (*n
 		// producer.SetLogger(logger, logger.Level)
 
 		producers[addr] = producer
+		ps.add(producer)
+		hc.Register("nsqd:"+addr, health.Func(producer.Ping))
 	}
 
-	// stop publishers on shutdown
-	go func() {
-		<-ctx.Done()
-		for _, p := range producers {
-			p.Stop()
-		}
-	}()
-
 	return &nsqHandler{
 		topic:     u.NSQ.Topic,
+		codec:     c,
+		envelope:  envelope,
+		producer:  gcfg.Producer,
 		producers: producers,
 	}, nil
 }
 
 func (n *nsqHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
 	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
+	if err == handler.ErrBodyTooLarge {
+		handler.WriteError(w, r, err, http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
 		handler.WriteError(w, r, err, http.StatusInternalServerError)
 		return
 	}
@@ -138,15 +243,18 @@ func (n *nsqHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// relies on sane input for `id`, currently sanitized by mux only
 	l.ID = mux.Vars(r)["id"]
-	b, err := json.Marshal(l)
+	ctx, span := tracing.Start(r.Context(), "publish "+n.topic, tracing.KindProducer)
+	defer span.End()
+	b, err := n.message(ctx, l, receivedAt)
 	if err != nil {
 		handler.WriteError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
-	// publish synchronously
+	// publish synchronously; the command gives up once the request exceeds
+	// its deadline, though the publishing itself is not cancelled
 	// todo, requeue in case failure
-	if err := hystrix.Do("publish_nsq", func() error { // circuit-breaker
+	if err := hystrix.DoC(ctx, "publish_nsq", func(context.Context) error { // circuit-breaker
 		for _, producer := range n.producers {
 			if err := producer.Publish(n.topic, b); err != nil {
 				return err
@@ -154,8 +262,72 @@ func (n *nsqHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return nil
 	}, nil); err != nil {
+		span.SetError(err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			handler.WriteError(w, r, handler.ErrTimeout, http.StatusGatewayTimeout)
+			return
+		}
 		handler.WriteError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
+
+// message returns the nsq message of the location l received at receivedAt.
+// The envelope carries the trace context of ctx to the consumers; legacy
+// messages do not.
+func (n *nsqHandler) message(ctx context.Context, l types.Location, receivedAt time.Time) ([]byte, error) {
+	payload, err := n.codec.Marshal(l)
+	if err != nil || !n.envelope {
+		return payload, err
+	}
+	id, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+	env := types.Envelope{
+		ID:          id,
+		Version:     types.EnvelopeVersion,
+		Type:        types.EventLocation,
+		Producer:    n.producer,
+		OccurredAt:  receivedAt.UTC().Format(time.RFC3339Nano),
+		PublishedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		Metadata:    make(map[string]string),
+		Payload:     payload,
+	}
+	tracing.Inject(ctx, tracing.MapCarrier(env.Metadata))
+	return codec.Encode(n.codec, env)
+}
+
+// defaultMaxBodyBytes is the body limit of requests, if not configured.
+const defaultMaxBodyBytes = 1 << 20
+
+// newLimits returns the body limit and timeout middleware of u. max is the
+// body limit of URLs without a limit.
+func newLimits(u config.URL, max int64) (bl, to middleware.Middleware, err error) {
+	if u.MaxBodyBytes < 0 || max < 0 {
+		return nil, nil, fmt.Errorf("%s %s: body limit must not be negative", u.Method, u.Path)
+	}
+	if u.Timeout < 0 {
+		return nil, nil, fmt.Errorf("%s %s: timeout must not be negative", u.Method, u.Path)
+	}
+	n := u.MaxBodyBytes
+	if n == 0 {
+		n = max
+	}
+	if n == 0 {
+		n = defaultMaxBodyBytes
+	}
+	return middleware.NewBodyLimit(n), middleware.NewTimeout(time.Duration(u.Timeout) * time.Millisecond), nil
+}
+
+// newEventID returns a random UUID (version 4) identifying an event.
+func newEventID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
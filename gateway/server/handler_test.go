@@ -2,17 +2,24 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/heetch/FabianG-technical-test/gateway/config"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/tracing"
+	"github.com/heetch/FabianG-technical-test/types"
 	nsq "github.com/nsqio/go-nsq"
 	"github.com/rs/zerolog"
 )
@@ -26,6 +33,7 @@ var gatewayConf = config.Config{
 			NSQ: config.NSQConf{
 				Topic:    "test-locations",
 				TCPAddrs: []string{"127.0.0.1:4150"},
+				Format:   config.FormatEnvelope,
 			},
 		},
 		config.URL{ // proxy
@@ -108,6 +116,9 @@ func TestProxy(t *testing.T) {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
+		if _, err := tracing.ParseTraceparent(r.Header.Get(tracing.TraceparentKey)); err != nil {
+			t.Errorf("expect traceparent header: %v", err)
+		}
 
 		// send mock data
 		if p, ok := gatewayTests[id]; ok {
@@ -137,7 +148,7 @@ func TestProxy(t *testing.T) {
 	gatewayConf.URLs[1].HTTP.Host = u.Host
 
 	// handler to test
-	h, err := newGatewayHandler(context.Background(), &gatewayConf, logger)
+	h, err := newGatewayHandler(newProducers(zerolog.Nop()), &gatewayConf, health.New(time.Second, time.Second), nil, logger)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -249,7 +260,7 @@ func TestNSQ(t *testing.T) {
 	log.SetOutput(logger)
 
 	// handler to test
-	h, err := newGatewayHandler(context.Background(), &gatewayConf, logger)
+	h, err := newGatewayHandler(newProducers(zerolog.Nop()), &gatewayConf, health.New(time.Second, time.Second), nil, logger)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -336,8 +347,22 @@ func newConsumerHandler(t *testing.T, topic string, want int) *ConsumerHandler {
 	return h
 }
 
+// HandleMessage keeps the payload of enveloped messages.
 func (h *ConsumerHandler) HandleMessage(message *nsq.Message) error {
-	h.got = append(h.got, string(message.Body))
+	var env types.Envelope
+	if err := json.Unmarshal(message.Body, &env); err != nil {
+		h.t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := tracing.ParseTraceparent(env.Metadata[tracing.TraceparentKey]); err != nil {
+		h.t.Errorf("expect trace context: %v", err)
+	}
+	if w, g := types.EnvelopeVersion, env.Version; w != g {
+		h.t.Errorf("want envelope version %d got %d", w, g)
+	}
+	if env.ID == "" || env.OccurredAt == "" || env.PublishedAt == "" {
+		h.t.Errorf("expect event ID and timestamps got %+v", env)
+	}
+	h.got = append(h.got, string(env.Payload))
 	if len(h.got) == h.want {
 		h.c.Stop()
 	}
@@ -355,3 +380,164 @@ func (h *ConsumerHandler) read(addr string) error {
 	<-h.c.StopChan
 	return nil
 }
+
+var messageTests = []struct {
+	d string // description of test case
+	c string // codec
+	f string // format
+	e bool   // expect envelope
+	r string // expected payload
+}{
+	{
+		d: "expect bare location by default",
+		r: `{"id":"1","latitude":48.864193,"longitude":2.350498}`,
+	},
+	{
+		d: "expect bare location for legacy format",
+		f: config.FormatLegacy,
+		r: `{"id":"1","latitude":48.864193,"longitude":2.350498}`,
+	},
+	{
+		d: "expect enveloped location for envelope format",
+		f: config.FormatEnvelope,
+		e: true,
+		r: `{"id":"1","latitude":48.864193,"longitude":2.350498}`,
+	},
+}
+
+func TestNSQMessage(t *testing.T) {
+	l := types.Location{ID: "1", Lat: 48.864193, Long: 2.350498}
+	for _, tt := range messageTests {
+		t.Run(tt.d, func(t *testing.T) {
+			u := config.URL{Path: "/drivers/{id}/locations", Method: "PATCH", NSQ: config.NSQConf{Topic: "locations", Codec: tt.c, Format: tt.f}}
+			n, err := newNSQHandler(newProducers(zerolog.Nop()), u, &config.Config{Producer: "gateway/test"}, health.New(time.Second, time.Second), zerolog.Nop())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			b, err := n.message(context.Background(), l, time.Now())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var env types.Envelope
+			if err := json.Unmarshal(b, &env); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w, g := tt.e, env.Payload != nil; w != g {
+				t.Fatalf("want envelope %t got %t", w, g)
+			}
+			if tt.e {
+				b = env.Payload
+			}
+			if w, g := tt.r, string(b); w != g {
+				t.Errorf("want payload %s got %s", w, g)
+			}
+		})
+	}
+
+	// legacy consumers decode JSON only
+	for _, f := range []string{"", config.FormatLegacy} {
+		u := config.URL{NSQ: config.NSQConf{Topic: "locations", Codec: "protobuf", Format: f}}
+		if _, err := newNSQHandler(newProducers(zerolog.Nop()), u, &config.Config{}, health.New(time.Second, time.Second), zerolog.Nop()); err == nil {
+			t.Errorf("expect error for format %q with protobuf codec", f)
+		}
+	}
+	u := config.URL{NSQ: config.NSQConf{Topic: "locations", Format: "bare"}}
+	if _, err := newNSQHandler(newProducers(zerolog.Nop()), u, &config.Config{}, health.New(time.Second, time.Second), zerolog.Nop()); err == nil {
+		t.Error("expect error for unknown format")
+	}
+}
+
+func TestNewEventID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := newEventID()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !uuid.MatchString(id) {
+			t.Errorf("want UUID got %s", id)
+		}
+		if seen[id] {
+			t.Errorf("want unique IDs got %s twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer backend.Close()
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		URLs: []config.URL{
+			{Path: "/small", Method: "POST", HTTP: config.HTTPConf{Host: u.Host}, MaxBodyBytes: 4},
+			{Path: "/default", Method: "POST", HTTP: config.HTTPConf{Host: u.Host}},
+		},
+		MaxBodyBytes: 8,
+	}
+	h, err := newGatewayHandler(newProducers(zerolog.Nop()), cfg, health.New(time.Second, time.Second), nil, zerolog.New(ioutil.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		d string // description of test case
+		p string // request path
+		b string // request body
+		s int    // expected status code
+	}{
+		{d: "expect body within route limit", p: "/small", b: "1234", s: http.StatusOK},
+		{d: "expect body exceeding route limit to be rejected", p: "/small", b: "12345", s: http.StatusRequestEntityTooLarge},
+		{d: "expect body within default limit", p: "/default", b: "12345678", s: http.StatusOK},
+		{d: "expect body exceeding default limit to be rejected", p: "/default", b: "123456789", s: http.StatusRequestEntityTooLarge},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", tt.p, strings.NewReader(tt.b)))
+		if g := w.Code; tt.s != g {
+			t.Errorf("%s: want status code %d got %d", tt.d, tt.s, g)
+		}
+	}
+}
+
+func TestProxyTLS(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(backend.Certificate())
+
+	for _, tt := range []struct {
+		d string      // description of test case
+		c *tls.Config // client TLS of gateway
+		s int         // expected status code
+	}{
+		{d: "expect backend to be verified", c: &tls.Config{RootCAs: pool}, s: http.StatusOK},
+		{d: "expect unknown backend to fail", c: &tls.Config{}, s: http.StatusBadGateway},
+	} {
+		cfg := &config.Config{
+			URLs:      []config.URL{{Path: "/drivers/{id}", Method: "GET", HTTP: config.HTTPConf{Host: u.Host, TLS: true}}},
+			ClientTLS: tt.c,
+		}
+		h, err := newGatewayHandler(newProducers(zerolog.Nop()), cfg, health.New(time.Second, time.Second), nil, zerolog.New(ioutil.Discard))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.d, err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/drivers/1", nil))
+		if g := w.Code; tt.s != g {
+			t.Errorf("%s: want status code %d got %d", tt.d, tt.s, g)
+		}
+	}
+}
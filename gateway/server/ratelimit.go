@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/heetch/FabianG-technical-test/gateway/config"
+	"github.com/heetch/FabianG-technical-test/middleware"
+)
+
+// keys of rate limits
+const (
+	rateLimitByVar     = "var"
+	rateLimitByIP      = "ip"
+	rateLimitBySubject = "subject"
+)
+
+// newRateLimiter returns the limiter keeping the token buckets of cfg.
+func newRateLimiter(cfg *config.Config) middleware.RateLimiter {
+	if cfg.RateLimitRedisAddr != "" {
+		return middleware.NewRedisRateLimiter(cfg.RateLimitRedisAddr)
+	}
+	return middleware.NewMemoryRateLimiter()
+}
+
+// newRateLimit returns the rate limit middleware of u applied before and
+// after authentication. Limits by IP and path variable apply before, so that
+// unauthenticated floods do not reach the authenticators; limits by subject
+// apply after. Either is nil if there are no such limits.
+func newRateLimit(u config.URL, l middleware.RateLimiter) (pre, post middleware.Middleware, err error) {
+	names := make(map[string]bool)
+	var preLimits, postLimits []middleware.RateLimit
+	for _, c := range u.RateLimits {
+		limit := middleware.RateLimit{
+			Name:  c.Name,
+			Rate:  c.Rate,
+			Burst: c.Burst,
+		}
+		if limit.Name == "" {
+			limit.Name = c.By
+		}
+		if names[limit.Name] {
+			return nil, nil, fmt.Errorf("%s %s: duplicate rate limit %q", u.Method, u.Path, limit.Name)
+		}
+		names[limit.Name] = true
+		if limit.Rate <= 0 {
+			return nil, nil, fmt.Errorf("%s %s: rate limit %q: rate must be positive", u.Method, u.Path, limit.Name)
+		}
+		if limit.Burst <= 0 {
+			limit.Burst = 1
+		}
+		switch c.By {
+		case rateLimitByVar:
+			if !hasPathVar(u.Path, c.Var) {
+				return nil, nil, fmt.Errorf("%s %s: rate limit %q: path variable %q not found", u.Method, u.Path, limit.Name, c.Var)
+			}
+			limit.Key = middleware.KeyByVar(c.Var)
+			preLimits = append(preLimits, limit)
+		case rateLimitByIP:
+			limit.Key = middleware.KeyByIP
+			preLimits = append(preLimits, limit)
+		case rateLimitBySubject:
+			// unauthenticated requests would not be limited
+			if len(u.Auth.Methods) == 0 {
+				return nil, nil, fmt.Errorf("%s %s: rate limit %q: subject requires auth methods", u.Method, u.Path, limit.Name)
+			}
+			limit.Key = middleware.KeyBySubject
+			postLimits = append(postLimits, limit)
+		default:
+			return nil, nil, fmt.Errorf("%s %s: rate limit %q: unknown key %q", u.Method, u.Path, limit.Name, c.By)
+		}
+	}
+	if len(preLimits) > 0 {
+		pre = middleware.NewRateLimit(l, rateLimitedCounter, preLimits...)
+	}
+	if len(postLimits) > 0 {
+		post = middleware.NewRateLimit(l, rateLimitedCounter, postLimits...)
+	}
+	return pre, post, nil
+}
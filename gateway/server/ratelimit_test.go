@@ -0,0 +1,145 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/auth"
+	"github.com/heetch/FabianG-technical-test/gateway/config"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/rs/zerolog"
+)
+
+func TestRateLimit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		URLs: []config.URL{{
+			Path:       "/drivers/{id:[0-9]+}",
+			Method:     "PATCH",
+			HTTP:       config.HTTPConf{Host: u.Host},
+			RateLimits: []config.RateLimitConf{{By: "var", Var: "id", Rate: 0.01, Burst: 2}},
+		}},
+	}
+	h, err := newGatewayHandler(newProducers(zerolog.Nop()), cfg, health.New(time.Second, time.Second), nil, zerolog.New(ioutil.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		d string // description of test case
+		p string // request path
+		s int    // expected status code
+	}{
+		{d: "expect first request of burst", p: "/drivers/1", s: http.StatusOK},
+		{d: "expect second request of burst", p: "/drivers/1", s: http.StatusOK},
+		{d: "expect request exceeding burst to be limited", p: "/drivers/1", s: http.StatusTooManyRequests},
+		{d: "expect other driver not to be limited", p: "/drivers/2", s: http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("PATCH", tt.p, nil))
+		if g := w.Code; tt.s != g {
+			t.Errorf("%s: want status code %d got %d", tt.d, tt.s, g)
+		}
+		if tt.s == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "100" {
+			t.Errorf("%s: want Retry-After 100 got %q", tt.d, w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestRateLimitAuth(t *testing.T) {
+	os.Setenv("TEST_GATEWAY_API_KEY", "key-1")
+	defer os.Unsetenv("TEST_GATEWAY_API_KEY")
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		URLs: []config.URL{{
+			Path:   "/drivers/{id:[0-9]+}",
+			Method: "PATCH",
+			HTTP:   config.HTTPConf{Host: u.Host},
+			Auth:   config.RouteAuthConf{Methods: []string{auth.MethodAPIKey}},
+			RateLimits: []config.RateLimitConf{
+				{By: "ip", Rate: 0.01, Burst: 1},
+				{By: "subject", Rate: 0.01, Burst: 1},
+			},
+		}},
+		Auth: config.AuthConf{
+			APIKeys: []config.APIKeyConf{{ID: "driver-1", KeyEnv: "TEST_GATEWAY_API_KEY"}},
+		},
+	}
+	h, err := newGatewayHandler(newProducers(zerolog.Nop()), cfg, health.New(time.Second, time.Second), nil, zerolog.New(ioutil.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		d string // description of test case
+		a string // remote address
+		k string // API key
+		s int    // expected status code
+	}{
+		{d: "expect missing credentials to be unauthorized", a: "192.0.2.1:1234", s: http.StatusUnauthorized},
+		{d: "expect ip limit before authentication", a: "192.0.2.1:1234", s: http.StatusTooManyRequests},
+		{d: "expect API key of other ip", a: "192.0.2.2:1234", k: "key-1", s: http.StatusOK},
+		{d: "expect subject limit after authentication", a: "192.0.2.3:1234", k: "key-1", s: http.StatusTooManyRequests},
+	} {
+		r := httptest.NewRequest("PATCH", "/drivers/1", nil)
+		r.RemoteAddr = tt.a
+		if tt.k != "" {
+			r.Header.Set(auth.APIKeyHeader, tt.k)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if g := w.Code; tt.s != g {
+			t.Errorf("%s: want status code %d got %d", tt.d, tt.s, g)
+		}
+	}
+}
+
+func TestRateLimitConfig(t *testing.T) {
+	for _, tt := range []struct {
+		d string     // description of test case
+		u config.URL // URL config
+	}{
+		{
+			d: "expect error for non-positive rate",
+			u: config.URL{Path: "/drivers", RateLimits: []config.RateLimitConf{{By: "ip"}}},
+		},
+		{
+			d: "expect error for unknown path variable",
+			u: config.URL{Path: "/drivers", RateLimits: []config.RateLimitConf{{By: "var", Var: "id", Rate: 1}}},
+		},
+		{
+			d: "expect error for subject without auth methods",
+			u: config.URL{Path: "/drivers", RateLimits: []config.RateLimitConf{{By: "subject", Rate: 1}}},
+		},
+		{
+			d: "expect error for unknown key",
+			u: config.URL{Path: "/drivers", RateLimits: []config.RateLimitConf{{By: "header", Rate: 1}}},
+		},
+		{
+			d: "expect error for duplicate names",
+			u: config.URL{Path: "/drivers", RateLimits: []config.RateLimitConf{{By: "ip", Rate: 1}, {By: "ip", Rate: 2}}},
+		},
+	} {
+		if _, _, err := newRateLimit(tt.u, nil); err == nil {
+			t.Errorf("%s: want error", tt.d)
+		}
+	}
+}
@@ -3,36 +3,49 @@ package server
 import (
 	"context"
 	"net/http"
+	"sync"
 
 	"github.com/heetch/FabianG-technical-test/gateway/config"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/httpserver"
+	nsq "github.com/nsqio/go-nsq"
 	"github.com/rs/zerolog"
 )
 
 type HTTPServer struct {
-	server *http.Server
-	logger zerolog.Logger
+	server    *http.Server
+	producers *Producers
+	logger    zerolog.Logger
 }
 
-func New(ctx context.Context, addr string, cfg *config.Config, logger zerolog.Logger) (*HTTPServer, error) {
-	router, err := newGatewayHandler(ctx, cfg, logger)
+// New returns an HTTPServer configured by srvCfg, which serves the routes of cfg.
+func New(addr string, srvCfg httpserver.Config, cfg *config.Config, hc *health.Health, logger zerolog.Logger) (*HTTPServer, error) {
+	ps := newProducers(logger)
+	router, err := newGatewayHandler(ps, cfg, hc, srvCfg.AccessLogSampler, logger)
 	if err != nil {
 		return nil, err
 	}
-	server := &http.Server{
-		Addr:    addr,
-		Handler: router,
-	}
+	server := httpserver.New(addr, router, srvCfg)
 	return &HTTPServer{
-		server: server,
-		logger: logger,
+		server:    server,
+		producers: ps,
+		logger:    logger,
 	}, nil
 }
 
-func (s *HTTPServer) Run() {
+// Producers returns the nsq producers of the routes of s. They must be shut
+// down after s, so that running requests are still published.
+func (s *HTTPServer) Producers() *Producers {
+	return s.producers
+}
+
+// Run serves http requests until s is shut down.
+func (s *HTTPServer) Run() error {
 	s.logger.Info().Msgf("http server listening on %s", s.server.Addr)
-	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
-		s.logger.Fatal().Err(err).Msg("http server exited with error")
+	if err := httpserver.ListenAndServe(s.server); err != http.ErrServerClosed {
+		return err
 	}
+	return nil
 }
 
 func (s *HTTPServer) Shutdown(ctx context.Context) {
@@ -44,3 +57,53 @@ func (s *HTTPServer) Shutdown(ctx context.Context) {
 		s.logger.Error().Err(err).Msg("http server shutdown error")
 	}
 }
+
+// Producers are the nsq producers of the gateway. They publish until they are
+// shut down.
+type Producers struct {
+	mu        sync.Mutex
+	producers []*nsq.Producer
+	done      chan struct{}
+	once      sync.Once
+	logger    zerolog.Logger
+}
+
+func newProducers(logger zerolog.Logger) *Producers {
+	return &Producers{
+		done:   make(chan struct{}),
+		logger: logger,
+	}
+}
+
+func (ps *Producers) add(p *nsq.Producer) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.producers = append(ps.producers, p)
+}
+
+// Run waits until ps is shut down.
+func (ps *Producers) Run() error {
+	<-ps.done
+	return nil
+}
+
+// Shutdown stops all producers; pending publishes are finished first.
+func (ps *Producers) Shutdown(ctx context.Context) {
+	ps.logger.Info().Msg("stopping nsq producers")
+
+	stopped := make(chan struct{})
+	go func() {
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+		for _, p := range ps.producers {
+			p.Stop()
+		}
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		ps.logger.Error().Err(ctx.Err()).Msg("nsq producers shutdown error")
+	}
+	ps.once.Do(func() { close(ps.done) })
+}
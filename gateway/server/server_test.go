@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/httpserver"
+	nsq "github.com/nsqio/go-nsq"
+	"github.com/rs/zerolog"
+)
+
+func TestProducersShutdown(t *testing.T) {
+	s, err := New("127.0.0.1:0", httpserver.Config{}, &gatewayConf, health.New(time.Second, time.Second), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ps := s.Producers()
+	if w, g := 1, len(ps.producers); w != g {
+		t.Fatalf("want %d producers got %d", w, g)
+	}
+
+	done := make(chan error)
+	go func() { done <- ps.Run() }()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.Shutdown(ctx)
+	ps.Shutdown(ctx)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want producers to stop running")
+	}
+	if w, g := nsq.ErrStopped, ps.producers[0].Publish("test-locations", []byte("{}")); w != g {
+		t.Errorf("want error %v got %v", w, g)
+	}
+}
@@ -0,0 +1,114 @@
+// Package geo computes distances between geographic coordinates given in
+// degrees.
+package geo
+
+import (
+	"fmt"
+	"math"
+)
+
+// DistanceFunc returns the distance between two coordinates in km.
+type DistanceFunc func(lat1, long1, lat2, long2 float64) float64
+
+// names of distance methods, see Method
+const (
+	MethodHaversine       = "haversine"
+	MethodVincenty        = "vincenty"
+	MethodEquirectangular = "equirectangular"
+)
+
+// Method returns the distance func identified by name.
+func Method(name string) (DistanceFunc, error) {
+	switch name {
+	case MethodHaversine:
+		return Haversine, nil
+	case MethodVincenty:
+		return Vincenty, nil
+	case MethodEquirectangular:
+		return Equirectangular, nil
+	}
+	return nil, fmt.Errorf("unknown distance method: %s", name)
+}
+
+const (
+	degreesToRadians = math.Pi / 180.0
+
+	// mean earth radius used by spherical approximations
+	earthRadiusKm = 6371.0
+
+	// WGS84 ellipsoid
+	wgs84A = 6378137.0         // semi-major axis in meter
+	wgs84F = 1 / 298.257223563 // flattening
+	wgs84B = wgs84A * (1 - wgs84F)
+)
+
+// Haversine returns the great-circle distance on a spherical earth. The error
+// compared to the WGS84 ellipsoid is up to 0.6%.
+func Haversine(lat1, long1, lat2, long2 float64) float64 {
+	dlong := (long2 - long1) * degreesToRadians
+	dlat := (lat2 - lat1) * degreesToRadians
+
+	lat1 = lat1 * degreesToRadians
+	lat2 = lat2 * degreesToRadians
+
+	a := math.Pow(math.Sin(dlat/2.0), 2) +
+		math.Pow(math.Sin(dlong/2.0), 2)*math.Cos(lat1)*math.Cos(lat2)
+
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return earthRadiusKm * c
+}
+
+// Equirectangular returns the distance on a plane projected at the mean
+// latitude of both coordinates. It is the fastest approximation and accurate
+// for short distances of a few km, but degrades with distance and towards the
+// poles.
+func Equirectangular(lat1, long1, lat2, long2 float64) float64 {
+	x := (long2 - long1) * degreesToRadians * math.Cos((lat1+lat2)/2*degreesToRadians)
+	y := (lat2 - lat1) * degreesToRadians
+	return earthRadiusKm * math.Sqrt(x*x+y*y)
+}
+
+// Vincenty returns the distance on the WGS84 ellipsoid by the inverse formula
+// of Vincenty, which is accurate to less than a millimeter. For nearly
+// antipodal coordinates the formula does not converge; Haversine is used
+// instead.
+func Vincenty(lat1, long1, lat2, long2 float64) float64 {
+	l := (long2 - long1) * degreesToRadians
+	u1 := math.Atan((1 - wgs84F) * math.Tan(lat1*degreesToRadians))
+	u2 := math.Atan((1 - wgs84F) * math.Tan(lat2*degreesToRadians))
+	sinU1, cosU1 := math.Sincos(u1)
+	sinU2, cosU2 := math.Sincos(u2)
+
+	lambda := l
+	for i := 0; i < 200; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma := math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			return 0 // coincident points
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha := 1 - sinAlpha*sinAlpha
+		var cos2SigmaM float64 // zero on the equator
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+		c := wgs84F / 16 * cosSqAlpha * (4 + wgs84F*(4-3*cosSqAlpha))
+		prev := lambda
+		lambda = l + (1-c)*wgs84F*sinAlpha*
+			(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prev) > 1e-12 {
+			continue
+		}
+
+		uSq := cosSqAlpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+		a := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+		b := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+		deltaSigma := b * sinSigma * (cos2SigmaM + b/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+			b/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+		return wgs84B * a * (sigma - deltaSigma) / 1000 // m to km
+	}
+	return Haversine(lat1, long1, lat2, long2)
+}
@@ -0,0 +1,105 @@
+package geo
+
+import (
+	"math"
+	"testing"
+
+	"github.com/heetch/FabianG-technical-test/testdata"
+)
+
+// total returns the total distance between consecutive locations of the
+// testdata distance identified by i.
+func total(f DistanceFunc, i int) float64 {
+	var dist float64
+	l := testdata.Distances[i].L
+	for j := 0; j < len(l)-1; j++ {
+		dist += f(l[j].Lat, l[j].Long, l[j+1].Lat, l[j+1].Long)
+	}
+	return dist
+}
+
+func TestHaversine(t *testing.T) {
+	for i, tt := range testdata.Distances {
+		if w, g := tt.D, total(Haversine, i); w != g {
+			t.Errorf("haversine distance: want %f but got %f", w, g)
+		}
+	}
+}
+
+// The annotated distances of the testdata are haversine distances. Near the
+// equator, the WGS84 ellipsoid is flatter than the sphere along meridians, so
+// distances differ by up to 0.6%.
+var methodTests = []struct {
+	m string  // distance method
+	e float64 // max relative error compared to haversine distance
+}{
+	{
+		m: MethodHaversine,
+		e: 0,
+	},
+	{
+		m: MethodVincenty,
+		e: 0.006,
+	},
+	{
+		m: MethodEquirectangular,
+		e: 1e-6,
+	},
+}
+
+func TestMethod(t *testing.T) {
+	for _, tt := range methodTests {
+		f, err := Method(tt.m)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i, d := range testdata.Distances {
+			if g := total(f, i); math.Abs(g-d.D) > tt.e*d.D {
+				t.Errorf("%s distance: want %f within %.1e but got %f", tt.m, d.D, tt.e, g)
+			}
+		}
+	}
+	if _, err := Method("flat"); err == nil {
+		t.Error("expect error for unknown method")
+	}
+}
+
+var vincentyTests = []struct {
+	d    string     // description of test case
+	l    [4]float64 // lat1, long1, lat2, long2
+	dist float64    // expected distance in km
+}{
+	{
+		d:    "expect geodetic reference distance from Flinders Peak to Buninyong",
+		l:    [4]float64{-37.95103341666667, 144.42486788888889, -37.65282113888889, 143.92649552777778},
+		dist: 54.972271,
+	},
+	{
+		d:    "expect a quarter meridian",
+		l:    [4]float64{0, 0, 90, 0},
+		dist: 10001.965729,
+	},
+	{
+		d:    "expect distance along the equator",
+		l:    [4]float64{0, 0, 0, 1},
+		dist: 111.319491,
+	},
+	{
+		d:    "expect zero for coincident points",
+		l:    [4]float64{48.864193, 20.350498, 48.864193, 20.350498},
+		dist: 0,
+	},
+	{
+		d:    "expect haversine fallback for antipodal points",
+		l:    [4]float64{0, 0, 0.5, 179.7},
+		dist: Haversine(0, 0, 0.5, 179.7),
+	},
+}
+
+func TestVincenty(t *testing.T) {
+	for _, tt := range vincentyTests {
+		if w, g := tt.dist, Vincenty(tt.l[0], tt.l[1], tt.l[2], tt.l[3]); math.Abs(w-g) > 1e-6 {
+			t.Errorf("%s: want %f got %f", tt.d, w, g)
+		}
+	}
+}
@@ -10,6 +10,9 @@ require (
 	github.com/nsqio/go-nsq v1.0.7
 	github.com/prometheus/client_golang v1.2.1
 	github.com/rs/zerolog v1.15.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	golang.org/x/sync v0.1.0
+	google.golang.org/protobuf v1.26.0
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/yaml.v2 v2.2.4
 )
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/heetch/FabianG-technical-test/codec"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
 )
@@ -30,6 +31,14 @@ var (
 	errBadRequest = errors.New("bad_request")
 )
 
+// ErrBodyTooLarge is the error of reading request bodies exceeding their
+// limit; see middleware.NewBodyLimit.
+var ErrBodyTooLarge = errors.New("request_entity_too_large")
+
+// ErrTimeout is the error of requests exceeding the deadline of their
+// context; see middleware.NewTimeout.
+var ErrTimeout = errors.New("timeout")
+
 // WriteError writes an error to the http response in JSON format.
 func WriteError(w http.ResponseWriter, r *http.Request, err error, code int) {
 	// Prepare log.
@@ -61,6 +70,28 @@ func EncodeJSON(w http.ResponseWriter, r *http.Request, v interface{}, status in
 	}
 }
 
+// Encode encodes v to w by the codec negotiated by the Accept header of r.
+// Values which are not supported by the negotiated codec are encoded as JSON.
+func Encode(w http.ResponseWriter, r *http.Request, v interface{}, status int) {
+	w.Header().Add("Vary", "Accept")
+	c := codec.Negotiate(r.Header.Get("Accept"))
+	if c == codec.JSON {
+		EncodeJSON(w, r, v, status)
+		return
+	}
+	b, err := c.Marshal(v)
+	if err != nil {
+		LoggerFromRequest(r).Debug().Err(err).Str("codec", c.Name()).Msg("falling back to JSON")
+		EncodeJSON(w, r, v, status)
+		return
+	}
+	w.Header().Set("Content-Type", c.ContentType())
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		LoggerFromRequest(r).Error().Err(err).Msg("failed to write http response")
+	}
+}
+
 func LoggerFromRequest(r *http.Request) *zerolog.Logger {
 	logger := hlog.FromRequest(r).With().
 		Str("method", r.Method).
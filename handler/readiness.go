@@ -2,22 +2,26 @@ package handler
 
 import (
 	"net/http"
-	"sync/atomic"
-)
 
-var healthCode = int32(http.StatusOK)
+	"github.com/heetch/FabianG-technical-test/health"
+)
 
 // HealthCheckShutDown set the health to not ok
 func HealthCheckShutDown() {
-	atomic.StoreInt32(&healthCode, http.StatusServiceUnavailable)
+	health.ShutDown()
 }
 
-func health() int {
-	return int(atomic.LoadInt32(&healthCode))
+func status() int {
+	if health.IsShuttingDown() {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
 }
 
+// ReadinessHandler reports the shutdown state only. Services should prefer
+// the dependency checks of package health.
 type ReadinessHandler struct{}
 
 func (h *ReadinessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(health())
+	w.WriteHeader(status())
 }
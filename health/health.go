@@ -0,0 +1,210 @@
+// Package health serves the liveness and readiness of a service. Readiness
+// depends on the results of registered checks of the service's dependencies.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// status of a service or a check
+const (
+	StatusOK           = "ok"
+	StatusFailing      = "failing"
+	StatusShuttingDown = "shutting_down"
+)
+
+var shuttingDown int32
+
+// ShutDown marks the service as not ready, regardless of its checks.
+func ShutDown() {
+	atomic.StoreInt32(&shuttingDown, 1)
+}
+
+// IsShuttingDown reports whether ShutDown has been called.
+func IsShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+// Check reports an error if a dependency is not usable. It must return when
+// ctx is done.
+type Check func(ctx context.Context) error
+
+// Func returns a Check which runs f, for dependencies which do not support a
+// context. The check returns when ctx is done, while f keeps running until it
+// returns.
+func Func(f func() error) Check {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- f()
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	CheckedAt string `json:"checked_at"` // RFC3339
+	Optional  bool   `json:"optional,omitempty"`
+}
+
+// Report is the readiness of a service with the results of its checks.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+type check struct {
+	fn       Check
+	optional bool // reported only; does not fail readiness
+
+	mu      sync.Mutex // serializes runs of fn
+	result  Result
+	expires time.Time
+}
+
+// Health runs registered checks and caches their results. It is safe for
+// concurrent use by multiple goroutines.
+type Health struct {
+	ttl     time.Duration // how long results are cached
+	timeout time.Duration // max duration of a check
+	now     func() time.Time
+
+	mu     sync.RWMutex
+	checks map[string]*check
+}
+
+// New returns a Health which caches results of checks for ttl and cancels
+// checks after timeout.
+func New(ttl, timeout time.Duration) *Health {
+	return &Health{
+		ttl:     ttl,
+		timeout: timeout,
+		now:     time.Now,
+		checks:  make(map[string]*check),
+	}
+}
+
+// Register adds the check c identified by name. Registering a name again
+// replaces the check.
+func (h *Health) Register(name string, c Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = &check{fn: c}
+}
+
+// RegisterOptional adds the check c identified by name, which is reported but
+// does not affect readiness, e.g. for dependencies the service can do without.
+// Registering a name again replaces the check.
+func (h *Health) RegisterOptional(name string, c Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = &check{fn: c, optional: true}
+}
+
+// Report runs all checks concurrently, unless their results are cached.
+func (h *Health) Report(ctx context.Context) Report {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]*check, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = h.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	r := Report{Status: StatusOK}
+	if IsShuttingDown() {
+		r.Status = StatusShuttingDown
+	}
+	if len(names) > 0 {
+		r.Checks = make(map[string]Result, len(names))
+	}
+	for i, name := range names {
+		r.Checks[name] = results[i]
+		if results[i].Status != StatusOK && !results[i].Optional && r.Status == StatusOK {
+			r.Status = StatusFailing
+		}
+	}
+	return r
+}
+
+// run returns the cached result of c or runs c.
+func (h *Health) run(ctx context.Context, c *check) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := h.now()
+	if now.Before(c.expires) {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	res := Result{
+		Status:    StatusOK,
+		CheckedAt: now.UTC().Format(time.RFC3339),
+		Optional:  c.optional,
+	}
+	if err := c.fn(ctx); err != nil {
+		res.Status = StatusFailing
+		res.Error = err.Error()
+	}
+	c.result, c.expires = res, now.Add(h.ttl)
+	return res
+}
+
+// ServeHTTP responds with the readiness report of h. The status code is
+// http.StatusOK if all checks but optional ones succeed and the service is not
+// shutting down, else http.StatusServiceUnavailable.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := h.Report(r.Context())
+	code := http.StatusOK
+	if report.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	encode(w, report, code)
+}
+
+// Live returns a handler which reports that the process is able to serve
+// requests. Dependencies are not checked, so it never fails; a failing
+// liveness probe should result in a restart, which does not fix broken
+// dependencies.
+func (h *Health) Live() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encode(w, Report{Status: StatusOK}, http.StatusOK)
+	})
+}
+
+func encode(w http.ResponseWriter, v interface{}, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	// encoding fails only if the client is gone
+	_ = json.NewEncoder(w).Encode(v)
+}
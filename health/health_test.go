@@ -0,0 +1,189 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var checkedAt = time.Date(2019, 10, 15, 7, 0, 0, 0, time.UTC)
+
+func ok(ctx context.Context) error { return nil }
+
+func failing(ctx context.Context) error { return errors.New("connection refused") }
+
+func blocking(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+var readyTests = []struct {
+	d string           // description of test case
+	c map[string]Check // registered checks
+	o map[string]Check // registered optional checks
+	r Report           // expected report
+	s int              // expected response status code
+}{
+	{
+		d: "expect ok without checks",
+		r: Report{Status: StatusOK},
+		s: http.StatusOK,
+	},
+	{
+		d: "expect ok if all checks succeed",
+		c: map[string]Check{"redis": ok, "nsq": ok},
+		r: Report{
+			Status: StatusOK,
+			Checks: map[string]Result{
+				"redis": {Status: StatusOK, CheckedAt: "2019-10-15T07:00:00Z"},
+				"nsq":   {Status: StatusOK, CheckedAt: "2019-10-15T07:00:00Z"},
+			},
+		},
+		s: http.StatusOK,
+	},
+	{
+		d: "expect failing if a check fails",
+		c: map[string]Check{"redis": failing, "nsq": ok},
+		r: Report{
+			Status: StatusFailing,
+			Checks: map[string]Result{
+				"redis": {Status: StatusFailing, Error: "connection refused", CheckedAt: "2019-10-15T07:00:00Z"},
+				"nsq":   {Status: StatusOK, CheckedAt: "2019-10-15T07:00:00Z"},
+			},
+		},
+		s: http.StatusServiceUnavailable,
+	},
+	{
+		d: "expect ok if an optional check fails",
+		c: map[string]Check{"redis": ok},
+		o: map[string]Check{"upstream": failing},
+		r: Report{
+			Status: StatusOK,
+			Checks: map[string]Result{
+				"redis":    {Status: StatusOK, CheckedAt: "2019-10-15T07:00:00Z"},
+				"upstream": {Status: StatusFailing, Error: "connection refused", CheckedAt: "2019-10-15T07:00:00Z", Optional: true},
+			},
+		},
+		s: http.StatusOK,
+	},
+	{
+		d: "expect failing if a func check fails",
+		c: map[string]Check{"nsqd": Func(func() error { return errors.New("connection refused") })},
+		r: Report{
+			Status: StatusFailing,
+			Checks: map[string]Result{
+				"nsqd": {Status: StatusFailing, Error: "connection refused", CheckedAt: "2019-10-15T07:00:00Z"},
+			},
+		},
+		s: http.StatusServiceUnavailable,
+	},
+	{
+		d: "expect failing if a func check times out",
+		c: map[string]Check{"nsqd": Func(func() error { time.Sleep(100 * time.Millisecond); return nil })},
+		r: Report{
+			Status: StatusFailing,
+			Checks: map[string]Result{
+				"nsqd": {Status: StatusFailing, Error: "context deadline exceeded", CheckedAt: "2019-10-15T07:00:00Z"},
+			},
+		},
+		s: http.StatusServiceUnavailable,
+	},
+	{
+		d: "expect failing if a check times out",
+		c: map[string]Check{"upstream": blocking},
+		r: Report{
+			Status: StatusFailing,
+			Checks: map[string]Result{
+				"upstream": {Status: StatusFailing, Error: "context deadline exceeded", CheckedAt: "2019-10-15T07:00:00Z"},
+			},
+		},
+		s: http.StatusServiceUnavailable,
+	},
+}
+
+func newTestHealth() *Health {
+	h := New(time.Second, 10*time.Millisecond)
+	h.now = func() time.Time { return checkedAt }
+	return h
+}
+
+func TestReady(t *testing.T) {
+	for _, tt := range readyTests {
+		t.Run(tt.d, func(t *testing.T) {
+			h := newTestHealth()
+			for name, c := range tt.c {
+				h.Register(name, c)
+			}
+			for name, c := range tt.o {
+				h.RegisterOptional(name, c)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+			if w, g := tt.s, rec.Code; w != g {
+				t.Errorf("want status code %d got %d", w, g)
+			}
+			var r Report
+			if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w, g := tt.r, r; !reflect.DeepEqual(w, g) {
+				t.Errorf("want %+v got %+v", w, g)
+			}
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	h := newTestHealth()
+	var calls int32
+	h.Register("redis", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+	now := checkedAt
+	h.now = func() time.Time { return now }
+
+	h.Report(context.Background())
+	h.Report(context.Background())
+	if w, g := int32(1), atomic.LoadInt32(&calls); w != g {
+		t.Errorf("want %d calls within ttl got %d", w, g)
+	}
+	now = now.Add(time.Second)
+	h.Report(context.Background())
+	if w, g := int32(2), atomic.LoadInt32(&calls); w != g {
+		t.Errorf("want %d calls after ttl got %d", w, g)
+	}
+}
+
+func TestShutDown(t *testing.T) {
+	defer atomic.StoreInt32(&shuttingDown, 0)
+	h := newTestHealth()
+	h.Register("redis", ok)
+	ShutDown()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+	if w, g := http.StatusServiceUnavailable, rec.Code; w != g {
+		t.Errorf("want status code %d got %d", w, g)
+	}
+	if w, g := `"status":"shutting_down"`, rec.Body.String(); !strings.Contains(g, w) {
+		t.Errorf("want response to contain %s got %s", w, g)
+	}
+
+	// liveness does not depend on shutdown or checks
+	rec = httptest.NewRecorder()
+	h.Live().ServeHTTP(rec, httptest.NewRequest("GET", "/live", nil))
+	if w, g := http.StatusOK, rec.Code; w != g {
+		t.Errorf("want status code %d got %d", w, g)
+	}
+	if w, g := `{"status":"ok"}`, strings.TrimSpace(rec.Body.String()); w != g {
+		t.Errorf("want response %s got %s", w, g)
+	}
+}
@@ -0,0 +1,66 @@
+// Package httpserver constructs the http servers of the services, so that all
+// of them are protected against slow or misbehaving clients.
+package httpserver
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/middleware"
+	"github.com/rs/zerolog"
+)
+
+// Config configures the timeouts and limits of an http.Server. Zero values
+// disable the respective timeout; see http.Server for details.
+type Config struct {
+	ReadHeaderTimeout time.Duration // max time to read request headers
+	ReadTimeout       time.Duration // max time to read a request, including the body
+	WriteTimeout      time.Duration // max time from the end of the request headers to the end of the response
+	IdleTimeout       time.Duration // max time to wait for the next request of keep-alive connections
+	MaxHeaderBytes    int           // max size of request headers; zero defaults to http.DefaultMaxHeaderBytes
+	RequestTimeout    time.Duration // deadline of the context of requests
+	TLS               *tls.Config   // serves TLS if not nil
+	// AccessLogSampler samples the access log of requests; all are logged if nil
+	AccessLogSampler zerolog.Sampler
+}
+
+// DefaultConfig is the configuration of servers unless configured otherwise.
+// The write timeout exceeds the request timeout, so that handlers are able to
+// respond to requests which exceeded their deadline.
+var DefaultConfig = Config{
+	ReadHeaderTimeout: 5 * time.Second,
+	ReadTimeout:       10 * time.Second,
+	WriteTimeout:      15 * time.Second,
+	IdleTimeout:       120 * time.Second,
+	MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+	RequestTimeout:    10 * time.Second,
+}
+
+// New returns an http.Server serving h at addr. Requests are served with a
+// context deadline of cfg.RequestTimeout, which handlers may shorten.
+func New(addr string, h http.Handler, cfg Config) *http.Server {
+	if cfg.RequestTimeout > 0 {
+		h = middleware.NewTimeout(cfg.RequestTimeout)(h)
+	}
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		TLSConfig:         cfg.TLS,
+	}
+}
+
+// ListenAndServe listens on the address of s and serves TLS if s has a TLS
+// configuration, else plain http. The certificates are provided by the TLS
+// configuration.
+func ListenAndServe(s *http.Server) error {
+	if s.TLSConfig != nil {
+		return s.ListenAndServeTLS("", "")
+	}
+	return s.ListenAndServe()
+}
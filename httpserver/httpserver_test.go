@@ -0,0 +1,35 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	var ok bool
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok = r.Context().Deadline()
+	})
+	for _, tt := range []struct {
+		d string // description of test case
+		c Config // server config
+		k bool   // expect request deadline
+	}{
+		{d: "expect default config with request deadline", c: DefaultConfig, k: true},
+		{d: "expect no request deadline", c: Config{ReadTimeout: time.Second}},
+	} {
+		s := New(":0", h, tt.c)
+		if s.ReadHeaderTimeout != tt.c.ReadHeaderTimeout || s.ReadTimeout != tt.c.ReadTimeout ||
+			s.WriteTimeout != tt.c.WriteTimeout || s.IdleTimeout != tt.c.IdleTimeout ||
+			s.MaxHeaderBytes != tt.c.MaxHeaderBytes {
+			t.Errorf("%s: want server configured by %+v", tt.d, tt.c)
+		}
+		ok = false
+		s.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		if tt.k != ok {
+			t.Errorf("%s: want deadline %t got %t", tt.d, tt.k, ok)
+		}
+	}
+}
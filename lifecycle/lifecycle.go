@@ -0,0 +1,143 @@
+// Package lifecycle runs the components of a service, e.g. its http servers,
+// and shuts them down in order when the service is stopped.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/rs/zerolog"
+)
+
+// Component is a long-running part of a service.
+type Component interface {
+	// Run runs the component until it fails or is shut down. It returns nil
+	// once the component is shut down.
+	Run() error
+	// Shutdown stops the component gracefully. It must return when ctx is
+	// done.
+	Shutdown(ctx context.Context)
+}
+
+// Config configures the shutdown of a Group.
+type Config struct {
+	// DrainDelay is the time between marking the service as not ready and
+	// shutting down the components, so that load balancers stop routing
+	// requests to the service.
+	DrainDelay time.Duration
+	// ShutdownTimeout is the deadline of shutting down all components.
+	ShutdownTimeout time.Duration
+}
+
+type component struct {
+	name string
+	c    Component
+}
+
+// Group runs components and shuts them down in the order of registration.
+type Group struct {
+	cfg        Config
+	components []component
+	logger     zerolog.Logger
+	// drain marks the service as not ready; replaced by tests
+	drain func()
+}
+
+// New returns an empty Group.
+func New(cfg Config, logger zerolog.Logger) *Group {
+	return &Group{
+		cfg:    cfg,
+		logger: logger,
+		drain:  health.ShutDown,
+	}
+}
+
+// Register adds c to g. Components are shut down in the order they are
+// registered, e.g. http servers before the metrics server, so that the final
+// metrics are scraped.
+func (g *Group) Register(name string, c Component) {
+	g.components = append(g.components, component{name: name, c: c})
+}
+
+// Run runs all components until ctx is done, the process receives SIGINT or
+// SIGTERM, or a component stops on its own. Then the service is drained and
+// all components are shut down. Run returns the error of the first component
+// which failed, if any.
+func (g *Group) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	var (
+		mu     sync.Mutex
+		runErr error
+		wg     sync.WaitGroup
+	)
+	for _, c := range g.components {
+		wg.Add(1)
+		go func(c component) {
+			defer wg.Done()
+			err := c.c.Run()
+			if ctx.Err() != nil {
+				// shut down
+				return
+			}
+			if err == nil {
+				err = fmt.Errorf("%s stopped unexpectedly", c.name)
+			}
+			g.logger.Error().Err(err).Str("component", c.name).Msg("component failed; stopping service")
+			mu.Lock()
+			if runErr == nil {
+				runErr = err
+			}
+			mu.Unlock()
+			cancel()
+		}(c)
+	}
+
+	select {
+	case s := <-quit:
+		g.logger.Info().Str("signal", s.String()).Msg("stopping service")
+	case <-ctx.Done():
+	}
+	cancel()
+
+	// readiness checks fail from now on, but requests are still served until
+	// load balancers noticed
+	g.drain()
+	if g.cfg.DrainDelay > 0 {
+		g.logger.Info().Msgf("draining for %s", g.cfg.DrainDelay)
+		time.Sleep(g.cfg.DrainDelay)
+	}
+
+	sctx, scancel := context.WithTimeout(context.Background(), g.cfg.ShutdownTimeout)
+	defer scancel()
+	for _, c := range g.components {
+		g.logger.Info().Str("component", c.name).Msg("shutting down")
+		c.c.Shutdown(sctx)
+	}
+
+	// components which do not stop are abandoned
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-sctx.Done():
+		g.logger.Error().Msg("components did not stop in time")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return runErr
+}
@@ -0,0 +1,84 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// fakeComponent runs until it is shut down or fails with err.
+type fakeComponent struct {
+	name  string
+	err   error       // error of Run; nil runs until shut down
+	stop  chan error  // closed by Shutdown unless stuck
+	log   *[]string   // order of shutdowns
+	mu    *sync.Mutex // guards log
+	stuck bool        // ignores Shutdown
+}
+
+func (f *fakeComponent) Run() error {
+	if f.err != nil {
+		return f.err
+	}
+	return <-f.stop
+}
+
+func (f *fakeComponent) Shutdown(ctx context.Context) {
+	f.mu.Lock()
+	*f.log = append(*f.log, f.name)
+	f.mu.Unlock()
+	if !f.stuck {
+		close(f.stop)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	errFailed := errors.New("failed")
+	for _, tt := range []struct {
+		d string // description of test case
+		f string // name of failing component
+		s string // name of stuck component
+		c bool   // cancel context
+		e error  // expected error
+	}{
+		{d: "expect shutdown in order when context is done", c: true},
+		{d: "expect shutdown of all components when one fails", f: "metrics", e: errFailed},
+		{d: "expect shutdown to time out", s: "http", c: true},
+	} {
+		var (
+			log     []string
+			mu      sync.Mutex
+			drained bool
+		)
+		g := New(Config{ShutdownTimeout: 100 * time.Millisecond}, zerolog.New(ioutil.Discard))
+		g.drain = func() { drained = true }
+		for _, name := range []string{"http", "nsq", "metrics"} {
+			c := &fakeComponent{name: name, stop: make(chan error), log: &log, mu: &mu, stuck: name == tt.s}
+			if name == tt.f {
+				c.err = errFailed
+			}
+			g.Register(name, c)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		if tt.c {
+			cancel()
+		}
+		err := g.Run(ctx)
+		cancel()
+		if tt.e != err {
+			t.Errorf("%s: want error %v got %v", tt.d, tt.e, err)
+		}
+		if !drained {
+			t.Errorf("%s: want service drained", tt.d)
+		}
+		if w := []string{"http", "nsq", "metrics"}; !reflect.DeepEqual(w, log) {
+			t.Errorf("%s: want shutdown order %v got %v", tt.d, w, log)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package logging configures the loggers of the services. The levels of
+// loggers can be changed at runtime, per component of a service.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// formats of logs
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// Levels are the names of the supported log levels.
+var Levels = []string{"debug", "info", "warn", "error"}
+
+// Config configures the loggers of a service.
+type Config struct {
+	Format string // json or console; console is human friendly but inefficient
+	Level  string // min level of components without a level; one of Levels
+	// Levels are the comma separated min levels by component, e.g.
+	// `http=info,nsq=warn`
+	Levels string
+}
+
+// parseLevels parses comma separated levels of components.
+func parseLevels(s string) (map[string]zerolog.Level, error) {
+	levels := make(map[string]zerolog.Level)
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid log level %q; want component=level", kv)
+		}
+		l, err := parseLevel(kv[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		levels[kv[:i]] = l
+	}
+	return levels, nil
+}
+
+// parseLevel parses one of Levels.
+func parseLevel(s string) (zerolog.Level, error) {
+	for _, l := range Levels {
+		if s == l {
+			return zerolog.ParseLevel(s)
+		}
+	}
+	return zerolog.NoLevel, fmt.Errorf("unknown log level %q", s)
+}
+
+// Sampler returns a sampler which passes 1 of n debug and info events, or nil
+// if all events pass. Warnings and errors are never sampled.
+func Sampler(n uint32) zerolog.Sampler {
+	if n <= 1 {
+		return nil
+	}
+	s := &zerolog.BasicSampler{N: n}
+	return zerolog.LevelSampler{DebugSampler: s, InfoSampler: s}
+}
+
+// Loggers creates the loggers of a service and keeps the levels of its
+// components. It is safe for concurrent use by multiple goroutines.
+type Loggers struct {
+	out  io.Writer
+	base zerolog.Logger // without writer
+
+	mu     sync.RWMutex
+	level  zerolog.Level
+	levels map[string]zerolog.Level
+}
+
+// New returns the Loggers of service and version configured by cfg, which
+// write to stderr. The default level is debug unless configured otherwise. The
+// standard log is redirected to the default logger.
+func New(service, version string, cfg Config) (*Loggers, error) {
+	var out io.Writer
+	switch cfg.Format {
+	case FormatJSON:
+		out = os.Stderr
+	case FormatConsole, "":
+		out = zerolog.ConsoleWriter{Out: os.Stderr}
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	level := zerolog.DebugLevel
+	if cfg.Level != "" {
+		var err error
+		if level, err = parseLevel(cfg.Level); err != nil {
+			return nil, err
+		}
+	}
+	levels, err := parseLevels(cfg.Levels)
+	if err != nil {
+		return nil, err
+	}
+	l := &Loggers{
+		out: out,
+		base: zerolog.New(nil).With().
+			Timestamp().
+			Str("service", service).
+			Str("version", version).
+			Logger(),
+		level:  level,
+		levels: levels,
+	}
+	l.setGlobalLevel()
+	// replace standard log
+	log.SetFlags(0)
+	log.SetOutput(l.Logger())
+	return l, nil
+}
+
+// Logger returns the default logger, which is not part of a component.
+func (l *Loggers) Logger() zerolog.Logger {
+	return l.base.Output(&levelWriter{l: l, out: l.out})
+}
+
+// Component returns the logger of component, which adds the name of the
+// component to its events.
+func (l *Loggers) Component(component string) zerolog.Logger {
+	return l.base.Output(&levelWriter{l: l, out: l.out, component: component}).
+		With().
+		Str("component", component).
+		Logger()
+}
+
+// enabled reports whether events of the level are logged for component.
+func (l *Loggers) enabled(component string, level zerolog.Level) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	min, ok := l.levels[component]
+	if !ok {
+		min = l.level
+	}
+	return level >= min
+}
+
+// SetLevel sets the min level of component, or the default level if
+// component is empty. A component which is reset to the default level by
+// an empty level follows the default level again.
+func (l *Loggers) SetLevel(component, level string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if component != "" && level == "" {
+		delete(l.levels, component)
+		l.setGlobalLevel()
+		return nil
+	}
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	if component == "" {
+		l.level = lvl
+	} else {
+		l.levels[component] = lvl
+	}
+	l.setGlobalLevel()
+	return nil
+}
+
+// setGlobalLevel sets the global level of zerolog to the lowest level of all
+// components, so that events below it are discarded before they are built.
+// Events of components with a higher level are dropped by their levelWriter.
+// l.mu must be held.
+func (l *Loggers) setGlobalLevel() {
+	min := l.level
+	for _, lvl := range l.levels {
+		if lvl < min {
+			min = lvl
+		}
+	}
+	zerolog.SetGlobalLevel(min)
+}
+
+// LevelsReport is the response of the log level endpoint.
+type LevelsReport struct {
+	Level  string            `json:"level"`
+	Levels map[string]string `json:"levels"`
+}
+
+// report returns the current levels.
+func (l *Loggers) report() LevelsReport {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	r := LevelsReport{
+		Level:  l.level.String(),
+		Levels: make(map[string]string, len(l.levels)),
+	}
+	for c, lvl := range l.levels {
+		r.Levels[c] = lvl.String()
+	}
+	return r
+}
+
+// ServeHTTP responds with the levels of the loggers. PUT requests set the
+// level of the query parameter `component`, or the default level if not set,
+// to the query parameter `level`; see SetLevel.
+func (l *Loggers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		component, level := r.FormValue("component"), r.FormValue("level")
+		if err := l.SetLevel(component, level); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger := l.Logger()
+		logger.Info().Str("log_component", component).Str("log_level", level).Msg("log level changed")
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.report())
+}
+
+// levelWriter drops events below the current level of its component, so
+// that levels can be changed after loggers are created. It is the fallback of
+// the global level, which discards events below the lowest level of all
+// components only.
+type levelWriter struct {
+	l         *Loggers
+	out       io.Writer
+	component string
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	return w.out.Write(p)
+}
+
+func (w *levelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	// events without level, e.g. of the standard log, are always written
+	if level != zerolog.NoLevel && !w.l.enabled(w.component, level) {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
@@ -0,0 +1,175 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestNew(t *testing.T) {
+	for _, tt := range []struct {
+		d string // description of test case
+		c Config // config of loggers
+		e bool   // expect error
+	}{
+		{d: "expect defaults", c: Config{}},
+		{d: "expect json format", c: Config{Format: FormatJSON, Level: "info", Levels: "http=warn, nsq=error"}},
+		{d: "expect unknown format to fail", c: Config{Format: "xml"}, e: true},
+		{d: "expect unknown level to fail", c: Config{Level: "trace"}, e: true},
+		{d: "expect unknown component level to fail", c: Config{Levels: "http=verbose"}, e: true},
+		{d: "expect component level without component to fail", c: Config{Levels: "=info"}, e: true},
+	} {
+		_, err := New("test", "v1", tt.c)
+		if g := err != nil; tt.e != g {
+			t.Errorf("%s: want error %t got %v", tt.d, tt.e, err)
+		}
+	}
+}
+
+// newTestLoggers returns loggers of cfg writing json to buf.
+func newTestLoggers(t *testing.T, cfg Config, buf *bytes.Buffer) *Loggers {
+	cfg.Format = FormatJSON
+	l, err := New("test", "v1", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.out = buf
+	return l
+}
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLoggers(t, Config{Level: "info", Levels: "http=warn"}, &buf)
+	logger, h, n := l.Logger(), l.Component("http"), l.Component("nsq")
+	for _, tt := range []struct {
+		d string         // description of test case
+		c string         // component whose level is set before logging
+		v string         // level to set
+		l zerolog.Logger // logger to log by
+		w bool           // expect info event to be logged
+	}{
+		{d: "expect default level", l: logger, w: true},
+		{d: "expect level of component", l: h},
+		{d: "expect default level of component without level", l: n, w: true},
+		{d: "expect changed default level", v: "error", l: n},
+		{d: "expect changed level of component", c: "http", v: "debug", l: h, w: true},
+		{d: "expect reset level of component", c: "http", l: h},
+	} {
+		if tt.c != "" || tt.v != "" {
+			if err := l.SetLevel(tt.c, tt.v); err != nil {
+				t.Fatalf("%s: %v", tt.d, err)
+			}
+		}
+		buf.Reset()
+		tt.l.Info().Msg("test")
+		if g := buf.Len() > 0; tt.w != g {
+			t.Errorf("%s: want logged %t got %t", tt.d, tt.w, g)
+		}
+	}
+	if err := l.SetLevel("http", "verbose"); err == nil {
+		t.Error("want unknown level to fail")
+	}
+}
+
+func TestGlobalLevel(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	var buf bytes.Buffer
+	l := newTestLoggers(t, Config{Level: "warn", Levels: "http=info"}, &buf)
+	for _, tt := range []struct {
+		d string        // description of test case
+		c string        // component whose level is set
+		v string        // level to set
+		w zerolog.Level // expected global level
+	}{
+		{d: "expect lowest level of components", w: zerolog.InfoLevel},
+		{d: "expect lowered level of component", c: "nsq", v: "debug", w: zerolog.DebugLevel},
+		{d: "expect reset level of component", c: "nsq", w: zerolog.InfoLevel},
+		{d: "expect raised default level", v: "error", w: zerolog.InfoLevel},
+		{d: "expect raised level of component", c: "http", v: "error", w: zerolog.ErrorLevel},
+	} {
+		if tt.c != "" || tt.v != "" {
+			if err := l.SetLevel(tt.c, tt.v); err != nil {
+				t.Fatalf("%s: %v", tt.d, err)
+			}
+		}
+		if g := zerolog.GlobalLevel(); tt.w != g {
+			t.Errorf("%s: want global level %s got %s", tt.d, tt.w, g)
+		}
+	}
+}
+
+func TestComponent(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLoggers(t, Config{}, &buf)
+	logger := l.Component("http")
+	logger.Debug().Msg("test")
+	var e map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{"component": "http", "service": "test", "version": "v1", "level": "debug"} {
+		if g := e[k]; g != v {
+			t.Errorf("want %s %q got %v", k, v, g)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLoggers(t, Config{Level: "info"}, &buf)
+	for _, tt := range []struct {
+		d string       // description of test case
+		m string       // request method
+		q string       // request query
+		s int          // expected status code
+		r LevelsReport // expected report
+	}{
+		{d: "expect levels", m: "GET", s: http.StatusOK, r: LevelsReport{Level: "info", Levels: map[string]string{}}},
+		{d: "expect default level to be set", m: "PUT", q: "level=warn", s: http.StatusOK, r: LevelsReport{Level: "warn", Levels: map[string]string{}}},
+		{d: "expect level of component to be set", m: "PUT", q: "component=http&level=debug", s: http.StatusOK, r: LevelsReport{Level: "warn", Levels: map[string]string{"http": "debug"}}},
+		{d: "expect unknown level to fail", m: "PUT", q: "level=verbose", s: http.StatusBadRequest},
+		{d: "expect other methods to fail", m: "DELETE", s: http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest(tt.m, "/log/level?"+tt.q, nil))
+		if g := w.Code; tt.s != g {
+			t.Errorf("%s: want status code %d got %d", tt.d, tt.s, g)
+			continue
+		}
+		if tt.s != http.StatusOK {
+			continue
+		}
+		var g LevelsReport
+		if err := json.NewDecoder(w.Body).Decode(&g); err != nil {
+			t.Fatalf("%s: %v", tt.d, err)
+		}
+		want, _ := json.Marshal(tt.r)
+		got, _ := json.Marshal(g)
+		if string(want) != string(got) {
+			t.Errorf("%s: want %s got %s", tt.d, want, got)
+		}
+	}
+}
+
+func TestSampler(t *testing.T) {
+	if Sampler(0) != nil || Sampler(1) != nil {
+		t.Error("want no sampler of all events")
+	}
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).Sample(Sampler(3))
+	for i := 0; i < 6; i++ {
+		logger.Info().Msg("sampled")
+		logger.Error().Msg("kept")
+	}
+	if g := strings.Count(buf.String(), "sampled"); g != 2 {
+		t.Errorf("want 2 info events got %d", g)
+	}
+	if g := strings.Count(buf.String(), "kept"); g != 6 {
+		t.Errorf("want 6 error events got %d", g)
+	}
+}
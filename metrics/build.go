@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var buildInfoGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "build_info",
+		Help: "build of the service by service, version and go version; always 1",
+	},
+	[]string{"service", "version", "go_version"},
+)
+
+func init() {
+	prometheus.MustRegister(buildInfoGauge)
+}
+
+// SetBuildInfo exports the build of the service at version by the
+// build_info gauge.
+func SetBuildInfo(service, version string) {
+	buildInfoGauge.With(prometheus.Labels{
+		"service":    service,
+		"version":    version,
+		"go_version": runtime.Version(),
+	}).Set(1)
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"sort"
+
+	"github.com/afex/hystrix-go/hystrix"
+	metricCollector "github.com/afex/hystrix-go/hystrix/metric_collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	hystrixEventCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hystrix_events_total",
+			Help: "counts events of hystrix commands by command and event",
+		},
+		[]string{"command", "event"},
+	)
+	hystrixRunDuration = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:       "hystrix_run_duration_seconds",
+			Help:       "latency percentiles of hystrix commands by command",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+		[]string{"command"},
+	)
+	hystrixConcurrencyGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "hystrix_concurrency_in_use",
+			Help: "ratio of concurrent executions to max concurrent requests by command",
+		},
+		[]string{"command"},
+	)
+	hystrixCircuitOpenDesc = prometheus.NewDesc(
+		"hystrix_circuit_open",
+		"state of the circuit-breakers of hystrix commands; 1 is open, 0 is closed",
+		[]string{"command"}, nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(hystrixEventCounter)
+	prometheus.MustRegister(hystrixRunDuration)
+	prometheus.MustRegister(hystrixConcurrencyGauge)
+	prometheus.MustRegister(circuitCollector{})
+	metricCollector.Registry.Register(newHystrixCollector)
+}
+
+// hystrixCollector exports the results of hystrix command executions to
+// prometheus. It is registered with hystrix which creates one per command.
+type hystrixCollector struct {
+	command string
+}
+
+func newHystrixCollector(command string) metricCollector.MetricCollector {
+	return &hystrixCollector{command: command}
+}
+
+// Update counts the events of a command execution and observes its duration.
+func (c *hystrixCollector) Update(r metricCollector.MetricResult) {
+	for event, n := range map[string]float64{
+		"attempts":                  r.Attempts,
+		"errors":                    r.Errors,
+		"successes":                 r.Successes,
+		"failures":                  r.Failures,
+		"rejects":                   r.Rejects,
+		"short_circuits":            r.ShortCircuits,
+		"timeouts":                  r.Timeouts,
+		"fallback_successes":        r.FallbackSuccesses,
+		"fallback_failures":         r.FallbackFailures,
+		"context_canceled":          r.ContextCanceled,
+		"context_deadline_exceeded": r.ContextDeadlineExceeded,
+	} {
+		if n > 0 {
+			hystrixEventCounter.With(prometheus.Labels{"command": c.command, "event": event}).Add(n)
+		}
+	}
+	if r.Attempts > 0 {
+		hystrixRunDuration.With(prometheus.Labels{"command": c.command}).Observe(r.RunDuration.Seconds())
+	}
+	hystrixConcurrencyGauge.With(prometheus.Labels{"command": c.command}).Set(r.ConcurrencyInUse)
+}
+
+// Reset is a noop; prometheus counters must not decrease.
+func (c *hystrixCollector) Reset() {}
+
+// circuitCollector reports the state of the circuit-breakers of all
+// configured hystrix commands when scraped.
+type circuitCollector struct{}
+
+func (circuitCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hystrixCircuitOpenDesc
+}
+
+func (circuitCollector) Collect(ch chan<- prometheus.Metric) {
+	var commands []string
+	for command := range hystrix.GetCircuitSettings() {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		circuit, _, err := hystrix.GetCircuit(command)
+		if err != nil {
+			continue
+		}
+		var open float64
+		if circuit.IsOpen() {
+			open = 1
+		}
+		ch <- prometheus.MustNewConstMetric(hystrixCircuitOpenDesc, prometheus.GaugeValue, open, command)
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHystrixMetrics(t *testing.T) {
+	hystrix.ConfigureCommand("test_command", hystrix.CommandConfig{
+		RequestVolumeThreshold: 2,
+		ErrorPercentThreshold:  50,
+		SleepWindow:            60000,
+	})
+	// start with a closed circuit
+	hystrix.Flush()
+	counter := func(event string) prometheus.Counter {
+		return hystrixEventCounter.With(prometheus.Labels{"command": "test_command", "event": event})
+	}
+	events := map[string]float64{
+		"attempts":           3,
+		"failures":           2,
+		"short_circuits":     1,
+		"fallback_successes": 3,
+	}
+	before := make(map[string]float64)
+	for event := range events {
+		before[event] = testutil.ToFloat64(counter(event))
+	}
+
+	fail := func() error { return errors.New("failed") }
+	fallback := func(error) error { return nil }
+	for i := 0; i < 2; i++ {
+		hystrix.Do("test_command", fail, fallback)
+	}
+	// the circuit opens by too many errors, so the request is short-circuited;
+	// errors are reported asynchronously by hystrix
+	circuit, _, err := hystrix.GetCircuit("test_command")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !circuit.IsOpen() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	hystrix.Do("test_command", fail, fallback)
+
+	expected := `
+# HELP hystrix_circuit_open state of the circuit-breakers of hystrix commands; 1 is open, 0 is closed
+# TYPE hystrix_circuit_open gauge
+hystrix_circuit_open{command="test_command"} 1
+`
+	if err := testutil.CollectAndCompare(circuitCollector{}, strings.NewReader(expected), "hystrix_circuit_open"); err != nil {
+		t.Error(err)
+	}
+
+	deadline = time.Now().Add(time.Second)
+	for event, w := range events {
+		c := counter(event)
+		for testutil.ToFloat64(c)-before[event] != w && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if g := testutil.ToFloat64(c) - before[event]; w != g {
+			t.Errorf("event %s: want %.0f got %.0f", event, w, g)
+		}
+	}
+}
@@ -2,23 +2,31 @@ package metrics
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
 	"sync/atomic"
 	"time"
 
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/heetch/FabianG-technical-test/httpserver"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 )
 
-// MetricsServer provides an endpoint for a prometheus scraper.
+// MetricsServer provides an endpoint for a prometheus scraper and the event
+// stream of the hystrix dashboard.
 type MetricsServer struct {
 	cnt    uint64
 	srv    *http.Server
+	stream *hystrix.StreamHandler
 	logger zerolog.Logger
 }
 
-func New(addr string, logger zerolog.Logger) *MetricsServer {
+// New returns a MetricsServer listening on addr. It serves TLS if tlsCfg is
+// not nil.
+func New(addr string, tlsCfg *tls.Config, logger zerolog.Logger) *MetricsServer {
 	ms := &MetricsServer{
+		stream: hystrix.NewStreamHandler(),
 		logger: logger,
 	}
 	promHandler := promhttp.Handler()
@@ -29,18 +37,25 @@ func New(addr string, logger zerolog.Logger) *MetricsServer {
 		})
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", cntHandler)
-	ms.srv = &http.Server{
-		Addr:    addr,
-		Handler: mux,
-	}
+	// the stream must be started before serving requests
+	ms.stream.Start()
+	mux.Handle("/hystrix.stream", ms.stream)
+	// hystrix event streams are long-lived, so responses are not limited
+	cfg := httpserver.DefaultConfig
+	cfg.WriteTimeout = 0
+	cfg.RequestTimeout = 0
+	cfg.TLS = tlsCfg
+	ms.srv = httpserver.New(addr, mux, cfg)
 	return ms
 }
 
-func (ms *MetricsServer) Run() {
+// Run serves metrics until ms is shut down.
+func (ms *MetricsServer) Run() error {
 	ms.logger.Info().Msgf("metrics server listening on %s", ms.srv.Addr)
-	if err := ms.srv.ListenAndServe(); err != http.ErrServerClosed {
-		ms.logger.Fatal().Err(err).Msg("metrics server exited with error")
+	if err := httpserver.ListenAndServe(ms.srv); err != http.ErrServerClosed {
+		return err
 	}
+	return nil
 }
 
 func (ms *MetricsServer) Shutdown(ctx context.Context) {
@@ -65,7 +80,10 @@ LOOP:
 	}
 	t.Stop()
 	ms.logger.Info().Msg("shutting metrics server down")
+	ms.stream.Stop()
 	if err := ms.srv.Shutdown(ctx); err != nil {
 		ms.logger.Error().Err(err).Msg("metrics server shutdown error")
+		// hystrix event streams do not finish by themselves
+		ms.srv.Close()
 	}
 }
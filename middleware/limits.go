@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/handler"
+)
+
+// NewTimeout produces middleware that sets a deadline of d on the context of
+// requests. Handlers are expected to pass the context on, e.g. to hystrix
+// commands, so that requests are cancelled instead of piling up. An existing
+// earlier deadline is kept. A zero d disables the middleware.
+func NewTimeout(d time.Duration) Middleware {
+	if d <= 0 {
+		return nil
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// NewBodyLimit produces middleware that limits request bodies to n bytes.
+// Requests announcing a larger body get a http.StatusRequestEntityTooLarge
+// response right away; reading beyond n bytes of other requests fails with
+// handler.ErrBodyTooLarge. A zero n disables the middleware.
+func NewBodyLimit(n int64) Middleware {
+	if n <= 0 {
+		return nil
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				handler.WriteError(w, r, handler.ErrBodyTooLarge, http.StatusRequestEntityTooLarge)
+				return
+			}
+			if r.Body != nil {
+				// http.MaxBytesReader closes the connection once the limit
+				// is exceeded
+				r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, n), n: n}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitedBody translates the error of http.MaxBytesReader, which is not
+// exported, into handler.ErrBodyTooLarge.
+type limitedBody struct {
+	io.ReadCloser
+	n    int64 // limit
+	read int64 // bytes read
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.n {
+		err = handler.ErrBodyTooLarge
+	}
+	return n, err
+}
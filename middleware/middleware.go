@@ -1,13 +1,16 @@
 package middleware
 
 import (
-	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/heetch/FabianG-technical-test/auth"
 	"github.com/heetch/FabianG-technical-test/handler"
+	"github.com/heetch/FabianG-technical-test/tracing"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
@@ -28,16 +31,46 @@ func Use(h http.Handler, mws ...Middleware) http.Handler {
 	return h
 }
 
-// NewAuthCheck produces middleware that authenticates the client.
-func NewAuthCheck(token string) Middleware {
-	authToken := "Bearer " + token
+// errors of NewAuthCheck; details are logged only
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errForbidden    = errors.New("forbidden")
+)
+
+// NewAuthCheck produces middleware that authenticates clients by a and
+// authorizes them by rules on the mux variables of the request. Clients
+// without valid credentials get a http.StatusUnauthorized response and
+// unauthorized clients a http.StatusForbidden response. Requests with bodies
+// exceeding their limit get a http.StatusRequestEntityTooLarge response. The principal is added
+// to the request context and its subject to the request logger, so it must be
+// applied inside of the middleware of NewContextLog.
+func NewAuthCheck(a auth.Authenticator, rules ...auth.Rule) Middleware {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(authToken)) != 1 {
-				handler.WriteError(w, r, errors.New("Authentication is required"), http.StatusForbidden)
+			p, err := a.Authenticate(r)
+			// authenticators reading the body, e.g. of HMAC signatures, fail
+			// on bodies exceeding the limit of NewBodyLimit
+			if errors.Is(err, handler.ErrBodyTooLarge) {
+				handler.WriteError(w, r, handler.ErrBodyTooLarge, http.StatusRequestEntityTooLarge)
 				return
 			}
-			h.ServeHTTP(w, r)
+			if err != nil {
+				hlog.FromRequest(r).Debug().Err(err).Msg("authentication failed")
+				handler.WriteError(w, r, errUnauthorized, http.StatusUnauthorized)
+				return
+			}
+			hlog.FromRequest(r).UpdateContext(func(c zerolog.Context) zerolog.Context {
+				return c.Str("auth_method", p.Method).Str("auth_subject", p.Subject)
+			})
+			vars := mux.Vars(r)
+			for _, rule := range rules {
+				if err := rule.Check(p, vars); err != nil {
+					hlog.FromRequest(r).Debug().Err(err).Msg("authorization failed")
+					handler.WriteError(w, r, errForbidden, http.StatusForbidden)
+					return
+				}
+			}
+			h.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), p)))
 		})
 	}
 }
@@ -58,14 +91,20 @@ func NewRecoverHandler() Middleware {
 	}
 }
 
-// NewContextLog returns middleware that adds logger to request context.
-func NewContextLog(logger zerolog.Logger) []Middleware {
+// NewContextLog returns middleware that adds logger to request context. The
+// access log of requests is sampled by sampler unless it is nil; server errors
+// are always logged.
+func NewContextLog(logger zerolog.Logger, sampler zerolog.Sampler) []Middleware {
 	var mw []Middleware
-	mw = append(mw, hlog.NewHandler(logger))
-	// Install some provided extra handler to set some request's context fields.
-	// Thanks to those handler, all our logs will come with some pre-populated fields.
+	// The access log is written by the innermost handler, so that it is
+	// written by the logger of the request including all fields.
 	mw = append(mw, hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
-		hlog.FromRequest(r).Info().
+		l := hlog.FromRequest(r)
+		if sampler != nil && status < http.StatusInternalServerError {
+			sl := l.Sample(sampler)
+			l = &sl
+		}
+		l.Info().
 			Str("method", r.Method).
 			Str("url", r.URL.String()).
 			Int("status", status).
@@ -73,13 +112,47 @@ func NewContextLog(logger zerolog.Logger) []Middleware {
 			Dur("duration", duration).
 			Msg("")
 	}))
+	// Install some provided extra handler to set some request's context fields.
+	// Thanks to those handler, all our logs will come with some pre-populated fields.
 	mw = append(mw, hlog.RemoteAddrHandler("ip"))
 	mw = append(mw, hlog.UserAgentHandler("user_agent"))
 	mw = append(mw, hlog.RefererHandler("referer"))
 	mw = append(mw, hlog.RequestIDHandler("req_id", "Request-Id"))
+	// the logger is added to the request context first, i.e. by the
+	// outermost handler
+	mw = append(mw, hlog.NewHandler(logger))
 	return mw
 }
 
+// NewTracing returns middleware that handles requests within a server span.
+// The span is a child of the trace context of the request headers, if any,
+// and is named after the request method and route template. The trace ID is
+// added to the request logger, so it must be applied inside of the
+// middleware of NewContextLog.
+func NewTracing() Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := tracing.Extract(r.Context(), tracing.HeaderCarrier(r.Header))
+			route := routeTemplate(r)
+			ctx, span := tracing.Start(ctx, r.Method+" "+route, tracing.KindServer)
+			defer span.End()
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.route", route)
+
+			traceID := span.Context().TraceID.String()
+			hlog.FromRequest(r).UpdateContext(func(c zerolog.Context) zerolog.Context {
+				return c.Str("trace_id", traceID)
+			})
+			sw := newStatusResponseWriter(w)
+			h.ServeHTTP(sw, r.WithContext(ctx))
+			span.SetAttribute("http.status_code", fmt.Sprint(sw.status))
+			if sw.status >= http.StatusInternalServerError {
+				span.SetError(errors.New(http.StatusText(sw.status)))
+			}
+		})
+	}
+}
+
 type statusResponseWriter struct {
 	http.ResponseWriter
 	status int
@@ -90,7 +163,8 @@ func newStatusResponseWriter(rw http.ResponseWriter) *statusResponseWriter {
 	case *statusResponseWriter:
 		return v
 	default:
-		return &statusResponseWriter{ResponseWriter: rw}
+		// handlers which do not call WriteHeader respond with http.StatusOK
+		return &statusResponseWriter{ResponseWriter: rw, status: http.StatusOK}
 	}
 }
 
@@ -99,6 +173,49 @@ func (rw *statusResponseWriter) WriteHeader(status int) {
 	rw.ResponseWriter.WriteHeader(status)
 }
 
+// unmatchedRoute is the "path" label of requests without a mux route, so that
+// arbitrary URL paths do not create new time series.
+const unmatchedRoute = "unmatched"
+
+// routeTemplate returns the path template of the mux route matched by r
+// without variable patterns, e.g. "/drivers/{id}" for "/drivers/{id:[0-9]+}",
+// or unmatchedRoute.
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return unmatchedRoute
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return unmatchedRoute
+	}
+	return stripPatterns(tpl)
+}
+
+// stripPatterns removes the patterns of variables from the mux template tpl.
+// Braces within patterns are balanced, as required by mux.
+func stripPatterns(tpl string) string {
+	var b strings.Builder
+	depth, skip := 0, false
+	for _, c := range tpl {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				skip = false
+			}
+		case c == ':' && depth == 1:
+			skip = true
+		}
+		if !skip {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
 // MetricsConfig keeps metrics configuration for use by MetricsHandler.
 type MetricsConfig struct {
 	reqGauge *prometheus.GaugeVec
@@ -112,35 +229,41 @@ func NewMetricsConfig() *MetricsConfig {
 }
 
 // WithGauge adds gauge measuring how many requests are being handled at the
-// moment. "path" label is set to the URL path.
+// moment. "path" label is set to the route template and "method" label to the
+// request method.
 func (mc *MetricsConfig) WithGauge(gauge *prometheus.GaugeVec) *MetricsConfig {
 	mc.reqGauge = gauge
 	return mc
 }
 
 // WithCounter adds counter that is updated after processing every request.
-// "path" label is set to the URL path. "status_code" label is set on the
-// counter to the status code of the response
+// "path" label is set to the route template and "method" label to the
+// request method. "status_code" label is set on the counter to the status
+// code of the response
 func (mc *MetricsConfig) WithCounter(cnt *prometheus.CounterVec) *MetricsConfig {
 	mc.respCnt = cnt
 	return mc
 }
 
 // WithTimeHist adds histogram that measures distribution of the response
-// times. "path" label is set to the URL path. "status_code" label is set on
-// the counter to the status code of the response
+// times. "path" label is set to the route template and "method" label to the
+// request method. "status_code" label is set on the histogram to the status
+// code of the response
 func (mc *MetricsConfig) WithTimeHist(hist *prometheus.HistogramVec) *MetricsConfig {
 	mc.reqTime = hist
 	return mc
 }
 
-// NewMetricsHandler returns middleware that updates prometheus metrics.
+// NewMetricsHandler returns middleware that updates prometheus metrics. Note,
+// the path label is the template of the matched mux route rather than the URL
+// path to bound the number of time series; so the middleware must be applied
+// to handlers of a mux.Router.
 func NewMetricsHandler(mc *MetricsConfig) Middleware {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			startTime := time.Now()
 			sw := newStatusResponseWriter(w)
-			l := prometheus.Labels{"path": r.URL.Path}
+			l := prometheus.Labels{"path": routeTemplate(r), "method": r.Method}
 			if mc.reqGauge != nil {
 				mc.reqGauge.With(l).Inc()
 			}
@@ -0,0 +1,452 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/heetch/FabianG-technical-test/auth"
+	"github.com/heetch/FabianG-technical-test/handler"
+	"github.com/heetch/FabianG-technical-test/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+)
+
+func TestStripPatterns(t *testing.T) {
+	for _, tt := range []struct {
+		t string // mux template
+		r string // expected result
+	}{
+		{t: "/drivers", r: "/drivers"},
+		{t: "/drivers/{id}", r: "/drivers/{id}"},
+		{t: "/drivers/{id:[0-9]+}/locations", r: "/drivers/{id}/locations"},
+		{t: "/drivers/{id:[0-9]{1,5}}/{v:a|b}", r: "/drivers/{id}/{v}"},
+	} {
+		if w, g := tt.r, stripPatterns(tt.t); w != g {
+			t.Errorf("%s: want %s got %s", tt.t, w, g)
+		}
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_in_flight"}, []string{"path", "method"})
+	cnt := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total"}, []string{"path", "method", "status_code"})
+	hist := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_time"}, []string{"path", "method", "status_code"})
+	mc := NewMetricsConfig().WithGauge(gauge).WithCounter(cnt).WithTimeHist(hist)
+
+	var inFlight float64
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight = testutil.ToFloat64(gauge.WithLabelValues("/drivers/{id}", r.Method))
+		if mux.Vars(r)["id"] == "2" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	router := mux.NewRouter()
+	router.Handle("/drivers/{id:[0-9]+}", Use(h, NewMetricsHandler(mc)))
+
+	for _, id := range []string{"1", "2", "3"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/drivers/"+id, nil))
+	}
+	if w, g := 1.0, inFlight; w != g {
+		t.Errorf("want %v requests in flight got %v", w, g)
+	}
+	if w, g := 0.0, testutil.ToFloat64(gauge.WithLabelValues("/drivers/{id}", "GET")); w != g {
+		t.Errorf("want %v requests in flight after response got %v", w, g)
+	}
+	for _, tt := range []struct {
+		s string  // status code
+		c float64 // expected count
+	}{
+		{s: "200", c: 2},
+		{s: "404", c: 1},
+	} {
+		if w, g := tt.c, testutil.ToFloat64(cnt.WithLabelValues("/drivers/{id}", "GET", tt.s)); w != g {
+			t.Errorf("status code %s: want count %v got %v", tt.s, w, g)
+		}
+	}
+	// one time series per route, method and status code
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(cnt)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, g := 2, len(mfs[0].GetMetric()); w != g {
+		t.Errorf("want %d time series got %d", w, g)
+	}
+}
+
+func TestMetricsHandlerUnmatched(t *testing.T) {
+	cnt := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total"}, []string{"path", "method", "status_code"})
+	h := Use(http.NotFoundHandler(), NewMetricsHandler(NewMetricsConfig().WithCounter(cnt)))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/drivers/1", nil))
+	if w, g := 1.0, testutil.ToFloat64(cnt.WithLabelValues(unmatchedRoute, "POST", "404")); w != g {
+		t.Errorf("want count %v got %v", w, g)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	var got tracing.SpanContext
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = tracing.SpanContextFromContext(r.Context())
+	})
+	router := mux.NewRouter()
+	router.Handle("/drivers/{id:[0-9]+}", Use(h, NewTracing()))
+
+	req := httptest.NewRequest("GET", "/drivers/1", nil)
+	req.Header.Set(tracing.TraceparentKey, parent)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if w, g := "4bf92f3577b34da6a3ce929d0e0e4736", got.TraceID.String(); w != g {
+		t.Errorf("want trace ID %s got %s", w, g)
+	}
+	if g := got.SpanID.String(); g == "00f067aa0ba902b7" {
+		t.Error("want server span as child of the remote span")
+	}
+
+	// a request without trace context starts a new trace
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/drivers/1", nil))
+	if !got.IsValid() || got.TraceID.String() == "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("want new trace got %s", got.Traceparent())
+	}
+}
+
+func TestAuthCheck(t *testing.T) {
+	a := auth.NewAPIKeys(
+		auth.APIKey{ID: "driver-1", Key: "one", Claims: map[string]interface{}{"driver_id": "1"}},
+		auth.APIKey{ID: "ops", Key: "ops"},
+	)
+	var subject string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = auth.FromContext(r.Context()).Subject
+	})
+	router := mux.NewRouter()
+	router.Handle("/drivers/{id}/locations", Use(h, NewAuthCheck(a, auth.Rule{Var: "id", Claim: "driver_id"})))
+	router.Handle("/drivers", Use(h, NewAuthCheck(a)))
+
+	for _, tt := range []struct {
+		d string // description of test case
+		p string // request path
+		k string // API key
+		s int    // expected status code
+	}{
+		{d: "expect own location", p: "/drivers/1/locations", k: "one", s: http.StatusOK},
+		{d: "expect other driver to be forbidden", p: "/drivers/2/locations", k: "one", s: http.StatusForbidden},
+		{d: "expect key without claim to be forbidden", p: "/drivers/1/locations", k: "ops", s: http.StatusForbidden},
+		{d: "expect missing key to be unauthorized", p: "/drivers/1/locations", s: http.StatusUnauthorized},
+		{d: "expect invalid key to be unauthorized", p: "/drivers", k: "foo", s: http.StatusUnauthorized},
+		{d: "expect route without rule", p: "/drivers", k: "ops", s: http.StatusOK},
+	} {
+		subject = ""
+		r := httptest.NewRequest("PATCH", tt.p, nil)
+		if tt.k != "" {
+			r.Header.Set(auth.APIKeyHeader, tt.k)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if g := w.Code; tt.s != g {
+			t.Errorf("%s: want status code %d got %d", tt.d, tt.s, g)
+		}
+		if tt.s == http.StatusOK && subject == "" {
+			t.Errorf("%s: want principal in context", tt.d)
+		}
+	}
+}
+
+func TestAuthCheckBodyLimit(t *testing.T) {
+	secret := []byte("secret")
+	h := Use(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		NewAuthCheck(auth.NewHMAC(time.Minute, auth.HMACKey{ID: "app", Secret: secret})),
+		NewBodyLimit(4),
+	)
+	for _, tt := range []struct {
+		d string // description of test case
+		b string // request body
+		s int    // expected status code
+	}{
+		{d: "expect signed body within limit", b: "1234", s: http.StatusOK},
+		{d: "expect signed large body of unknown length to be too large", b: "12345", s: http.StatusRequestEntityTooLarge},
+	} {
+		r := httptest.NewRequest("PATCH", "/", strings.NewReader(tt.b))
+		if err := auth.Sign(r, "app", secret, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		r.ContentLength = -1
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if g := w.Code; tt.s != g {
+			t.Errorf("%s: want status code %d got %d", tt.d, tt.s, g)
+		}
+	}
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	now := time.Date(2019, 10, 15, 7, 0, 0, 0, time.UTC)
+	m := NewMemoryRateLimiter()
+	m.now = func() time.Time { return now }
+
+	// a burst of 2 then 1 request per 2 seconds
+	for i, tt := range []struct {
+		a time.Duration // time advanced before the request
+		k string        // key
+		o bool          // expect allowed
+		w time.Duration // expected wait
+	}{
+		{o: true},
+		{o: true},
+		{w: 2 * time.Second},
+		{k: "other", o: true},
+		{a: time.Second, w: time.Second},
+		{a: time.Second, o: true},
+		{w: 2 * time.Second},
+	} {
+		now = now.Add(tt.a)
+		key := "driver"
+		if tt.k != "" {
+			key = tt.k
+		}
+		ok, wait, err := m.Take(key, 0.5, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ok != tt.o || wait != tt.w {
+			t.Errorf("%d: want %t, %s got %t, %s", i, tt.o, tt.w, ok, wait)
+		}
+	}
+
+	// full buckets are removed
+	now = now.Add(sweepInterval + time.Second)
+	if _, _, err := m.Take("new", 0.5, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, g := 1, len(m.buckets); w != g {
+		t.Errorf("want %d buckets got %d", w, g)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	limited := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_rate_limited_total"}, []string{"path", "method", "limit"})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router := mux.NewRouter()
+	router.Handle("/drivers/{id:[0-9]+}/locations", Use(h, NewRateLimit(NewMemoryRateLimiter(), limited,
+		RateLimit{Name: "driver", Key: KeyByVar("id"), Rate: 0.1, Burst: 1},
+		RateLimit{Name: "ip", Key: KeyByIP, Rate: 0.1, Burst: 3},
+	)))
+
+	for i, tt := range []struct {
+		p string // request path
+		a string // remote address
+		s int    // expected status code
+	}{
+		{p: "/drivers/1/locations", a: "192.0.2.1:1234", s: http.StatusOK},
+		{p: "/drivers/1/locations", a: "192.0.2.2:1234", s: http.StatusTooManyRequests},
+		{p: "/drivers/2/locations", a: "192.0.2.1:1235", s: http.StatusOK},
+		{p: "/drivers/3/locations", a: "192.0.2.1:1236", s: http.StatusOK},
+		{p: "/drivers/4/locations", a: "192.0.2.1:1237", s: http.StatusTooManyRequests},
+	} {
+		r := httptest.NewRequest("PATCH", tt.p, nil)
+		r.RemoteAddr = tt.a
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if g := w.Code; tt.s != g {
+			t.Errorf("%d: want status code %d got %d", i, tt.s, g)
+		}
+		if tt.s == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "10" {
+			t.Errorf("%d: want Retry-After 10 got %q", i, w.Header().Get("Retry-After"))
+		}
+	}
+	for _, l := range []string{"driver", "ip"} {
+		if w, g := 1.0, testutil.ToFloat64(limited.WithLabelValues("/drivers/{id}/locations", "PATCH", l)); w != g {
+			t.Errorf("%s: want %v limited requests got %v", l, w, g)
+		}
+	}
+}
+
+func TestRateLimitRefund(t *testing.T) {
+	m := NewMemoryRateLimiter()
+	now := time.Date(2019, 10, 15, 7, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router := mux.NewRouter()
+	router.Handle("/drivers/{id:[0-9]+}/locations", Use(h, NewRateLimit(m, nil,
+		RateLimit{Name: "driver", Key: KeyByVar("id"), Rate: 0.1, Burst: 2},
+		RateLimit{Name: "ip", Key: KeyByIP, Rate: 0.1, Burst: 1},
+	)))
+
+	for i, tt := range []struct {
+		a string  // remote address
+		s int     // expected status code
+		t float64 // expected tokens of the driver bucket
+	}{
+		{a: "192.0.2.1:1234", s: http.StatusOK, t: 1},
+		// rejected by the ip limit; the driver token is refunded
+		{a: "192.0.2.1:1235", s: http.StatusTooManyRequests, t: 1},
+		{a: "192.0.2.2:1234", s: http.StatusOK, t: 0},
+		{a: "192.0.2.3:1234", s: http.StatusTooManyRequests, t: 0},
+	} {
+		r := httptest.NewRequest("PATCH", "/drivers/1/locations", nil)
+		r.RemoteAddr = tt.a
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if g := w.Code; tt.s != g {
+			t.Errorf("%d: want status code %d got %d", i, tt.s, g)
+		}
+		if w, g := tt.t, m.buckets["PATCH /drivers/{id}/locations:driver:1"].tokens; w != g {
+			t.Errorf("%d: want %v driver tokens got %v", i, w, g)
+		}
+	}
+	// refunds do not exceed the burst
+	if err := m.Refund("new", 0.1, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, g := 1.0, m.buckets["new"].tokens; w != g {
+		t.Errorf("want %v tokens got %v", w, g)
+	}
+}
+
+func TestRateLimitFailOpen(t *testing.T) {
+	r := &RedisRateLimiter{eval: func(keys []string, args ...interface{}) (interface{}, error) {
+		return nil, errors.New("connection refused")
+	}}
+	h := Use(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		NewRateLimit(r, nil, RateLimit{Name: "ip", Key: KeyByIP, Rate: 1, Burst: 1}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w, g := http.StatusOK, w.Code; w != g {
+		t.Errorf("want status code %d got %d", w, g)
+	}
+}
+
+func TestRedisRateLimiter(t *testing.T) {
+	for _, tt := range []struct {
+		res interface{}   // script result
+		ok  bool          // expect allowed
+		w   time.Duration // expected wait
+		err bool          // expect error
+	}{
+		{res: []interface{}{int64(1), "0"}, ok: true},
+		{res: []interface{}{int64(0), "1.5"}, w: 1500 * time.Millisecond},
+		{res: []interface{}{int64(0)}, err: true},
+		{res: []interface{}{int64(0), "x"}, err: true},
+	} {
+		r := &RedisRateLimiter{eval: func(keys []string, args ...interface{}) (interface{}, error) {
+			if w, g := "ratelimit:key", keys[0]; w != g {
+				t.Errorf("want key %s got %s", w, g)
+			}
+			return tt.res, nil
+		}}
+		ok, wait, err := r.Take("key", 1, 1)
+		if tt.err != (err != nil) {
+			t.Errorf("%v: want error %t got %v", tt.res, tt.err, err)
+			continue
+		}
+		if ok != tt.ok || wait != tt.w {
+			t.Errorf("%v: want %t, %s got %t, %s", tt.res, tt.ok, tt.w, ok, wait)
+		}
+	}
+
+	// refunds take a negative token
+	r := &RedisRateLimiter{eval: func(keys []string, args ...interface{}) (interface{}, error) {
+		if w, g := []interface{}{1.0, 1, -1}, args; !reflect.DeepEqual(w, g) {
+			t.Errorf("want args %v got %v", w, g)
+		}
+		return []interface{}{int64(1), "0"}, nil
+	}}
+	if err := r.Refund("key", 1, 1); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		d string        // description of test case
+		p time.Duration // deadline of parent context; zero for none
+		t time.Duration // timeout of middleware
+		w time.Duration // expected max remaining time
+	}{
+		{d: "expect deadline of timeout", t: time.Second, w: time.Second},
+		{d: "expect earlier deadline to be kept", p: time.Millisecond, t: time.Second, w: time.Millisecond},
+	} {
+		var deadline time.Time
+		var ok bool
+		h := Use(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deadline, ok = r.Context().Deadline()
+		}), NewTimeout(tt.t))
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.p > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), tt.p)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if !ok {
+			t.Fatalf("%s: want deadline", tt.d)
+		}
+		if g := time.Until(deadline); g > tt.w {
+			t.Errorf("%s: want deadline within %v got %v", tt.d, tt.w, g)
+		}
+	}
+	if NewTimeout(0) != nil {
+		t.Error("want zero timeout to disable middleware")
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	for _, tt := range []struct {
+		d string // description of test case
+		b string // request body
+		l int64  // content length; -1 for unknown
+		s int    // expected status code
+	}{
+		{d: "expect body within limit", b: "1234", l: 4, s: http.StatusOK},
+		{d: "expect announced large body to be rejected", b: "12345", l: 5, s: http.StatusRequestEntityTooLarge},
+		{d: "expect large body of unknown length to fail", b: "12345", l: -1, s: http.StatusRequestEntityTooLarge},
+		{d: "expect body of unknown length within limit", b: "12", l: -1, s: http.StatusOK},
+	} {
+		h := Use(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := ioutil.ReadAll(r.Body); err == handler.ErrBodyTooLarge {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}), NewBodyLimit(4))
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.b))
+		r.ContentLength = tt.l
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if g := w.Code; tt.s != g {
+			t.Errorf("%s: want status code %d got %d", tt.d, tt.s, g)
+		}
+	}
+}
+
+func TestContextLogSampling(t *testing.T) {
+	for _, tt := range []struct {
+		d string // description of test case
+		s int    // status code of responses
+		w int    // expected number of access logs of 4 requests
+	}{
+		{d: "expect access logs to be sampled", s: http.StatusOK, w: 2},
+		{d: "expect server errors to be logged", s: http.StatusBadGateway, w: 4},
+	} {
+		var buf bytes.Buffer
+		h := Use(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.s)
+		}), NewContextLog(zerolog.New(&buf), &zerolog.BasicSampler{N: 2})...)
+		for i := 0; i < 4; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}
+		if g := strings.Count(buf.String(), "\n"); tt.w != g {
+			t.Errorf("%s: want %d logs got %d", tt.d, tt.w, g)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/gorilla/mux"
+	"github.com/heetch/FabianG-technical-test/auth"
+	"github.com/heetch/FabianG-technical-test/handler"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/hlog"
+)
+
+// RateLimiter takes tokens from token buckets identified by key. A bucket
+// holds up to burst tokens and is refilled by rate tokens per second. It is
+// safe for concurrent use by multiple goroutines.
+type RateLimiter interface {
+	// Take takes a token from the bucket at key. If the bucket is empty, it
+	// returns false and the duration until a token is available.
+	Take(key string, rate float64, burst int) (bool, time.Duration, error)
+	// Refund returns a token to the bucket at key, e.g. if the request was
+	// rejected by another limit. The bucket holds at most burst tokens.
+	Refund(key string, rate float64, burst int) error
+}
+
+// bucket is a token bucket which was refilled at last and is full at full.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// take refills b at now and takes n tokens; a negative n refunds tokens. See
+// RateLimiter.
+func (b *bucket) take(now time.Time, rate float64, burst int, n float64) (bool, time.Duration) {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	ok, wait := false, time.Duration((n-b.tokens)/rate*float64(time.Second))
+	if b.tokens >= n {
+		b.tokens = math.Min(float64(burst), b.tokens-n)
+		ok, wait = true, 0
+	}
+	b.full = now.Add(time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second)))
+	return ok, wait
+}
+
+// sweepInterval is the interval at which MemoryRateLimiter removes full
+// buckets, which are equal to new buckets.
+const sweepInterval = time.Minute
+
+// MemoryRateLimiter keeps token buckets in memory, so limits apply per
+// process.
+type MemoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewMemoryRateLimiter returns an empty MemoryRateLimiter.
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryRateLimiter) Take(key string, rate float64, burst int) (bool, time.Duration, error) {
+	ok, wait := m.take(key, rate, burst, 1)
+	return ok, wait, nil
+}
+
+func (m *MemoryRateLimiter) Refund(key string, rate float64, burst int) error {
+	m.take(key, rate, burst, -1)
+	return nil
+}
+
+func (m *MemoryRateLimiter) take(key string, rate float64, burst int, n float64) (bool, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if now.Sub(m.swept) > sweepInterval {
+		for k, b := range m.buckets {
+			if !now.Before(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+		m.swept = now
+	}
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		m.buckets[key] = b
+	}
+	return b.take(now, rate, burst, n)
+}
+
+// rateLimitScript implements bucket.take in Redis; ARGV[3] is the number of
+// tokens to take, which is negative for refunds. The bucket is a hash of
+// tokens and the time of the last refill in microseconds. It expires once it
+// is full. The time of the Redis server is used, so that the clocks of
+// replicas do not matter.
+var rateLimitScript = redis.NewScript(`
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local b = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(b[1]) or burst
+local last = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) / 1000000 * rate)
+local wait = 0
+local ok = 0
+if tokens >= n then
+  tokens = math.min(burst, tokens - n)
+  ok = 1
+else
+  wait = (n - tokens) / rate
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "last", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {ok, tostring(wait)}
+`)
+
+// RedisRateLimiter keeps token buckets in Redis, so that limits apply to all
+// replicas of a service.
+type RedisRateLimiter struct {
+	eval func(keys []string, args ...interface{}) (interface{}, error)
+}
+
+// NewRedisRateLimiter returns a RedisRateLimiter connected to the instance
+// at addr. Keys are prefixed by "ratelimit:".
+func NewRedisRateLimiter(addr string) *RedisRateLimiter {
+	c := redis.NewClient(&redis.Options{Addr: addr})
+	return &RedisRateLimiter{
+		eval: func(keys []string, args ...interface{}) (interface{}, error) {
+			return rateLimitScript.Run(c, keys, args...).Result()
+		},
+	}
+}
+
+func (r *RedisRateLimiter) Take(key string, rate float64, burst int) (bool, time.Duration, error) {
+	res, err := r.eval([]string{"ratelimit:" + key}, rate, burst, 1)
+	if err != nil {
+		return false, 0, err
+	}
+	a, ok := res.([]interface{})
+	if !ok || len(a) != 2 {
+		return false, 0, errors.New("unexpected rate limit script result")
+	}
+	allowed, _ := a[0].(int64)
+	s, _ := a[1].(string)
+	wait, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed == 1, time.Duration(wait * float64(time.Second)), nil
+}
+
+func (r *RedisRateLimiter) Refund(key string, rate float64, burst int) error {
+	_, err := r.eval([]string{"ratelimit:" + key}, rate, burst, -1)
+	return err
+}
+
+// RateLimitKey returns the key of the client of a request for a rate limit.
+// Requests with an empty key are not limited.
+type RateLimitKey func(r *http.Request) string
+
+// KeyByVar returns a RateLimitKey of the mux variable name, e.g. the driver
+// ID.
+func KeyByVar(name string) RateLimitKey {
+	return func(r *http.Request) string {
+		return mux.Vars(r)[name]
+	}
+}
+
+// KeyByIP is a RateLimitKey of the IP address of the client. Forwarding
+// headers are ignored, since they are set by clients.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyBySubject is a RateLimitKey of the subject of the authenticated
+// principal, see NewAuthCheck.
+func KeyBySubject(r *http.Request) string {
+	p := auth.FromContext(r.Context())
+	if p == nil || p.Subject == "" {
+		return ""
+	}
+	return p.Method + ":" + p.Subject
+}
+
+// RateLimit limits requests to Rate per second with bursts of up to Burst
+// requests per key. Name identifies the limit in metrics and must be unique
+// per route.
+type RateLimit struct {
+	Name  string
+	Key   RateLimitKey
+	Rate  float64
+	Burst int
+}
+
+// errTooManyRequests is the error of rate limited requests
+var errTooManyRequests = errors.New("too_many_requests")
+
+// NewRateLimit returns middleware that responds with http.StatusTooManyRequests
+// and a Retry-After header to requests exceeding any of limits. Buckets are
+// kept per route and limit by l. Rate limited requests are counted by
+// limited, if not nil, labeled by the "path" (route template), "method" and
+// "limit" (name). Tokens taken by earlier limits are refunded if a later limit
+// rejects the request, so that rejected requests do not count. Requests are
+// allowed if l fails, so that the service stays available.
+func NewRateLimit(l RateLimiter, limited *prometheus.CounterVec, limits ...RateLimit) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := r.Method + " " + routeTemplate(r)
+			var taken []int // indices of limits with a taken token
+			keys := make([]string, len(limits))
+			for i, limit := range limits {
+				key := limit.Key(r)
+				if key == "" {
+					continue
+				}
+				keys[i] = route + ":" + limit.Name + ":" + key
+				ok, wait, err := l.Take(keys[i], limit.Rate, limit.Burst)
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Str("limit", limit.Name).Msg("rate limit failed")
+					continue
+				}
+				if ok {
+					taken = append(taken, i)
+					continue
+				}
+				for _, j := range taken {
+					if err := l.Refund(keys[j], limits[j].Rate, limits[j].Burst); err != nil {
+						hlog.FromRequest(r).Error().Err(err).Str("limit", limits[j].Name).Msg("rate limit refund failed")
+					}
+				}
+				if limited != nil {
+					limited.With(prometheus.Labels{
+						"path":   routeTemplate(r),
+						"method": r.Method,
+						"limit":  limit.Name,
+					}).Inc()
+				}
+				// round up, so that clients do not retry too early
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				handler.WriteError(w, r, errTooManyRequests, http.StatusTooManyRequests)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package testdata
+
+import (
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+// Track returns a synthetic track of location updates at locs, one every
+// interval with the last one at end.
+func Track(end time.Time, interval time.Duration, locs ...types.Location) []types.LocationUpdate {
+	track := make([]types.LocationUpdate, len(locs))
+	for i, l := range locs {
+		t := end.Add(-time.Duration(len(locs)-1-i) * interval)
+		track[i] = types.LocationUpdate{
+			UpdatedAt: t.UTC().Format(time.RFC3339),
+			Lat:       l.Lat,
+			Long:      l.Long,
+		}
+	}
+	return track
+}
+
+// Rounds returns the locations of driving the roundabout n times. Note, the
+// first and the last location of a round are equal.
+func Rounds(n int) []types.Location {
+	var locs []types.Location
+	for i := 0; i < n; i++ {
+		locs = append(locs, Locations...)
+	}
+	return locs
+}
+
+// Still returns n times the first location.
+func Still(n int) []types.Location {
+	locs := make([]types.Location, n)
+	for i := range locs {
+		locs[i] = Locations[0]
+	}
+	return locs
+}
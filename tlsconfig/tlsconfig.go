@@ -0,0 +1,201 @@
+// Package tlsconfig provides TLS configurations of servers and clients whose
+// certificates are reloaded from files when they change, so that certificates
+// can be rotated without restarting the services.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Config configures TLS by PEM files. If ClientAuth is set, servers require
+// client certificates signed by a CA of CAFile (mutual TLS). Clients verify
+// servers by the CAs of CAFile, or by the CAs of the system if empty.
+type Config struct {
+	CertFile   string
+	KeyFile    string
+	CAFile     string
+	ClientAuth bool
+}
+
+// Reloader holds the certificate and CAs of a Config and reloads them on
+// request. It is safe for concurrent use by multiple goroutines.
+type Reloader struct {
+	cfg    Config
+	logger zerolog.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate     // nil if CertFile is not set
+	pool    *x509.CertPool       // nil if CAFile is not set
+	modTime map[string]time.Time // of loaded files
+}
+
+// NewReloader validates cfg and loads its files.
+func NewReloader(cfg Config, logger zerolog.Logger) (*Reloader, error) {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("TLS certificate and key files must be set together")
+	}
+	if cfg.ClientAuth && (cfg.CertFile == "" || cfg.CAFile == "") {
+		return nil, errors.New("TLS client auth requires certificate and CA files")
+	}
+	r := &Reloader{
+		cfg:    cfg,
+		logger: logger,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the files of the configuration. If they are invalid, the
+// current certificate and CAs are kept.
+func (r *Reloader) Reload() error {
+	modTime := make(map[string]time.Time)
+	for _, f := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.CAFile} {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		modTime[f] = fi.ModTime()
+	}
+	var cert *tls.Certificate
+	if r.cfg.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+		if err != nil {
+			return err
+		}
+		cert = &c
+	}
+	var pool *x509.CertPool
+	if r.cfg.CAFile != "" {
+		b, err := ioutil.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("no certificates found in %s", r.cfg.CAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.pool, r.modTime = cert, pool, modTime
+	return nil
+}
+
+// changed reports whether a file was modified since it was loaded.
+func (r *Reloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for f, t := range r.modTime {
+		fi, err := os.Stat(f)
+		// files may be missing while they are replaced
+		if err == nil && !fi.ModTime().Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the files whenever they were modified, checking every
+// interval until the returned func is called. Failed reloads are logged.
+func (r *Reloader) Watch(interval time.Duration) (stop func()) {
+	t := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-t.C:
+				if !r.changed() {
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					r.logger.Error().Err(err).Msg("failed to reload TLS certificates")
+					continue
+				}
+				r.logger.Info().Msg("reloaded TLS certificates")
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		t.Stop()
+		close(done)
+	}
+}
+
+// current returns the certificate and CAs.
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, r.pool
+}
+
+// ServerConfig returns the TLS configuration of servers, or nil if no
+// certificate is configured. Reloaded certificates and CAs apply to new
+// connections.
+func (r *Reloader) ServerConfig() *tls.Config {
+	if r.cfg.CertFile == "" {
+		return nil
+	}
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+	}
+	if r.cfg.ClientAuth {
+		// client CAs cannot be looked up per handshake, so the config is
+		// replaced
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    pool,
+			}, nil
+		}
+	}
+	return cfg
+}
+
+// ClientConfig returns the TLS configuration of clients, or nil if neither a
+// certificate nor CAs are configured, so that clients use the defaults of
+// crypto/tls. The certificate, if configured, is presented to servers
+// requiring client certificates; reloaded certificates apply to new
+// connections. Servers are verified by the CAs loaded at the time of the
+// call, so changes of CAs apply to clients after a restart only.
+func (r *Reloader) ClientConfig() *tls.Config {
+	if r.cfg.CertFile == "" && r.cfg.CAFile == "" {
+		return nil
+	}
+	_, pool := r.current()
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			if cert == nil {
+				// no certificate is sent
+				return &tls.Certificate{}, nil
+			}
+			return cert, nil
+		},
+	}
+}
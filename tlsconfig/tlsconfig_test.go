@@ -0,0 +1,226 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// issue returns a certificate of cn signed by ca, or a self-signed CA
+// certificate if ca is nil.
+func issue(t *testing.T, cn string, serial int64, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if ca == nil {
+		tpl.IsCA, tpl.BasicConstraintsValid = true, true
+		tpl.KeyUsage = x509.KeyUsageCertSign
+		ca, caKey = tpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb})
+}
+
+// files writes the PEM files of a CA, a server and a client to dir.
+func files(t *testing.T, dir string, serial int64) (server, client Config) {
+	ca, caKey, caPEM, _ := issue(t, "ca", serial, nil, nil)
+	_, _, srvPEM, srvKey := issue(t, "server", serial+1, ca, caKey)
+	_, _, cliPEM, cliKey := issue(t, "client", serial+2, ca, caKey)
+	for name, b := range map[string][]byte{
+		"ca.pem": caPEM, "server.pem": srvPEM, "server-key.pem": srvKey, "client.pem": cliPEM, "client-key.pem": cliKey,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	caFile := filepath.Join(dir, "ca.pem")
+	return Config{CertFile: filepath.Join(dir, "server.pem"), KeyFile: filepath.Join(dir, "server-key.pem"), CAFile: caFile, ClientAuth: true},
+		Config{CertFile: filepath.Join(dir, "client.pem"), KeyFile: filepath.Join(dir, "client-key.pem"), CAFile: caFile}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srvCfg, cliCfg := files(t, dir, 1)
+	logger := zerolog.New(ioutil.Discard)
+	srvCerts, err := NewReloader(srvCfg, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cliCerts, err := NewReloader(cliCfg, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var serial int64
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serial = r.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}))
+	s.TLS = srvCerts.ServerConfig()
+	s.Config.ErrorLog = log.New(ioutil.Discard, "", 0) // mute handshake errors
+	s.StartTLS()
+	defer s.Close()
+
+	get := func(c *tls.Config) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: c, DisableKeepAlives: true}}
+		return client.Get(s.URL)
+	}
+	res, err := get(cliCerts.ClientConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if w, g := int64(3), serial; w != g {
+		t.Errorf("want client certificate %d got %d", w, g)
+	}
+	if w, g := int64(2), res.TLS.PeerCertificates[0].SerialNumber.Int64(); w != g {
+		t.Errorf("want server certificate %d got %d", w, g)
+	}
+
+	// clients without certificates are rejected
+	anonymous, err := NewReloader(Config{CAFile: cliCfg.CAFile}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := get(anonymous.ClientConfig()); err == nil {
+		t.Error("want error of client without certificate")
+	}
+
+	// rotate all certificates; clients keep the CAs they were created with
+	files(t, dir, 10)
+	if err := srvCerts.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cliCerts.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err = get(cliCerts.ClientConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if w, g := int64(12), serial; w != g {
+		t.Errorf("want reloaded client certificate %d got %d", w, g)
+	}
+	if w, g := int64(11), res.TLS.PeerCertificates[0].SerialNumber.Int64(); w != g {
+		t.Errorf("want reloaded server certificate %d got %d", w, g)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg, _ := files(t, dir, 1)
+	r, err := NewReloader(cfg, zerolog.New(ioutil.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer r.Watch(10 * time.Millisecond)()
+
+	// mod times may have a resolution of a second
+	files(t, dir, 10)
+	future := time.Now().Add(time.Minute)
+	for _, f := range []string{cfg.CertFile, cfg.KeyFile, cfg.CAFile} {
+		if err := os.Chtimes(f, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		cert, _ := r.current()
+		c, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.SerialNumber.Int64() == 11 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("want certificate to be reloaded")
+}
+
+func TestNewReloader(t *testing.T) {
+	for _, tt := range []struct {
+		d string // description of test case
+		c Config // TLS config
+	}{
+		{d: "expect error for certificate without key", c: Config{CertFile: "cert.pem"}},
+		{d: "expect error for client auth without CA", c: Config{CertFile: "cert.pem", KeyFile: "key.pem", ClientAuth: true}},
+		{d: "expect error for missing files", c: Config{CertFile: "cert.pem", KeyFile: "key.pem"}},
+	} {
+		if _, err := NewReloader(tt.c, zerolog.New(ioutil.Discard)); err == nil {
+			t.Errorf("%s: want error", tt.d)
+		}
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, cliCfg := files(t, dir, 1)
+
+	for _, tt := range []struct {
+		d string // description of test case
+		c Config // configuration of client
+		n bool   // expect nil config
+	}{
+		{d: "expect nil without certificate and CAs", n: true},
+		{d: "expect config with CAs", c: Config{CAFile: cliCfg.CAFile}},
+		{d: "expect config with certificate", c: Config{CertFile: cliCfg.CertFile, KeyFile: cliCfg.KeyFile}},
+	} {
+		r, err := NewReloader(tt.c, zerolog.Nop())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.d, err)
+		}
+		if w, g := tt.n, r.ClientConfig() == nil; w != g {
+			t.Errorf("%s: want nil config %t got %t", tt.d, w, g)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// reasons of spansDroppedCounter
+const (
+	dropQueueFull    = "queue_full"
+	dropExportFailed = "export_failed"
+)
+
+var spansDroppedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tracing_spans_dropped_total",
+		Help: "number of spans not exported by reason",
+	},
+	[]string{"reason"},
+)
+
+func init() {
+	prometheus.MustRegister(spansDroppedCounter)
+}
+
+// dropLogInterval is the min interval between logs of spans dropped since the
+// queue was full, so that an overloaded exporter does not flood the logs.
+const dropLogInterval = time.Minute
+
+// Exporter sends ended spans to a backend. Export must not block since it is
+// called on the request path.
+type Exporter interface {
+	Export(s SpanData)
+	// Shutdown flushes pending spans and stops the exporter.
+	Shutdown(ctx context.Context) error
+}
+
+// names of exporters of NewExporter
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterHTTP   = "http"
+)
+
+// NewExporter returns the exporter identified by name. The collector URL is
+// required by the http exporter only. The none exporter is nil.
+func NewExporter(name, collectorURL string, logger zerolog.Logger) (Exporter, error) {
+	switch name {
+	case ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return NewWriterExporter(os.Stdout), nil
+	case ExporterHTTP:
+		if collectorURL == "" {
+			return nil, fmt.Errorf("trace exporter %s requires a collector URL", name)
+		}
+		return NewHTTPExporter(collectorURL, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %s", name)
+	}
+}
+
+// WriterExporter writes spans as JSON lines.
+type WriterExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriterExporter returns a WriterExporter which writes to w.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+// Export writes s. Write errors are ignored.
+func (e *WriterExporter) Export(s SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(s)
+}
+
+// Shutdown does nothing since spans are written synchronously.
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// HTTPExporter posts batches of spans to an OpenTelemetry collector by
+// OTLP/HTTP with JSON encoding. Spans are dropped if the queue is full, so the
+// collector does not slow down requests.
+type HTTPExporter struct {
+	// spans dropped since the queue was full, not yet logged; first for the
+	// 64 bit alignment of atomic operations
+	dropped uint64
+
+	url       string
+	client    *http.Client
+	batchSize int
+	interval  time.Duration
+	logger    zerolog.Logger
+
+	queue chan SpanData
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// NewHTTPExporter returns a started HTTPExporter which posts to the traces
+// endpoint of the collector at url, e.g. http://localhost:4318.
+func NewHTTPExporter(url string, logger zerolog.Logger) *HTTPExporter {
+	e := &HTTPExporter{
+		url:       strings.TrimSuffix(url, "/") + otlpTracesPath,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		batchSize: 100,
+		interval:  time.Second,
+		logger:    logger.With().Str("component", "trace-exporter").Logger(),
+		queue:     make(chan SpanData, 2048),
+		done:      make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.run()
+	return e
+}
+
+// Export queues s to be sent with the next batch.
+func (e *HTTPExporter) Export(s SpanData) {
+	select {
+	case e.queue <- s:
+	default:
+		spansDroppedCounter.WithLabelValues(dropQueueFull).Inc()
+		atomic.AddUint64(&e.dropped, 1)
+	}
+}
+
+// Shutdown sends the queued spans and stops e. It returns ctx.Err() if ctx is
+// done first.
+func (e *HTTPExporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.done) })
+	stopped := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run sends a batch whenever it is full or the interval passed, until e is
+// shut down. Spans dropped since the queue was full are logged once per
+// dropLogInterval.
+func (e *HTTPExporter) run() {
+	defer e.wg.Done()
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+	dl := time.NewTicker(dropLogInterval)
+	defer dl.Stop()
+	defer e.logDropped()
+	batch := make([]SpanData, 0, e.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			spansDroppedCounter.WithLabelValues(dropExportFailed).Add(float64(len(batch)))
+			e.logger.Error().Err(err).Msgf("dropping %d spans", len(batch))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-t.C:
+			flush()
+		case <-dl.C:
+			e.logDropped()
+		case <-e.done:
+			for {
+				select {
+				case s := <-e.queue:
+					batch = append(batch, s)
+					if len(batch) >= e.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// logDropped logs the number of spans dropped since the queue was full, if
+// any, since the last call.
+func (e *HTTPExporter) logDropped() {
+	if n := atomic.SwapUint64(&e.dropped, 0); n > 0 {
+		e.logger.Warn().Uint64("dropped", n).Msg("dropped spans; queue is full")
+	}
+}
+
+func (e *HTTPExporter) send(batch []SpanData) error {
+	b, err := json.Marshal(newOTLPRequest(batch))
+	if err != nil {
+		return err
+	}
+	res, err := e.client.Post(e.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with status code %d", res.StatusCode)
+	}
+	return nil
+}
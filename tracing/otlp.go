@@ -0,0 +1,129 @@
+package tracing
+
+import (
+	"sort"
+	"strconv"
+)
+
+// The types below are the OTLP/JSON encoding of trace export requests, see
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto.
+// IDs are hex encoded and 64 bit integers are decimal strings, as required
+// by the JSON mapping of OTLP.
+
+// otlpTracesPath is the path of the OTLP/HTTP traces endpoint.
+const otlpTracesPath = "/v1/traces"
+
+// scopeName is the instrumentation scope of exported spans.
+const scopeName = "github.com/heetch/FabianG-technical-test/tracing"
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// codes of otlpStatus
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+// otlpKinds are the OTLP span kinds by Kind.
+var otlpKinds = map[Kind]int{
+	KindInternal: 1,
+	KindServer:   2,
+	KindClient:   3,
+	KindProducer: 4,
+	KindConsumer: 5,
+}
+
+// newOTLPRequest returns the export request of batch. Spans are grouped by
+// service, which is the resource of OTLP.
+func newOTLPRequest(batch []SpanData) otlpRequest {
+	var req otlpRequest
+	byService := make(map[string]int)
+	for _, s := range batch {
+		i, ok := byService[s.Service]
+		if !ok {
+			i = len(req.ResourceSpans)
+			byService[s.Service] = i
+			req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{{Key: "service.name", Value: otlpValue{StringValue: s.Service}}},
+				},
+				ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}}},
+			})
+		}
+		ss := &req.ResourceSpans[i].ScopeSpans[0]
+		ss.Spans = append(ss.Spans, newOTLPSpan(s))
+	}
+	return req
+}
+
+func newOTLPSpan(s SpanData) otlpSpan {
+	span := otlpSpan{
+		TraceID:           s.TraceID,
+		SpanID:            s.SpanID,
+		ParentSpanID:      s.ParentSpanID,
+		Name:              s.Name,
+		Kind:              otlpKinds[s.Kind],
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Status:            otlpStatus{Code: otlpStatusUnset},
+	}
+	// sorted for deterministic output
+	keys := make([]string, 0, len(s.Attributes))
+	for k := range s.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		span.Attributes = append(span.Attributes, otlpKeyValue{Key: k, Value: otlpValue{StringValue: s.Attributes[k]}})
+	}
+	if s.Error != "" {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: s.Error}
+	}
+	return span
+}
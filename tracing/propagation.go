@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// TraceparentKey is the key of the trace context in carriers.
+const TraceparentKey = "traceparent"
+
+// Carrier transports trace context across process boundaries, e.g. by HTTP
+// headers or message metadata.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// HeaderCarrier adapts http.Header to a Carrier.
+type HeaderCarrier http.Header
+
+// Get returns the first value of the header key.
+func (h HeaderCarrier) Get(key string) string {
+	return http.Header(h).Get(key)
+}
+
+// Set sets the header key to value.
+func (h HeaderCarrier) Set(key, value string) {
+	http.Header(h).Set(key, value)
+}
+
+// MapCarrier adapts a map to a Carrier.
+type MapCarrier map[string]string
+
+// Get returns the value of key.
+func (m MapCarrier) Get(key string) string {
+	return m[key]
+}
+
+// Set sets key to value.
+func (m MapCarrier) Set(key, value string) {
+	m[key] = value
+}
+
+// Inject sets the span context of ctx on c, if it is valid.
+func Inject(ctx context.Context, c Carrier) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		c.Set(TraceparentKey, sc.Traceparent())
+	}
+}
+
+// Extract returns a context with the remote span context of c. If c does not
+// carry a valid span context, ctx is returned.
+func Extract(ctx context.Context, c Carrier) context.Context {
+	sc, err := ParseTraceparent(c.Get(TraceparentKey))
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Transport is a http.RoundTripper which records client spans of requests and
+// propagates their span context to the server.
+type Transport struct {
+	// Base executes the requests; nil defaults to http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+// RoundTrip executes r within a client span. Note, the span ends when the
+// response headers are received.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := Start(r.Context(), "HTTP "+r.Method, KindClient)
+	defer span.End()
+	span.SetAttribute("http.method", r.Method)
+	span.SetAttribute("http.host", r.URL.Host)
+	span.SetAttribute("http.path", r.URL.Path)
+
+	// a RoundTripper must not modify the request
+	r = r.Clone(ctx)
+	Inject(ctx, HeaderCarrier(r.Header))
+	res, err := base.RoundTrip(r)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", strconv.Itoa(res.StatusCode))
+	if res.StatusCode >= http.StatusInternalServerError {
+		span.SetError(fmt.Errorf("status code %d", res.StatusCode))
+	}
+	return res, nil
+}
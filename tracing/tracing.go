@@ -0,0 +1,267 @@
+// Package tracing propagates trace context across services and records spans.
+// The trace context is propagated by the W3C traceparent format, see
+// https://www.w3.org/TR/trace-context/, so traces are compatible with
+// OpenTelemetry instrumented services. Spans are exported by the Exporter
+// configured by Init.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind describes the relationship of a span to its parent and children.
+type Kind string
+
+// kinds of spans
+const (
+	KindServer   Kind = "server"
+	KindClient   Kind = "client"
+	KindProducer Kind = "producer"
+	KindConsumer Kind = "consumer"
+	KindInternal Kind = "internal"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is the part of a span which is propagated to other services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether sc has a trace and a span ID.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent returns the W3C traceparent representation of sc, e.g.
+// `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+var errTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent parses the W3C traceparent s. Versions other than 00 are
+// parsed as version 00, as required by the specification.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return sc, errTraceparent
+	}
+	if _, err := hex.Decode(make([]byte, 1), []byte(parts[0])); err != nil {
+		return sc, errTraceparent
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, errTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, errTraceparent
+	}
+	flags := make([]byte, 1)
+	if _, err := hex.Decode(flags, []byte(parts[3])); err != nil {
+		return sc, errTraceparent
+	}
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return sc, errTraceparent
+	}
+	return sc, nil
+}
+
+// Span is a timed operation of a trace. It is safe for concurrent use by
+// multiple goroutines.
+type Span struct {
+	name   string
+	kind   Kind
+	sc     SpanContext
+	parent SpanID
+	start  time.Time
+
+	mu    sync.Mutex
+	attrs map[string]string
+	err   string
+	ended bool
+}
+
+// Context returns the span context of s.
+func (s *Span) Context() SpanContext {
+	return s.sc
+}
+
+// SetAttribute sets the attribute key of s to value.
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]string)
+	}
+	s.attrs[key] = value
+}
+
+// SetError marks s as failed by err. A nil err is ignored.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End completes s and exports it if it is sampled. Calls after the first one
+// are ignored.
+func (s *Span) End() {
+	end := time.Now()
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		TraceID:    s.sc.TraceID.String(),
+		SpanID:     s.sc.SpanID.String(),
+		Name:       s.name,
+		Kind:       s.kind,
+		Start:      s.start,
+		End:        end,
+		Duration:   float64(end.Sub(s.start)) / float64(time.Millisecond),
+		Attributes: s.attrs,
+		Error:      s.err,
+	}
+	s.mu.Unlock()
+	if s.parent != (SpanID{}) {
+		data.ParentSpanID = s.parent.String()
+	}
+	if !s.sc.Sampled {
+		return
+	}
+	global.mu.RLock()
+	defer global.mu.RUnlock()
+	if global.exp == nil {
+		return
+	}
+	data.Service = global.service
+	global.exp.Export(data)
+}
+
+// SpanData is the exported record of an ended span.
+type SpanData struct {
+	TraceID      string            `json:"trace_id"`
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	Service      string            `json:"service"`
+	Name         string            `json:"name"`
+	Kind         Kind              `json:"kind"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Duration     float64           `json:"duration_ms"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// global tracer configured by Init
+var global struct {
+	mu      sync.RWMutex
+	service string
+	exp     Exporter
+}
+
+// Init sets the service name recorded with spans and the exporter of ended
+// spans. A nil exp disables exporting, while trace context is still
+// propagated.
+func Init(service string, exp Exporter) {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	global.service = service
+	global.exp = exp
+}
+
+// Shutdown flushes and stops the exporter configured by Init.
+func Shutdown(ctx context.Context) error {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	if global.exp == nil {
+		return nil
+	}
+	err := global.exp.Shutdown(ctx)
+	global.exp = nil
+	return err
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// Start starts a span named name as a child of the span or remote span
+// context of ctx. Without a parent, the span starts a new sampled trace. The
+// returned context carries the new span.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	s := &Span{
+		name:  name,
+		kind:  kind,
+		start: time.Now(),
+	}
+	if parent := SpanContextFromContext(ctx); parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+		s.sc.Sampled = true
+	}
+	rand.Read(s.sc.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SpanFromContext returns the span of ctx or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanContextFromContext returns the span context of the span of ctx or the
+// remote span context of ctx. The result is not valid if there is neither.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// ContextWithRemoteSpanContext returns a context which carries the span
+// context sc of another service, so that spans started with it are children
+// of the remote span.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
@@ -0,0 +1,261 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+var traceparentTests = []struct {
+	d  string // description of test case
+	tp string // traceparent
+	ok bool   // expect valid
+	s  bool   // expect sampled
+}{
+	{
+		d:  "expect sampled",
+		tp: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		ok: true,
+		s:  true,
+	},
+	{
+		d:  "expect not sampled",
+		tp: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		ok: true,
+	},
+	{
+		d:  "expect future version with additional fields",
+		tp: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foo",
+		ok: true,
+		s:  true,
+	},
+	{
+		d:  "expect invalid version",
+		tp: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	},
+	{
+		d:  "expect additional fields of version 00 to be invalid",
+		tp: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foo",
+	},
+	{
+		d:  "expect zero trace ID to be invalid",
+		tp: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+	},
+	{
+		d:  "expect zero span ID to be invalid",
+		tp: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	},
+	{
+		d:  "expect non-hex trace ID to be invalid",
+		tp: "00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	},
+	{
+		d:  "expect short span ID to be invalid",
+		tp: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01",
+	},
+	{
+		d: "expect empty to be invalid",
+	},
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for _, tt := range traceparentTests {
+		sc, err := ParseTraceparent(tt.tp)
+		if w, g := tt.ok, err == nil; w != g {
+			t.Errorf("%s: want valid %t got %t", tt.d, w, g)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if w, g := tt.s, sc.Sampled; w != g {
+			t.Errorf("%s: want sampled %t got %t", tt.d, w, g)
+		}
+		if w, g := tt.tp[3:52], sc.Traceparent()[3:52]; w != g {
+			t.Errorf("%s: want IDs %s got %s", tt.d, w, g)
+		}
+	}
+}
+
+// recorder is an Exporter which keeps exported spans.
+type recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) Export(s SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *recorder) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestStart(t *testing.T) {
+	rec := &recorder{}
+	Init("test", rec)
+	defer Init("", nil)
+
+	ctx, root := Start(context.Background(), "root", KindServer)
+	_, child := Start(ctx, "child", KindClient)
+	child.SetAttribute("foo", "bar")
+	child.End()
+	root.End()
+	root.End() // ignored
+
+	if w, g := 2, len(rec.spans); w != g {
+		t.Fatalf("want %d spans got %d", w, g)
+	}
+	c, r := rec.spans[0], rec.spans[1]
+	if w, g := r.TraceID, c.TraceID; w != g {
+		t.Errorf("want trace ID %s got %s", w, g)
+	}
+	if w, g := r.SpanID, c.ParentSpanID; w != g {
+		t.Errorf("want parent span ID %s got %s", w, g)
+	}
+	if w, g := "", r.ParentSpanID; w != g {
+		t.Errorf("want no parent of root got %s", g)
+	}
+	if w, g := "bar", c.Attributes["foo"]; w != g {
+		t.Errorf("want attribute %s got %s", w, g)
+	}
+	if w, g := "test", c.Service; w != g {
+		t.Errorf("want service %s got %s", w, g)
+	}
+
+	// spans of traces which are not sampled are not exported
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, s := Start(ContextWithRemoteSpanContext(context.Background(), sc), "remote", KindServer)
+	s.End()
+	if w, g := 2, len(rec.spans); w != g {
+		t.Errorf("want %d spans got %d", w, g)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	ctx, span := Start(context.Background(), "producer", KindProducer)
+	m := MapCarrier{}
+	Inject(ctx, m)
+	if w, g := span.Context(), SpanContextFromContext(Extract(context.Background(), m)); w != g {
+		t.Errorf("want span context %+v got %+v", w, g)
+	}
+	// nothing to inject
+	h := http.Header{}
+	Inject(context.Background(), HeaderCarrier(h))
+	if g := h.Get(TraceparentKey); g != "" {
+		t.Errorf("want no traceparent got %s", g)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	rec := &recorder{}
+	Init("test", rec)
+	defer Init("", nil)
+
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(TraceparentKey)
+	}))
+	defer srv.Close()
+
+	ctx, parent := Start(context.Background(), "parent", KindServer)
+	req, err := http.NewRequest("GET", srv.URL+"/drivers/1", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := &http.Client{Transport: &Transport{}}
+	res, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if req.Header.Get(TraceparentKey) != "" {
+		t.Error("expect request to be unmodified")
+	}
+
+	if w, g := 1, len(rec.spans); w != g {
+		t.Fatalf("want %d spans got %d", w, g)
+	}
+	client := rec.spans[0]
+	if w, g := parent.Context().SpanID.String(), client.ParentSpanID; w != g {
+		t.Errorf("want parent span ID %s got %s", w, g)
+	}
+	if w, g := "00-"+client.TraceID+"-"+client.SpanID+"-01", got; w != g {
+		t.Errorf("want traceparent %s got %s", w, g)
+	}
+	if w, g := "200", client.Attributes["http.status_code"]; w != g {
+		t.Errorf("want status code %s got %s", w, g)
+	}
+}
+
+func TestHTTPExporter(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if w, g := otlpTracesPath, r.URL.Path; w != g {
+			t.Errorf("want path %s got %s", w, g)
+		}
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			svc := rs.Resource.Attributes[0].Value.StringValue
+			for _, s := range rs.ScopeSpans[0].Spans {
+				got = append(got, fmt.Sprintf("%s/%s/%d/%d", svc, s.Name, s.Kind, s.Status.Code))
+			}
+		}
+	}))
+	defer collector.Close()
+
+	e := NewHTTPExporter(collector.URL+"/", zerolog.Nop())
+	for _, s := range []SpanData{
+		{Service: "x", Name: "a", Kind: KindServer},
+		{Service: "y", Name: "b", Kind: KindClient, Error: "failed"},
+		{Service: "x", Name: "c", Kind: KindInternal},
+	} {
+		e.Export(s)
+	}
+	// shutdown sends queued spans
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if w, g := "x/a/2/0,x/c/1/0,y/b/3/2", strings.Join(got, ","); w != g {
+		t.Errorf("want spans %s got %s", w, g)
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	for _, tt := range []struct {
+		n   string // name of exporter
+		u   string // collector URL
+		err bool   // expect error
+	}{
+		{n: ExporterNone},
+		{n: ExporterStdout},
+		{n: ExporterHTTP, err: true},
+		{n: ExporterHTTP, u: "http://localhost:4318"},
+		{n: "jaeger", err: true},
+	} {
+		e, err := NewExporter(tt.n, tt.u, zerolog.Nop())
+		if w, g := tt.err, err != nil; w != g {
+			t.Errorf("%s: want error %t got %v", tt.n, w, err)
+		}
+		if e != nil {
+			e.Shutdown(context.Background())
+		}
+	}
+}
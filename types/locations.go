@@ -1,18 +1,91 @@
 package types
 
+import "encoding/json"
+
 type Location struct {
 	ID   string  `json:"id"`
 	Lat  float64 `json:"latitude"`
 	Long float64 `json:"longitude"`
 }
 
+// EnvelopeVersion is the schema version of envelopes written by producers.
+// Consumers reject envelopes of newer versions. Version 0 identifies
+// envelopes written before versioning, which carry metadata and payload only.
+const EnvelopeVersion = 1
+
+// types of envelope payloads
+const (
+	EventLocation = "location" // payload is a Location
+)
+
+// Envelope wraps the payload of a NSQ message with metadata of the event, so
+// that the format of messages can evolve. Legacy messages consist of the bare
+// payload.
+type Envelope struct {
+	ID          string            `json:"id"`      // unique event ID
+	Version     int               `json:"version"` // schema version of the envelope
+	Type        string            `json:"type"`    // type of the payload
+	Producer    string            `json:"producer"`
+	OccurredAt  string            `json:"occurred_at"`        // RFC3339Nano; e.g. when a location was received
+	PublishedAt string            `json:"published_at"`       // RFC3339Nano
+	Metadata    map[string]string `json:"metadata,omitempty"` // e.g. trace context
+	Payload     json.RawMessage   `json:"payload"`
+}
+
 type LocationUpdate struct {
 	UpdatedAt string  `json:"updated_at"` // RFC339
 	Lat       float64 `json:"latitude"`
 	Long      float64 `json:"longitude"`
 }
 
+// states of a driver determined by a zombie check
+const (
+	StateZombie  = "zombie"
+	StateActive  = "active"
+	StateUnknown = "unknown" // insufficient location updates; Zombie is false
+)
+
 type ZombieDriver struct {
-	ID     int64 `json:"id"`
-	Zombie bool  `json:"zombie"`
+	ID     int64   `json:"id"`
+	Zombie bool    `json:"zombie"`
+	Score  float64 `json:"score"` // probability of being a zombie from 0 to 1
+	State  string  `json:"state"`
+	Stale  bool    `json:"stale,omitempty"` // last verdict served as fallback
+}
+
+type Zombies struct {
+	ScannedAt string  `json:"scanned_at"` // RFC339
+	IDs       []int64 `json:"ids"`
+}
+
+type ZombieCheckRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+// ZombieCheck is the verdict for a single driver of a batch zombie check.
+// Either Zombie or Error is set.
+type ZombieCheck struct {
+	ID     int64    `json:"id"`
+	Zombie *bool    `json:"zombie,omitempty"`
+	Score  *float64 `json:"score,omitempty"`
+	State  string   `json:"state,omitempty"`
+	Stale  bool     `json:"stale,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+type ZombieCheckResponse struct {
+	Drivers []ZombieCheck `json:"drivers"`
+}
+
+// ZombieVerdict is the record of a zombie check for auditing.
+type ZombieVerdict struct {
+	ID        int64   `json:"id"`
+	Zombie    bool    `json:"zombie"`
+	Score     float64 `json:"score"`
+	State     string  `json:"state"`
+	CheckedAt string  `json:"checked_at"` // RFC3339
+	Radius    float64 `json:"radius"`     // meter
+	Window    int     `json:"window"`     // minutes
+	Threshold float64 `json:"threshold"`
+	Version   string  `json:"detector_version"`
 }
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Date(2019, 10, 15, 7, 0, 0, 0, time.UTC)
+	c := New(2, time.Second)
+	c.now = func() time.Time { return now }
+
+	c.Add("1", 1)
+	c.Add("2", 2)
+	// mark 1 as recently used
+	if v, ok := c.Get("1"); !ok || v.(int) != 1 {
+		t.Errorf("want 1 got %v", v)
+	}
+	// evicts 2
+	c.Add("3", 3)
+
+	var lruTests = []struct {
+		d string      // description of test case
+		k string      // key
+		v interface{} // expected value
+		o bool        // expected presence
+	}{
+		{d: "expect recently used entry", k: "1", v: 1, o: true},
+		{d: "expect least recently used entry to be evicted", k: "2", o: false},
+		{d: "expect new entry", k: "3", v: 3, o: true},
+		{d: "expect unknown key to miss", k: "4", o: false},
+	}
+	for _, tt := range lruTests {
+		v, ok := c.Get(tt.k)
+		if w, g := tt.o, ok; w != g {
+			t.Errorf("%s: want presence %t got %t", tt.d, w, g)
+		}
+		if w, g := tt.v, v; w != g {
+			t.Errorf("%s: want %v got %v", tt.d, w, g)
+		}
+	}
+	if w, g := 2, c.Len(); w != g {
+		t.Errorf("want len %d got %d", w, g)
+	}
+
+	// expire all entries
+	now = now.Add(time.Second)
+	if _, ok := c.Get("1"); ok {
+		t.Error("expect entry to be expired")
+	}
+	if w, g := 1, c.Len(); w != g {
+		t.Errorf("want len %d got %d", w, g)
+	}
+
+	// update refreshes ttl
+	c.Add("3", 4)
+	if v, ok := c.Get("3"); !ok || v.(int) != 4 {
+		t.Errorf("want 4 got %v", v)
+	}
+}
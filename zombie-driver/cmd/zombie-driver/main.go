@@ -1,12 +1,24 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"os"
+	"time"
 
-	"github.com/afex/hystrix-go/hystrix"
+	"github.com/heetch/FabianG-technical-test/admin"
+	"github.com/heetch/FabianG-technical-test/breaker"
+	"github.com/heetch/FabianG-technical-test/geo"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/httpserver"
+	"github.com/heetch/FabianG-technical-test/lifecycle"
+	"github.com/heetch/FabianG-technical-test/logging"
 	"github.com/heetch/FabianG-technical-test/metrics"
-	"github.com/heetch/FabianG-technical-test/zombie-driver/cmd/zombie-driver/cli"
+	"github.com/heetch/FabianG-technical-test/tlsconfig"
+	"github.com/heetch/FabianG-technical-test/tracing"
+	"github.com/heetch/FabianG-technical-test/zombie-driver/detector"
+	"github.com/heetch/FabianG-technical-test/zombie-driver/history"
 	"github.com/heetch/FabianG-technical-test/zombie-driver/server"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
@@ -17,10 +29,91 @@ var (
 	service           = kingpin.Flag("service", "service name").Envar("SERVICE").Default("zombie-driver").String()
 	httpAddr          = kingpin.Flag("http-addr", "address of HTTP server").Envar("HTTP_ADDR").Required().String()
 	metricsAddr       = kingpin.Flag("metrics-addr", "address of metrics server").Envar("METRICS_ADDR").Required().String()
-	driverLocationURL = kingpin.Flag("driver-location-url", "address of driver-location service").Envar("DRIVER_LOCATION_URL").Required().String()
-	zombieRadius      = kingpin.Flag("zombie-radius", "radius a zombie can move").Envar("ZOMBIE_RADIUS").Required().Float()
+	adminAddr         = kingpin.Flag("admin-addr", "address of admin server, e.g. 127.0.0.1:6060; disabled if empty").Envar("ADMIN_ADDR").String()
+	adminAllowRemote  = kingpin.Flag("admin-allow-remote", "allow --admin-addr not bound to localhost").Envar("ADMIN_ALLOW_REMOTE").Bool()
+	driverLocationURL = kingpin.Flag("driver-location-url", "base URL of driver-location service; may have a path prefix").Envar("DRIVER_LOCATION_URL").Required().String()
+	zombieRadius      = kingpin.Flag("zombie-radius", "radius a zombie can move in meters; must be positive").Envar("ZOMBIE_RADIUS").Required().Float()
 	zombieTime        = kingpin.Flag("zombie-time", "duration for fetching driver locations in minutes").Envar("ZOMBIE_TIME").Required().Int()
 
+	geodesic = kingpin.Flag("geodesic", "method of distance computation").Envar("GEODESIC").Default(geo.MethodHaversine).Enum(geo.MethodHaversine, geo.MethodVincenty, geo.MethodEquirectangular)
+
+	// zombie score
+	updateInterval = kingpin.Flag("update-interval", "expected interval of location updates in s; 0 ignores data density").Envar("UPDATE_INTERVAL").Default("10").Int()
+	scoreThreshold = kingpin.Flag("score-threshold", "score above which drivers are zombies").Envar("SCORE_THRESHOLD").Default("0.5").Float()
+
+	// insufficient data
+	minSamples  = kingpin.Flag("min-samples", "min location updates of a verdict; 0 disables").Envar("MIN_SAMPLES").Default("2").Int()
+	minCoverage = kingpin.Flag("min-coverage", "min fraction of zombie time spanned by location updates; 0 disables").Envar("MIN_COVERAGE").Default("0.2").Float()
+	maxAge      = kingpin.Flag("max-update-age", "max age of the latest location update of a verdict in s; 0 disables").Envar("MAX_UPDATE_AGE").Default("60").Int()
+
+	// zombie scanner
+	scanInterval = kingpin.Flag("scan-interval", "interval of zombie scans in s; 0 disables the scanner").Envar("SCAN_INTERVAL").Default("0").Int()
+
+	// batch checks
+	batchWorkers = kingpin.Flag("batch-workers", "concurrent driver checks per batch check or scan").Envar("BATCH_WORKERS").Default("10").Int()
+	batchTimeout = kingpin.Flag("batch-timeout", "deadline of a batch check in ms").Envar("BATCH_TIMEOUT").Default("2000").Int()
+	batchMaxIDs  = kingpin.Flag("batch-max-ids", "max number of drivers per batch check").Envar("BATCH_MAX_IDS").Default("1000").Int()
+
+	// location cache
+	cacheSize    = kingpin.Flag("cache-size", "max number of drivers in location cache; 0 disables the cache").Envar("CACHE_SIZE").Default("10000").Int()
+	cacheTTL     = kingpin.Flag("cache-ttl", "max age of cached locations in ms").Envar("CACHE_TTL").Default("1000").Int()
+	fetchTimeout = kingpin.Flag("fetch-timeout", "deadline of shared requests of locations to driver-location in ms").Envar("FETCH_TIMEOUT").Default("1000").Int()
+
+	// GPS noise filter
+	filterSort      = kingpin.Flag("filter-sort", "sort locations by update time").Envar("FILTER_SORT").Default("true").Bool()
+	filterDedup     = kingpin.Flag("filter-dedup", "drop duplicate locations").Envar("FILTER_DEDUP").Default("true").Bool()
+	filterMaxSpeed  = kingpin.Flag("filter-max-speed", "drop locations implying a higher speed in km/h; 0 disables").Envar("FILTER_MAX_SPEED").Default("250").Float()
+	filterSmoothing = kingpin.Flag("filter-smoothing", "points of moving average smoothing; 0 disables").Envar("FILTER_SMOOTHING").Default("0").Int()
+
+	// fallback if driver-location fails
+	fallback  = kingpin.Flag("fallback", "fallback of zombie checks if driver-location fails").Envar("FALLBACK").Default(server.FallbackClosed).Enum(server.FallbackClosed, server.FallbackOpen, server.FallbackStale)
+	staleSize = kingpin.Flag("stale-size", "max number of drivers with a stale verdict").Envar("STALE_SIZE").Default("10000").Int()
+	staleTTL  = kingpin.Flag("stale-ttl", "max age of stale verdicts in s").Envar("STALE_TTL").Default("600").Int()
+
+	// verdict history
+	historyStore      = kingpin.Flag("history-store", "store of the verdict history").Envar("HISTORY_STORE").Default("none").Enum("none", "memory", "redis")
+	historyRedisAddr  = kingpin.Flag("history-redis-addr", "address of redis history store").Envar("HISTORY_REDIS_ADDR").String()
+	historyRetention  = kingpin.Flag("history-retention", "retention of verdict history in h").Envar("HISTORY_RETENTION").Default("720").Int()
+	historyMaxDrivers = kingpin.Flag("history-max-drivers", "max number of drivers of memory history store").Envar("HISTORY_MAX_DRIVERS").Default("10000").Int()
+	historyQueueSize  = kingpin.Flag("history-queue-size", "max number of verdicts waiting to be recorded").Envar("HISTORY_QUEUE_SIZE").Default("1000").Int()
+
+	// circuit-breaker
+	breakerCfgPath = kingpin.Flag("breaker-cfg-file", "path to circuit-breaker config file").Envar("BREAKER_CFG_PATH").String()
+
+	// http server
+	httpReadHeaderTimeout = kingpin.Flag("http-read-header-timeout", "max duration of reading request headers in ms").Envar("HTTP_READ_HEADER_TIMEOUT").Default("5000").Int()
+	httpReadTimeout       = kingpin.Flag("http-read-timeout", "max duration of reading requests in ms").Envar("HTTP_READ_TIMEOUT").Default("10000").Int()
+	httpWriteTimeout      = kingpin.Flag("http-write-timeout", "max duration of writing responses in ms").Envar("HTTP_WRITE_TIMEOUT").Default("15000").Int()
+	httpIdleTimeout       = kingpin.Flag("http-idle-timeout", "max idle duration of keep-alive connections in ms").Envar("HTTP_IDLE_TIMEOUT").Default("120000").Int()
+	httpMaxHeaderBytes    = kingpin.Flag("http-max-header-bytes", "max size of request headers").Envar("HTTP_MAX_HEADER_BYTES").Default("1048576").Int()
+	requestTimeout        = kingpin.Flag("request-timeout", "deadline of requests in ms").Envar("REQUEST_TIMEOUT").Default("10000").Int()
+	maxBodyBytes          = kingpin.Flag("max-body-bytes", "max size of request bodies; 0 disables the limit").Envar("MAX_BODY_BYTES").Default("1048576").Int64()
+
+	// TLS
+	tlsCertFile       = kingpin.Flag("tls-cert-file", "path to TLS certificate; enables TLS of the HTTP server").Envar("TLS_CERT_FILE").String()
+	tlsKeyFile        = kingpin.Flag("tls-key-file", "path to TLS private key").Envar("TLS_KEY_FILE").String()
+	tlsCAFile         = kingpin.Flag("tls-ca-file", "path to CA certificates verifying clients and services; defaults to system CAs").Envar("TLS_CA_FILE").String()
+	tlsClientAuth     = kingpin.Flag("tls-client-auth", "require client certificates signed by the CAs (mutual TLS)").Envar("TLS_CLIENT_AUTH").Bool()
+	tlsMetrics        = kingpin.Flag("tls-metrics", "serve metrics and admin endpoints by TLS").Envar("TLS_METRICS").Bool()
+	tlsReloadInterval = kingpin.Flag("tls-reload-interval", "interval of checking TLS files for changes in ms").Envar("TLS_RELOAD_INTERVAL").Default("10000").Int()
+
+	// logging
+	logFormat       = kingpin.Flag("log-format", "format of logs").Envar("LOG_FORMAT").Default(logging.FormatConsole).Enum(logging.FormatJSON, logging.FormatConsole)
+	logLevel        = kingpin.Flag("log-level", "min level of logs").Envar("LOG_LEVEL").Default("debug").Enum(logging.Levels...)
+	logLevels       = kingpin.Flag("log-levels", "min levels of logs by component, e.g. http=info,nsq=warn").Envar("LOG_LEVELS").String()
+	logSampleAccess = kingpin.Flag("log-sample-access", "log 1 of n requests to the access log; server errors are always logged").Envar("LOG_SAMPLE_ACCESS").Default("1").Uint32()
+
+	// tracing
+	traceExporter     = kingpin.Flag("trace-exporter", "exporter of trace spans").Envar("TRACE_EXPORTER").Default(tracing.ExporterNone).Enum(tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterHTTP)
+	traceCollectorURL = kingpin.Flag("trace-collector-url", "URL of OTLP/HTTP trace collector of http exporter").Envar("TRACE_COLLECTOR_URL").String()
+
+	// health checks
+	healthTTL     = kingpin.Flag("health-ttl", "cache duration of health check results in ms").Envar("HEALTH_TTL").Default("2000").Int()
+	healthTimeout = kingpin.Flag("health-timeout", "timeout of health checks in ms").Envar("HEALTH_TIMEOUT").Default("1000").Int()
+
+	// readiness drain before the shutdown, e.g. while load balancers update
+	drainDelay = kingpin.Flag("drain-delay", "delay of shutdown after the service reports not ready in ms").Envar("DRAIN_DELAY").Default("0").Int()
+
 	// should be greater than prometheus scrape interval (default 30s); decreased in coding challenge
 	shutdownDelay = kingpin.Flag("shutdown-delay", "shutdown delay").Envar("SHUTDOWN_DELAY").Default("5000").Int()
 )
@@ -29,20 +122,163 @@ func main() {
 	kingpin.Version(version)
 	kingpin.Parse()
 
-	// configure circuit-breaker
-	hystrix.ConfigureCommand("driver_location", hystrix.CommandConfig{
-		Timeout:               1000, // ms
-		MaxConcurrentRequests: 200,
-		ErrorPercentThreshold: 25,
+	loggers, err := logging.New(*service, version, logging.Config{
+		Format: *logFormat,
+		Level:  *logLevel,
+		Levels: *logLevels,
 	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+		os.Exit(2)
+	}
+	logger := loggers.Logger()
+	metrics.SetBuildInfo(*service, version)
 
-	logger := cli.NewLogger(*service, version)
+	// configure circuit-breakers; settings are reloaded on SIGHUP
+	breakers, err := breaker.NewReloader(*breakerCfgPath, breaker.Config{
+		"driver_location": {
+			Timeout:               1000, // ms
+			MaxConcurrentRequests: 200,
+			ErrorPercentThreshold: 25,
+		},
+	}, loggers.Component("breaker"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+		os.Exit(2)
+	}
+	defer breakers.ReloadOnSignal()()
 
-	httpSrv, err := server.New(*httpAddr, *driverLocationURL, *zombieRadius, *zombieTime, logger)
+	// certificates are reloaded when their files change
+	certs, err := tlsconfig.NewReloader(tlsconfig.Config{
+		CertFile:   *tlsCertFile,
+		KeyFile:    *tlsKeyFile,
+		CAFile:     *tlsCAFile,
+		ClientAuth: *tlsClientAuth,
+	}, loggers.Component("tls"))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
 		os.Exit(2)
 	}
-	metricsSrv := metrics.New(*metricsAddr, logger)
-	cli.RunServer(httpSrv, metricsSrv, *shutdownDelay)
+	defer certs.Watch(time.Duration(*tlsReloadInterval) * time.Millisecond)()
+	var metricsTLS *tls.Config
+	if *tlsMetrics {
+		if metricsTLS = certs.ServerConfig(); metricsTLS == nil {
+			fmt.Fprintf(os.Stderr, "%s service: TLS of metrics requires a certificate\n", *service)
+			os.Exit(2)
+		}
+	}
+
+	// spans are exported on a best effort basis; trace context is propagated
+	// regardless of the exporter
+	exp, err := tracing.NewExporter(*traceExporter, *traceCollectorURL, loggers.Component("tracing"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+		os.Exit(2)
+	}
+	tracing.Init(*service, exp)
+	defer tracing.Shutdown(context.Background())
+
+	if *scoreThreshold < 0 || *scoreThreshold >= 1 {
+		fmt.Fprintf(os.Stderr, "%s service: score threshold must be in [0, 1)\n", *service)
+		os.Exit(2)
+	}
+	dist, err := geo.Method(*geodesic)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+		os.Exit(2)
+	}
+	var hs history.Store
+	retention := time.Duration(*historyRetention) * time.Hour
+	switch *historyStore {
+	case "memory":
+		hs = history.NewMemory(retention, *historyMaxDrivers)
+	case "redis":
+		if *historyRedisAddr == "" {
+			fmt.Fprintf(os.Stderr, "%s service: history redis address required\n", *service)
+			os.Exit(2)
+		}
+		hs = history.NewRedis(*historyRedisAddr, retention)
+	}
+	if *minCoverage < 0 || *minCoverage > 1 {
+		fmt.Fprintf(os.Stderr, "%s service: min coverage must be in [0, 1]\n", *service)
+		os.Exit(2)
+	}
+	cfg := &server.Config{
+		DriverLocationURL: *driverLocationURL,
+		ZombieRadius:      *zombieRadius,
+		ZombieTime:        *zombieTime,
+		ScanInterval:      time.Duration(*scanInterval) * time.Second,
+		BatchWorkers:      *batchWorkers,
+		BatchTimeout:      time.Duration(*batchTimeout) * time.Millisecond,
+		BatchMaxIDs:       *batchMaxIDs,
+		CacheSize:         *cacheSize,
+		CacheTTL:          time.Duration(*cacheTTL) * time.Millisecond,
+		FetchTimeout:      time.Duration(*fetchTimeout) * time.Millisecond,
+		UpdateInterval:    time.Duration(*updateInterval) * time.Second,
+		ScoreThreshold:    *scoreThreshold,
+		MinSamples:        *minSamples,
+		MinCoverage:       *minCoverage,
+		MaxUpdateAge:      time.Duration(*maxAge) * time.Second,
+		Filter: detector.FilterConfig{
+			Sort:      *filterSort,
+			Dedup:     *filterDedup,
+			MaxSpeed:  *filterMaxSpeed,
+			Smoothing: *filterSmoothing,
+		},
+		Geodesic:         dist,
+		History:          hs,
+		HistoryQueueSize: *historyQueueSize,
+		Fallback:         *fallback,
+		StaleSize:        *staleSize,
+		StaleTTL:         time.Duration(*staleTTL) * time.Second,
+
+		MaxBodyBytes: *maxBodyBytes,
+		ClientTLS:    certs.ClientConfig(),
+	}
+	hc := health.New(time.Duration(*healthTTL)*time.Millisecond, time.Duration(*healthTimeout)*time.Millisecond)
+	srvCfg := httpserver.Config{
+		ReadHeaderTimeout: time.Duration(*httpReadHeaderTimeout) * time.Millisecond,
+		ReadTimeout:       time.Duration(*httpReadTimeout) * time.Millisecond,
+		WriteTimeout:      time.Duration(*httpWriteTimeout) * time.Millisecond,
+		IdleTimeout:       time.Duration(*httpIdleTimeout) * time.Millisecond,
+		MaxHeaderBytes:    *httpMaxHeaderBytes,
+		RequestTimeout:    time.Duration(*requestTimeout) * time.Millisecond,
+		TLS:               certs.ServerConfig(),
+		AccessLogSampler:  logging.Sampler(*logSampleAccess),
+	}
+	httpSrv, err := server.New(*httpAddr, srvCfg, cfg, hc, loggers.Component("http"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+		os.Exit(2)
+	}
+	metricsSrv := metrics.New(*metricsAddr, metricsTLS, loggers.Component("metrics"))
+	// the http server is shut down first, so that its final metrics are
+	// scraped
+	lc := lifecycle.New(lifecycle.Config{
+		DrainDelay:      time.Duration(*drainDelay) * time.Millisecond,
+		ShutdownTimeout: time.Duration(*shutdownDelay) * time.Millisecond,
+	}, logger)
+	lc.Register("http", httpSrv)
+	lc.Register("metrics", metricsSrv)
+	if *adminAddr != "" {
+		adminSrv, err := admin.New(*adminAddr, admin.Config{
+			Service:     *service,
+			Version:     version,
+			Config:      map[string]interface{}{"flags": admin.Flags(kingpin.CommandLine)},
+			TLS:         metricsTLS,
+			AllowRemote: *adminAllowRemote,
+		}, loggers.Component("admin"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s service: %v\n", *service, err)
+			os.Exit(2)
+		}
+		// log levels are changed at runtime by PUT /log/level?component=http&level=info
+		adminSrv.Handle("/log/level", loggers)
+		lc.Register("admin", adminSrv)
+	}
+	if err := lc.Run(context.Background()); err != nil {
+		// deferred funcs do not run on exit
+		tracing.Shutdown(context.Background())
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,239 @@
+package detector
+
+import (
+	"math"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/geo"
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+// Version identifies the detection algorithm. It is recorded with each verdict
+// and must be increased whenever the scoring or filtering changes results.
+const Version = "3"
+
+// Config represents the configuration of a Detector.
+type Config struct {
+	Radius    float64       // meter; must be positive
+	Window    time.Duration // period of location updates to consider
+	Interval  time.Duration // expected interval of location updates; zero ignores data density
+	Threshold float64       // score above which drivers are zombies; zero defaults to 0.5
+	// min number of location updates after filtering; zero disables
+	MinSamples int
+	// min fraction of the window spanned by location updates; zero disables
+	MinCoverage float64
+	// max age of the latest location update; zero disables
+	MaxAge   time.Duration
+	Filter   FilterConfig
+	Geodesic geo.DistanceFunc // nil defaults to geo.Haversine
+}
+
+// Detector determines if a driver is a zombie by the distance she moved within
+// a period of time.
+type Detector struct {
+	Radius      float64 // km
+	Window      time.Duration
+	Interval    time.Duration
+	Threshold   float64
+	MinSamples  int
+	MinCoverage float64
+	MaxAge      time.Duration
+	Filter      Filter // applied to location updates before computing distances
+	Geodesic    geo.DistanceFunc
+}
+
+// New returns a Detector configured by cfg.
+func New(cfg Config) *Detector {
+	threshold := cfg.Threshold
+	if threshold == 0 {
+		threshold = 0.5
+	}
+	geodesic := cfg.Geodesic
+	if geodesic == nil {
+		geodesic = geo.Haversine
+	}
+	return &Detector{
+		Radius:      cfg.Radius / 1000.0, // m to km
+		Window:      cfg.Window,
+		Interval:    cfg.Interval,
+		Threshold:   threshold,
+		MinSamples:  cfg.MinSamples,
+		MinCoverage: cfg.MinCoverage,
+		MaxAge:      cfg.MaxAge,
+		Filter:      NewFilter(cfg.Filter),
+		Geodesic:    geodesic,
+	}
+}
+
+// Verdict is the result of a zombie detection.
+type Verdict struct {
+	Zombie   bool
+	Unknown  bool    // insufficient location updates to decide
+	Score    float64 // probability of being a zombie from 0 to 1
+	Distance float64 // km
+	Coverage float64 // fraction of the window spanned by location updates
+}
+
+// Detect scores the given location updates at time now and reports whether
+// the score exceeds the threshold of d. If there are fewer location updates
+// than the min samples of d, they span less than the min coverage of the
+// window or the latest of them is older than the max age of d, the verdict is
+// unknown with a score of 0.5 and no zombie. Note,
+// without a sort stage in the filter of d, we rely on locations being sorted
+// by update time, either de- or ascending.
+func (d *Detector) Detect(locs []types.LocationUpdate, now time.Time) Verdict {
+	track := d.Filter.Apply(locs)
+	dist := Distance(d.Geodesic, track)
+	cov := d.coverage(track)
+	if len(track) < d.MinSamples || cov < d.MinCoverage || d.outdated(track, now) {
+		return Verdict{
+			Unknown:  true,
+			Score:    0.5,
+			Distance: dist,
+			Coverage: cov,
+		}
+	}
+	score := d.score(track, dist, now)
+	return Verdict{
+		Zombie:   score > d.Threshold,
+		Score:    score,
+		Distance: dist,
+		Coverage: cov,
+	}
+}
+
+// outdated reports whether the latest location update of track is older than
+// the max age of d at time now. Tracks without valid update times are
+// outdated.
+func (d *Detector) outdated(track []types.LocationUpdate, now time.Time) bool {
+	if d.MaxAge <= 0 {
+		return false
+	}
+	last, ok := latest(track)
+	return !ok || now.Sub(last) > d.MaxAge
+}
+
+// coverage returns the period between the earliest and the latest location
+// update of track relative to the window, at most 1.
+func (d *Detector) coverage(track []types.LocationUpdate) float64 {
+	if d.Window <= 0 {
+		return 1
+	}
+	var first, last time.Time
+	var found bool
+	for _, l := range track {
+		t, ok := updatedAt(l)
+		if !ok {
+			continue
+		}
+		if !found || t.Before(first) {
+			first = t
+		}
+		if !found || t.After(last) {
+			last = t
+		}
+		found = true
+	}
+	return clamp(float64(last.Sub(first)) / float64(d.Window))
+}
+
+// score combines the evidence of track being a zombie with the confidence in
+// the data. The evidence is based on the ratio of the distance moved to the
+// zombie radius; a distance of the radius results in an evidence of 0.5. It
+// decreases if the driver moved significantly recently. The confidence is
+// based on data density and update recency. A low confidence pulls the score
+// towards 0, i.e. drivers are not judged zombies on sparse or outdated data.
+// The score is rounded to three decimals.
+func (d *Detector) score(track []types.LocationUpdate, dist float64, now time.Time) float64 {
+	if len(track) == 0 {
+		return 0
+	}
+	evidence := 1 / (1 + dist/d.Radius)
+	evidence *= 0.5 + 0.5*d.stillness(track)
+	confidence := d.density(track) * d.recency(track, now)
+	score := evidence * confidence
+	return math.Round(score*1000) / 1000
+}
+
+// density returns the ratio of location updates to the expected number of
+// updates within the window, at most 1.
+func (d *Detector) density(track []types.LocationUpdate) float64 {
+	if d.Interval <= 0 || d.Window <= 0 {
+		return 1
+	}
+	expected := float64(d.Window / d.Interval)
+	if expected < 1 {
+		return 1
+	}
+	return clamp(float64(len(track)) / expected)
+}
+
+// recency decreases linearly from 1 to 0 with the age of the latest location
+// update. Updates within the expected interval are considered to be recent.
+func (d *Detector) recency(track []types.LocationUpdate, now time.Time) float64 {
+	if d.Window <= 0 {
+		return 1
+	}
+	last, ok := latest(track)
+	if !ok {
+		return 0
+	}
+	age := now.Sub(last) - d.Interval
+	if age < 0 {
+		return 1
+	}
+	return clamp(1 - float64(age)/float64(d.Window))
+}
+
+// stillness returns the time since the last significant movement relative to
+// the window, at most 1. A movement is significant if the driver has been
+// further away than half the zombie radius from her latest position.
+func (d *Detector) stillness(track []types.LocationUpdate) float64 {
+	if d.Window <= 0 {
+		return 1
+	}
+	lastIdx, first := len(track)-1, 0
+	last := track[lastIdx]
+	for i := lastIdx - 1; i >= 0; i-- {
+		if d.Geodesic(track[i].Lat, track[i].Long, last.Lat, last.Long) > d.Radius/2 {
+			first = i
+			break
+		}
+	}
+	t1, ok1 := updatedAt(track[first])
+	t2, ok2 := updatedAt(last)
+	if !ok1 || !ok2 {
+		return 1
+	}
+	still := t2.Sub(t1)
+	if still < 0 {
+		still = -still
+	}
+	return clamp(float64(still) / float64(d.Window))
+}
+
+// latest returns the most recent valid update time of track.
+func latest(track []types.LocationUpdate) (time.Time, bool) {
+	var last time.Time
+	var found bool
+	for _, l := range track {
+		if t, ok := updatedAt(l); ok && (!found || t.After(last)) {
+			last, found = t, true
+		}
+	}
+	return last, found
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// Distance returns the total distance between consecutive locations in km
+// computed by f.
+func Distance(f geo.DistanceFunc, locs []types.LocationUpdate) float64 {
+	var dist float64
+	for i := 0; i < len(locs)-1; i++ {
+		dist += f(locs[i].Lat, locs[i].Long, locs[i+1].Lat, locs[i+1].Long)
+	}
+	return dist
+}
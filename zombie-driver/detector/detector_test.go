@@ -0,0 +1,252 @@
+package detector
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/geo"
+	"github.com/heetch/FabianG-technical-test/testdata"
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+var zombieTests = []struct {
+	d string  // description of test case
+	l string  // input locations
+	r float64 // zombie radius in meter
+	z bool    // expected result
+}{
+	{
+		d: "expect zombie; #1",
+		l: testdata.Drives[0].Loc, // 116.51m
+		r: 400.0,
+		z: true,
+	},
+	{
+		d: "expect zombie; #2",
+		l: testdata.Drives[1].Loc, // 233.02m
+		r: 400.0,
+		z: true,
+	},
+	{
+		d: "expect no zombie",
+		l: testdata.Drives[2].Loc, // 466.04m
+		r: 400.0,
+		z: false,
+	},
+	{
+		d: "expect zombie for a single location",
+		l: `[{"updated_at":"2019-10-15T07:00:07Z","latitude":0.40059538,"longitude":9.43746775}]`,
+		r: 400.0,
+		z: true,
+	},
+}
+
+// Without window and interval, the score depends on the distance only.
+func TestDetectDistance(t *testing.T) {
+	for _, tt := range zombieTests {
+		var locs []types.LocationUpdate
+		if err := json.Unmarshal([]byte(tt.l), &locs); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if w, g := tt.z, New(Config{Radius: tt.r}).Detect(locs, time.Now()).Zombie; w != g {
+			t.Errorf("%s: want %t got %t", tt.d, w, g)
+		}
+	}
+}
+
+var now = time.Date(2019, 10, 15, 7, 0, 0, 0, time.UTC)
+
+// ~300m north of the first test location
+var away = types.Location{
+	Lat:  0.40329538,
+	Long: 9.43746775,
+}
+
+var scoreTests = []struct {
+	d string                 // description of test case
+	l []types.LocationUpdate // input track
+	s float64                // expected score
+	z bool                   // expected verdict
+}{
+	{
+		d: "expect full score for standing still over the window",
+		l: testdata.Track(now, 10*time.Second, testdata.Still(31)...),
+		s: 1,
+		z: true,
+	},
+	{
+		d: "expect high score for moving less than the radius; 233.02m",
+		l: testdata.Track(now, 10*time.Second, append(testdata.Rounds(2), testdata.Still(19)...)...),
+		s: 0.632,
+		z: true,
+	},
+	{
+		d: "expect low score for moving more than the radius; 582.55m",
+		l: testdata.Track(now, 10*time.Second, testdata.Rounds(5)...),
+		s: 0.4,
+		z: false,
+	},
+	{
+		d: "expect no zombie for sparse still data",
+		l: testdata.Track(now, 50*time.Second, testdata.Still(7)...),
+		s: 0.233,
+		z: false,
+	},
+	{
+		d: "expect no zombie for outdated still data",
+		l: testdata.Track(now.Add(-160*time.Second), 10*time.Second, testdata.Still(31)...),
+		s: 0.5,
+		z: false,
+	},
+	{
+		d: "expect no zombie for stale still data",
+		l: testdata.Track(now.Add(-time.Hour), 10*time.Second, testdata.Still(31)...),
+		s: 0,
+		z: false,
+	},
+	{
+		d: "expect no zombie for two still points of 6 minutes ago",
+		l: testdata.Track(now.Add(-6*time.Minute), 10*time.Second, testdata.Still(2)...),
+		s: 0,
+		z: false,
+	},
+	{
+		d: "expect lower score after recent significant movement",
+		l: testdata.Track(now, 10*time.Second, append([]types.Location{away}, testdata.Still(10)...)...),
+		s: 0.14,
+		z: false,
+	},
+	{
+		d: "expect no zombie without data",
+		l: []types.LocationUpdate{},
+		s: 0,
+		z: false,
+	},
+}
+
+func TestDetectScore(t *testing.T) {
+	d := New(Config{
+		Radius:   400,
+		Window:   5 * time.Minute,
+		Interval: 10 * time.Second,
+	})
+	for _, tt := range scoreTests {
+		v := d.Detect(tt.l, now)
+		if w, g := tt.s, v.Score; w != g {
+			t.Errorf("%s: want score %.3f got %.3f", tt.d, w, g)
+		}
+		if w, g := tt.z, v.Zombie; w != g {
+			t.Errorf("%s: want zombie %t got %t", tt.d, w, g)
+		}
+	}
+}
+
+func TestDetectThreshold(t *testing.T) {
+	track := testdata.Track(now, 10*time.Second, testdata.Rounds(2)...)
+	for _, th := range []float64{0.3, 0.5, 0.9} {
+		v := New(Config{Radius: 400, Threshold: th}).Detect(track, now)
+		if w, g := v.Score > th, v.Zombie; w != g {
+			t.Errorf("threshold %.1f: want zombie %t for score %.3f", th, w, v.Score)
+		}
+	}
+}
+
+var unknownTests = []struct {
+	d string                 // description of test case
+	l []types.LocationUpdate // location updates
+	u bool                   // expect unknown
+}{
+	{
+		d: "expect unknown for a single outdated location update",
+		l: testdata.Track(now.Add(-4*time.Minute), 10*time.Second, testdata.Still(1)...),
+		u: true,
+	},
+	{
+		d: "expect unknown for too few location updates",
+		l: testdata.Track(now, 2*time.Minute, testdata.Still(2)...),
+		u: true,
+	},
+	{
+		d: "expect unknown for insufficient coverage",
+		l: testdata.Track(now, 10*time.Second, testdata.Still(10)...), // 90s
+		u: true,
+	},
+	{
+		d: "expect verdict for sufficient samples and coverage",
+		l: testdata.Track(now, 10*time.Second, testdata.Still(16)...), // 150s
+		u: false,
+	},
+	{
+		d: "expect unknown without data",
+		l: []types.LocationUpdate{},
+		u: true,
+	},
+}
+
+func TestDetectUnknown(t *testing.T) {
+	d := New(Config{
+		Radius:      400,
+		Window:      5 * time.Minute,
+		Interval:    10 * time.Second,
+		MinSamples:  3,
+		MinCoverage: 0.5,
+	})
+	for _, tt := range unknownTests {
+		v := d.Detect(tt.l, now)
+		if w, g := tt.u, v.Unknown; w != g {
+			t.Errorf("%s: want unknown %t got %t", tt.d, w, g)
+		}
+		if tt.u && (v.Zombie || v.Score != 0.5) {
+			t.Errorf("%s: want no zombie and score 0.5 got %+v", tt.d, v)
+		}
+	}
+}
+
+func TestDetectOutdated(t *testing.T) {
+	// only the max age applies
+	d := New(Config{
+		Radius:   400,
+		Window:   5 * time.Minute,
+		Interval: 10 * time.Second,
+		MaxAge:   time.Minute,
+	})
+	for _, tt := range []struct {
+		d string                 // description of test case
+		l []types.LocationUpdate // location updates
+		u bool                   // expect unknown
+	}{
+		{
+			d: "expect unknown for a single point from 4 minutes ago",
+			l: testdata.Track(now.Add(-4*time.Minute), 10*time.Second, testdata.Still(1)...),
+			u: true,
+		},
+		{
+			d: "expect unknown for a track ending 2 minutes ago",
+			l: testdata.Track(now.Add(-2*time.Minute), 10*time.Second, testdata.Still(19)...),
+			u: true,
+		},
+		{
+			d: "expect verdict for a track ending within the max age",
+			l: testdata.Track(now.Add(-30*time.Second), 10*time.Second, testdata.Still(28)...),
+			u: false,
+		},
+	} {
+		v := d.Detect(tt.l, now)
+		if w, g := tt.u, v.Unknown; w != g {
+			t.Errorf("%s: want unknown %t got %t", tt.d, w, g)
+		}
+		if tt.u && v.Zombie {
+			t.Errorf("%s: want no zombie got %+v", tt.d, v)
+		}
+	}
+}
+
+func TestDetectGeodesic(t *testing.T) {
+	track := testdata.Track(now, 10*time.Second, testdata.Rounds(2)...)
+	for _, f := range []geo.DistanceFunc{geo.Haversine, geo.Vincenty, geo.Equirectangular} {
+		if w, g := Distance(f, track), New(Config{Radius: 400, Geodesic: f}).Detect(track, now).Distance; w != g {
+			t.Errorf("want distance %f got %f", w, g)
+		}
+	}
+}
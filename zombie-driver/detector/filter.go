@@ -0,0 +1,169 @@
+package detector
+
+import (
+	"sort"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/geo"
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+// Stage is a step of a Filter which transforms a track of location updates.
+// Stages may modify their input.
+type Stage func([]types.LocationUpdate) []types.LocationUpdate
+
+// Filter is a pipeline of stages which removes GPS noise from a track of
+// location updates before distances are computed. Stages are applied in
+// order.
+type Filter []Stage
+
+// FilterConfig enables the stages of a Filter.
+type FilterConfig struct {
+	Sort      bool    // sort by update time
+	Dedup     bool    // drop duplicate location updates
+	MaxSpeed  float64 // km/h; drop outliers implying higher speeds; zero disables
+	Smoothing int     // points of the moving average; less than two disables
+}
+
+// NewFilter returns a Filter with the stages enabled by cfg. Stages are
+// ordered by sort, dedup, outliers and smoothing.
+func NewFilter(cfg FilterConfig) Filter {
+	var f Filter
+	if cfg.Sort {
+		f = append(f, SortStage)
+	}
+	if cfg.Dedup {
+		f = append(f, DedupStage)
+	}
+	if cfg.MaxSpeed > 0 {
+		f = append(f, NewSpeedStage(cfg.MaxSpeed))
+	}
+	if cfg.Smoothing > 1 {
+		f = append(f, NewSmoothingStage(cfg.Smoothing))
+	}
+	return f
+}
+
+// Apply applies all stages of f to a copy of locs. So locs is not modified.
+func (f Filter) Apply(locs []types.LocationUpdate) []types.LocationUpdate {
+	track := make([]types.LocationUpdate, len(locs))
+	copy(track, locs)
+	for _, stage := range f {
+		track = stage(track)
+	}
+	return track
+}
+
+// updatedAt parses the RFC3339 update time of l.
+func updatedAt(l types.LocationUpdate) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, l.UpdatedAt)
+	return t, err == nil
+}
+
+// SortStage sorts locs by update time, ascending. Location updates with an
+// invalid update time are dropped since they can not be ordered.
+func SortStage(locs []types.LocationUpdate) []types.LocationUpdate {
+	times := make(map[string]time.Time, len(locs))
+	valid := locs[:0]
+	for _, l := range locs {
+		t, ok := updatedAt(l)
+		if !ok {
+			continue
+		}
+		times[l.UpdatedAt] = t
+		valid = append(valid, l)
+	}
+	sort.SliceStable(valid, func(i, j int) bool {
+		return times[valid[i].UpdatedAt].Before(times[valid[j].UpdatedAt])
+	})
+	return valid
+}
+
+// DedupStage drops location updates which equal their predecessor in update
+// time and position.
+func DedupStage(locs []types.LocationUpdate) []types.LocationUpdate {
+	if len(locs) == 0 {
+		return locs
+	}
+	deduped := locs[:1]
+	for _, l := range locs[1:] {
+		if l != deduped[len(deduped)-1] {
+			deduped = append(deduped, l)
+		}
+	}
+	return deduped
+}
+
+// NewSpeedStage returns a Stage which drops outliers that imply a speed
+// higher than maxSpeed in km/h from the previous location update. A leading
+// location update is dropped as an outlier if it is inconsistent with its
+// successor while the successor is consistent with the next one; otherwise the
+// first location update is kept. Location updates with an invalid update time
+// are kept since their speed is unknown. Note, update times have a resolution
+// of seconds, so we assume at least one second between updates. Speeds are
+// based on haversine distances which are precise enough to detect outliers.
+func NewSpeedStage(maxSpeed float64) Stage {
+	consistent := func(l1, l2 types.LocationUpdate) bool {
+		t1, ok1 := updatedAt(l1)
+		t2, ok2 := updatedAt(l2)
+		if !ok1 || !ok2 {
+			return true
+		}
+		dt := t2.Sub(t1)
+		if dt < 0 {
+			dt = -dt
+		}
+		if dt < time.Second {
+			dt = time.Second
+		}
+		dist := geo.Haversine(l1.Lat, l1.Long, l2.Lat, l2.Long)
+		return dist/dt.Hours() <= maxSpeed
+	}
+	return func(locs []types.LocationUpdate) []types.LocationUpdate {
+		if len(locs) == 0 {
+			return locs
+		}
+		// with two points only, there is no telling which one is the outlier
+		first := 0
+		for first+2 < len(locs) && !consistent(locs[first], locs[first+1]) && consistent(locs[first+1], locs[first+2]) {
+			first++
+		}
+		kept := locs[first : first+1]
+		for _, l := range locs[first+1:] {
+			if consistent(kept[len(kept)-1], l) {
+				kept = append(kept, l)
+			}
+		}
+		return kept
+	}
+}
+
+// NewSmoothingStage returns a Stage which replaces the position of each
+// location update by the centered moving average over window points. The
+// window is clipped at both ends of the track.
+func NewSmoothingStage(window int) Stage {
+	return func(locs []types.LocationUpdate) []types.LocationUpdate {
+		smoothed := make([]types.LocationUpdate, len(locs))
+		for i := range locs {
+			from, to := i-window/2, i+(window-1)/2
+			if from < 0 {
+				from = 0
+			}
+			if to > len(locs)-1 {
+				to = len(locs) - 1
+			}
+			var lat, long float64
+			for _, l := range locs[from : to+1] {
+				lat += l.Lat
+				long += l.Long
+			}
+			n := float64(to - from + 1)
+			smoothed[i] = types.LocationUpdate{
+				UpdatedAt: locs[i].UpdatedAt,
+				Lat:       lat / n,
+				Long:      long / n,
+			}
+		}
+		return smoothed
+	}
+}
@@ -0,0 +1,148 @@
+package detector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/heetch/FabianG-technical-test/geo"
+	"github.com/heetch/FabianG-technical-test/testdata"
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+// lu returns a location update of the i-th test location at time t.
+func lu(t string, i int) types.LocationUpdate {
+	return types.LocationUpdate{
+		UpdatedAt: t,
+		Lat:       testdata.Locations[i].Lat,
+		Long:      testdata.Locations[i].Long,
+	}
+}
+
+// far away from all test locations; ~111km north
+var outlier = types.LocationUpdate{
+	UpdatedAt: "2019-10-15T07:00:20Z",
+	Lat:       1.40059538,
+	Long:      9.43746775,
+}
+
+var filterTests = []struct {
+	d string                 // description of test case
+	s Stage                  // stage to test
+	l []types.LocationUpdate // input
+	r []types.LocationUpdate // expected result
+}{
+	{
+		d: "expect sorted by update time",
+		s: SortStage,
+		l: []types.LocationUpdate{lu("2019-10-15T07:00:30Z", 2), lu("2019-10-15T07:00:10Z", 0), lu("2019-10-15T08:00:20+01:00", 1)},
+		r: []types.LocationUpdate{lu("2019-10-15T07:00:10Z", 0), lu("2019-10-15T08:00:20+01:00", 1), lu("2019-10-15T07:00:30Z", 2)},
+	},
+	{
+		d: "expect invalid update time to be dropped by sort",
+		s: SortStage,
+		l: []types.LocationUpdate{lu("2019-10-15T07:00:30Z", 2), lu("invalid", 0)},
+		r: []types.LocationUpdate{lu("2019-10-15T07:00:30Z", 2)},
+	},
+	{
+		d: "expect duplicates to be dropped",
+		s: DedupStage,
+		l: []types.LocationUpdate{lu("2019-10-15T07:00:10Z", 0), lu("2019-10-15T07:00:10Z", 0), lu("2019-10-15T07:00:10Z", 1), lu("2019-10-15T07:00:20Z", 1), lu("2019-10-15T07:00:20Z", 1)},
+		r: []types.LocationUpdate{lu("2019-10-15T07:00:10Z", 0), lu("2019-10-15T07:00:10Z", 1), lu("2019-10-15T07:00:20Z", 1)},
+	},
+	{
+		d: "expect empty track to be deduped",
+		s: DedupStage,
+		l: []types.LocationUpdate{},
+		r: []types.LocationUpdate{},
+	},
+	{
+		d: "expect outlier to be dropped",
+		s: NewSpeedStage(250),
+		l: []types.LocationUpdate{lu("2019-10-15T07:00:10Z", 0), outlier, lu("2019-10-15T07:00:30Z", 1)},
+		r: []types.LocationUpdate{lu("2019-10-15T07:00:10Z", 0), lu("2019-10-15T07:00:30Z", 1)},
+	},
+	{
+		d: "expect leading outlier to be dropped",
+		s: NewSpeedStage(250),
+		l: []types.LocationUpdate{outlier, lu("2019-10-15T07:00:30Z", 1), lu("2019-10-15T07:00:40Z", 2), lu("2019-10-15T07:00:50Z", 3)},
+		r: []types.LocationUpdate{lu("2019-10-15T07:00:30Z", 1), lu("2019-10-15T07:00:40Z", 2), lu("2019-10-15T07:00:50Z", 3)},
+	},
+	{
+		d: "expect first point to be kept before an outlier",
+		s: NewSpeedStage(250),
+		l: []types.LocationUpdate{lu("2019-10-15T07:00:10Z", 0), outlier, lu("2019-10-15T07:00:30Z", 1), lu("2019-10-15T07:00:40Z", 2)},
+		r: []types.LocationUpdate{lu("2019-10-15T07:00:10Z", 0), lu("2019-10-15T07:00:30Z", 1), lu("2019-10-15T07:00:40Z", 2)},
+	},
+	{
+		d: "expect jump in the same second to be dropped; 36.83m in >= 1s",
+		s: NewSpeedStage(100),
+		l: []types.LocationUpdate{lu("2019-10-15T07:00:10Z", 0), lu("2019-10-15T07:00:10Z", 1)},
+		r: []types.LocationUpdate{lu("2019-10-15T07:00:10Z", 0)},
+	},
+	{
+		d: "expect slow movement to be kept",
+		s: NewSpeedStage(250),
+		l: []types.LocationUpdate{lu("2019-10-15T07:00:10Z", 0), lu("2019-10-15T07:00:20Z", 1), lu("2019-10-15T07:00:30Z", 2)},
+		r: []types.LocationUpdate{lu("2019-10-15T07:00:10Z", 0), lu("2019-10-15T07:00:20Z", 1), lu("2019-10-15T07:00:30Z", 2)},
+	},
+	{
+		d: "expect moving average of positions",
+		s: NewSmoothingStage(3),
+		l: []types.LocationUpdate{
+			{UpdatedAt: "2019-10-15T07:00:10Z", Lat: 1, Long: 3},
+			{UpdatedAt: "2019-10-15T07:00:20Z", Lat: 2, Long: 6},
+			{UpdatedAt: "2019-10-15T07:00:30Z", Lat: 6, Long: 3},
+		},
+		r: []types.LocationUpdate{
+			{UpdatedAt: "2019-10-15T07:00:10Z", Lat: 1.5, Long: 4.5},
+			{UpdatedAt: "2019-10-15T07:00:20Z", Lat: 3, Long: 4},
+			{UpdatedAt: "2019-10-15T07:00:30Z", Lat: 4, Long: 4.5},
+		},
+	},
+}
+
+func TestStages(t *testing.T) {
+	for _, tt := range filterTests {
+		in := make([]types.LocationUpdate, len(tt.l))
+		copy(in, tt.l)
+		if w, g := tt.r, tt.s(in); !reflect.DeepEqual(w, g) {
+			t.Errorf("%s: want %+v got %+v", tt.d, w, g)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	// one round in reverse order with a duplicate and an outlier
+	track := []types.LocationUpdate{
+		lu("2019-10-15T07:00:50Z", 5),
+		lu("2019-10-15T07:00:40Z", 4),
+		lu("2019-10-15T07:00:30Z", 3),
+		lu("2019-10-15T07:00:20Z", 2),
+		lu("2019-10-15T07:00:20Z", 2),
+		outlier,
+		lu("2019-10-15T07:00:10Z", 1),
+		lu("2019-10-15T07:00:00Z", 0),
+	}
+	in := make([]types.LocationUpdate, len(track))
+	copy(in, track)
+
+	f := NewFilter(FilterConfig{
+		Sort:     true,
+		Dedup:    true,
+		MaxSpeed: 250,
+	})
+	if w, g := 3, len(f); w != g {
+		t.Fatalf("want %d stages got %d", w, g)
+	}
+	got := f.Apply(track)
+	if w, g := testdata.Distances[9].D, Distance(geo.Haversine, got); w != g {
+		t.Errorf("want distance %f got %f", w, g)
+	}
+	if !reflect.DeepEqual(in, track) {
+		t.Error("expect input to be unmodified")
+	}
+	// the outlier dominates the distance without filter
+	if g := Distance(geo.Haversine, Filter(nil).Apply(track)); g < 200 {
+		t.Errorf("want distance > 200km got %f", g)
+	}
+}
@@ -0,0 +1,17 @@
+package history
+
+import (
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+// Store persists zombie verdicts for auditing. Implementations must be safe
+// for concurrent use by multiple goroutines.
+type Store interface {
+	// Add records v at time t.
+	Add(t time.Time, v types.ZombieVerdict) error
+	// Range returns the verdicts of the driver identified by id recorded
+	// between from and to (inclusive), ordered by time.
+	Range(id int64, from, to time.Time) ([]types.ZombieVerdict, error)
+}
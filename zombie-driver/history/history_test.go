@@ -0,0 +1,185 @@
+package history
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+// testRedis mocks sorted sets of redis.
+type testRedis struct {
+	t      *testing.T
+	sets   map[string]map[string]float64
+	expire map[string]time.Duration
+}
+
+func newTestRedis(t *testing.T) *testRedis {
+	return &testRedis{
+		t:      t,
+		sets:   make(map[string]map[string]float64),
+		expire: make(map[string]time.Duration),
+	}
+}
+
+func (r *testRedis) ZAddTrim(key string, member redis.Z, max string, expiration time.Duration) error {
+	if r.sets[key] == nil {
+		r.sets[key] = make(map[string]float64)
+	}
+	r.sets[key][member.Member.(string)] = member.Score
+	// exclusive max
+	m := r.parse(max)
+	for member, s := range r.sets[key] {
+		if s < m {
+			delete(r.sets[key], member)
+		}
+	}
+	r.expire[key] = expiration
+	return nil
+}
+
+func (r *testRedis) ZRangeByScore(key string, opt redis.ZRangeBy) ([]string, error) {
+	min, max := r.parse(opt.Min), r.parse(opt.Max)
+	var members []string
+	for m, s := range r.sets[key] {
+		if s >= min && s <= max {
+			members = append(members, m)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return r.sets[key][members[i]] < r.sets[key][members[j]]
+	})
+	return members, nil
+}
+
+func (r *testRedis) parse(score string) float64 {
+	s, err := strconv.ParseFloat(score, 64)
+	if err != nil {
+		r.t.Fatalf("unexpected error: %v", err)
+	}
+	return s
+}
+
+var start = time.Date(2019, 10, 15, 7, 0, 0, 0, time.UTC)
+
+// verdict returns a verdict of the driver identified by id checked at start
+// plus m minutes.
+func verdict(id int64, m int) types.ZombieVerdict {
+	return types.ZombieVerdict{
+		ID:        id,
+		Zombie:    m%2 == 0,
+		Score:     float64(m) / 100,
+		CheckedAt: start.Add(time.Duration(m) * time.Minute).Format(time.RFC3339Nano),
+		Radius:    500,
+		Window:    5,
+		Threshold: 0.5,
+		Version:   "1",
+	}
+}
+
+var historyTests = []struct {
+	d    string                // description of test case
+	id   int64                 // driver-ID
+	from int                   // minutes after start
+	to   int                   // minutes after start
+	r    []types.ZombieVerdict // expected result
+}{
+	{
+		d:    "expect all retained verdicts of driver 1 in order",
+		id:   1,
+		from: 0,
+		to:   120,
+		r:    []types.ZombieVerdict{verdict(1, 30), verdict(1, 40), verdict(1, 50), verdict(1, 90)},
+	},
+	{
+		d:    "expect verdicts within range including bounds",
+		id:   1,
+		from: 40,
+		to:   50,
+		r:    []types.ZombieVerdict{verdict(1, 40), verdict(1, 50)},
+	},
+	{
+		d:    "expect verdicts of driver 2 only",
+		id:   2,
+		from: 0,
+		to:   120,
+		r:    []types.ZombieVerdict{verdict(2, 40)},
+	},
+	{
+		d:    "expect no verdicts of unknown driver",
+		id:   3,
+		from: 0,
+		to:   120,
+		r:    []types.ZombieVerdict{},
+	},
+}
+
+func testStore(t *testing.T, s Store) {
+	// retention is one hour; verdicts of driver 1 before minute 30 are
+	// dropped when adding the verdict of minute 90
+	for _, v := range []types.ZombieVerdict{verdict(1, 0), verdict(2, 40), verdict(1, 20), verdict(1, 30), verdict(1, 50), verdict(1, 40), verdict(1, 90)} {
+		checkedAt, err := time.Parse(time.RFC3339Nano, v.CheckedAt)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.Add(checkedAt, v); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for _, tt := range historyTests {
+		from := start.Add(time.Duration(tt.from) * time.Minute)
+		to := start.Add(time.Duration(tt.to) * time.Minute)
+		verdicts, err := s.Range(tt.id, from, to)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.d, err)
+		}
+		if w, g := tt.r, verdicts; !reflect.DeepEqual(w, g) {
+			t.Errorf("%s: want %+v got %+v", tt.d, w, g)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory(time.Hour, 10))
+}
+
+func TestMemoryBounds(t *testing.T) {
+	m := NewMemory(time.Hour, 2)
+	for _, tt := range []struct {
+		d string // description of test case
+		v int    // minutes after start of the verdict of driver i
+		i int64  // driver-ID
+		e error  // expected error
+		n int    // expected number of drivers
+	}{
+		{d: "expect first driver", i: 1, n: 1},
+		{d: "expect second driver", v: 10, i: 2, n: 2},
+		{d: "expect known driver beyond max", v: 20, i: 1, n: 2},
+		{d: "expect new driver beyond max to fail", v: 30, i: 3, e: ErrFull, n: 2},
+		{d: "expect outdated drivers to be swept", v: 85, i: 3, n: 1},
+		{d: "expect new driver after sweep", v: 86, i: 4, n: 2},
+	} {
+		checkedAt := start.Add(time.Duration(tt.v) * time.Minute)
+		if g := m.Add(checkedAt, verdict(tt.i, tt.v)); tt.e != g {
+			t.Errorf("%s: want error %v got %v", tt.d, tt.e, g)
+		}
+		if g := len(m.verdicts); tt.n != g {
+			t.Errorf("%s: want %d drivers got %d", tt.d, tt.n, g)
+		}
+	}
+}
+
+func TestRedis(t *testing.T) {
+	r := newTestRedis(t)
+	testStore(t, &Redis{
+		MiniRedis: r,
+		retention: time.Hour,
+	})
+	if w, g := time.Hour, r.expire[keyPrefix+"1"]; w != g {
+		t.Errorf("want expiration %s got %s", w, g)
+	}
+}
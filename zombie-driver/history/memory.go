@@ -0,0 +1,109 @@
+package history
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+// ErrFull is returned by Memory.Add if the verdict of a new driver exceeds the
+// max number of drivers.
+var ErrFull = errors.New("history of too many drivers")
+
+// Memory is an in-memory Store. Verdicts older than the retention period are
+// dropped when new verdicts of the same driver are added. Drivers without
+// retained verdicts are swept periodically, and the number of drivers is
+// limited, so that memory is bounded.
+type Memory struct {
+	retention  time.Duration
+	maxDrivers int
+
+	mu       sync.RWMutex
+	verdicts map[int64][]record // ordered by time
+	swept    time.Time          // time of the last sweep
+}
+
+type record struct {
+	t time.Time
+	v types.ZombieVerdict
+}
+
+// NewMemory returns a Memory which keeps verdicts for retention of at most
+// maxDrivers drivers.
+func NewMemory(retention time.Duration, maxDrivers int) *Memory {
+	return &Memory{
+		retention:  retention,
+		maxDrivers: maxDrivers,
+		verdicts:   make(map[int64][]record),
+	}
+}
+
+// sweepInterval is the max interval of sweeps; shorter retention periods
+// are swept after the retention period.
+const sweepInterval = time.Minute
+
+// Add records v at time t. Verdicts of new drivers fail with ErrFull if the
+// max number of drivers is reached.
+func (m *Memory) Add(t time.Time, v types.ZombieVerdict) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	interval := sweepInterval
+	if m.retention < interval {
+		interval = m.retention
+	}
+	if t.Sub(m.swept) >= interval {
+		m.sweep(t)
+	}
+	recs, ok := m.verdicts[v.ID]
+	if !ok && len(m.verdicts) >= m.maxDrivers {
+		// the sweep may be due earlier than the interval
+		m.sweep(t)
+		if len(m.verdicts) >= m.maxDrivers {
+			return ErrFull
+		}
+	}
+	// keep records ordered; verdicts usually arrive in order
+	i := sort.Search(len(recs), func(i int) bool { return recs[i].t.After(t) })
+	recs = append(recs, record{})
+	copy(recs[i+1:], recs[i:])
+	recs[i] = record{t: t, v: v}
+
+	// drop outdated records
+	min := t.Add(-m.retention)
+	j := sort.Search(len(recs), func(i int) bool { return !recs[i].t.Before(min) })
+	m.verdicts[v.ID] = recs[j:]
+	return nil
+}
+
+// sweep drops outdated verdicts of all drivers at time t and the drivers
+// without verdicts.
+func (m *Memory) sweep(t time.Time) {
+	m.swept = t
+	min := t.Add(-m.retention)
+	for id, recs := range m.verdicts {
+		j := sort.Search(len(recs), func(i int) bool { return !recs[i].t.Before(min) })
+		if j == len(recs) {
+			delete(m.verdicts, id)
+			continue
+		}
+		m.verdicts[id] = recs[j:]
+	}
+}
+
+// Range returns the verdicts of the driver identified by id recorded between
+// from and to (inclusive), ordered by time.
+func (m *Memory) Range(id int64, from, to time.Time) ([]types.ZombieVerdict, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	verdicts := make([]types.ZombieVerdict, 0)
+	for _, r := range m.verdicts[id] {
+		if r.t.Before(from) || r.t.After(to) {
+			continue
+		}
+		verdicts = append(verdicts, r.v)
+	}
+	return verdicts, nil
+}
@@ -0,0 +1,101 @@
+package history
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+// keyPrefix is prepended to driver IDs to build the keys of the sorted sets
+// which hold the verdicts of a driver.
+const keyPrefix = "zombie-history:"
+
+// MiniRedis is an abstraction for unit tests only, see the driver-location
+// store.
+type MiniRedis interface {
+	// add member to the sorted set stored at key, remove the members with a
+	// score less than max and set a timeout on key
+	ZAddTrim(key string, member redis.Z, max string, expiration time.Duration) error
+	// fetch range from the sorted set stored at key
+	ZRangeByScore(key string, opt redis.ZRangeBy) ([]string, error)
+}
+
+// RedisClient represents a pool of zero or more underlying connections.
+// It is safe for concurrent use by multiple goroutines.
+type RedisClient struct {
+	c *redis.Client
+}
+
+// ZAddTrim adds member to the sorted set stored at key, removes the members
+// with a score less than max and sets a timeout on key in a single round-trip.
+func (rc *RedisClient) ZAddTrim(key string, member redis.Z, max string, expiration time.Duration) error {
+	_, err := rc.c.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(key, member)
+		pipe.ZRemRangeByScore(key, "-inf", "("+max)
+		pipe.Expire(key, expiration)
+		return nil
+	})
+	return err
+}
+
+func (rc *RedisClient) ZRangeByScore(key string, opt redis.ZRangeBy) ([]string, error) {
+	return rc.c.ZRangeByScore(key, opt).Result()
+}
+
+// Redis is a Store which keeps the verdicts of each driver in a sorted set
+// scored by the time of the verdict. Verdicts older than the retention period
+// are removed when new verdicts of the same driver are added. The sorted set
+// of a driver expires after the retention period without new verdicts.
+type Redis struct {
+	MiniRedis
+	retention time.Duration
+}
+
+// NewRedis returns a Redis connected to the instance at addr which keeps
+// verdicts for retention.
+func NewRedis(addr string, retention time.Duration) *Redis {
+	return &Redis{
+		MiniRedis: &RedisClient{
+			c: redis.NewClient(&redis.Options{Addr: addr}),
+		},
+		retention: retention,
+	}
+}
+
+// Add records v at time t.
+func (r *Redis) Add(t time.Time, v types.ZombieVerdict) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	key := keyPrefix + strconv.FormatInt(v.ID, 10)
+	max := strconv.FormatInt(t.Add(-r.retention).UnixNano(), 10)
+	return r.ZAddTrim(key, redis.Z{
+		Score:  float64(t.UnixNano()),
+		Member: string(value),
+	}, max, r.retention)
+}
+
+// Range returns the verdicts of the driver identified by id recorded between
+// from and to (inclusive), ordered by time.
+func (r *Redis) Range(id int64, from, to time.Time) ([]types.ZombieVerdict, error) {
+	members, err := r.ZRangeByScore(keyPrefix+strconv.FormatInt(id, 10), redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixNano(), 10),
+		Max: strconv.FormatInt(to.UnixNano(), 10),
+	})
+	if err != nil {
+		return nil, err
+	}
+	verdicts := make([]types.ZombieVerdict, 0, len(members))
+	for _, m := range members {
+		var v types.ZombieVerdict
+		if err := json.Unmarshal([]byte(m), &v); err != nil {
+			return nil, err
+		}
+		verdicts = append(verdicts, v)
+	}
+	return verdicts, nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/handler"
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+// per driver errors of batch zombie checks
+const (
+	errCheckNotFound = "not_found"
+	errCheckTimeout  = "timeout"
+	errCheckInternal = "internal_error"
+)
+
+// batchHandler checks a list of drivers at once.
+type batchHandler struct {
+	*checker
+	workers int           // concurrent checks per request
+	timeout time.Duration // overall deadline of a request
+	maxIDs  int           // max number of drivers per request
+}
+
+// ServeHTTP checks all drivers of the request concurrently. It responds with
+// a verdict or an error for each driver in the order of the request. Checks
+// which are not finished before the deadline fail with a timeout error.
+func (b *batchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err == handler.ErrBodyTooLarge {
+		handler.WriteError(w, r, err, http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		handler.WriteError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	// marshal instead of decode since we expect a single JSON string
+	// only not a stream or additional data
+	var req types.ZombieCheckRequest
+	if err = json.Unmarshal(body, &req); err != nil {
+		handler.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if b.maxIDs > 0 && len(req.IDs) > b.maxIDs {
+		handler.WriteError(w, r, fmt.Errorf("too many drivers: %d > %d", len(req.IDs), b.maxIDs), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), b.timeout)
+	defer cancel()
+
+	logger := handler.LoggerFromRequest(r)
+	res := types.ZombieCheckResponse{
+		Drivers: make([]types.ZombieCheck, len(req.IDs)),
+	}
+	for i, c := range b.checkAll(ctx, req.IDs, b.workers) {
+		zc := types.ZombieCheck{ID: req.IDs[i]}
+		switch {
+		case c.err == nil:
+			zombie, score := c.zombie.Zombie, c.zombie.Score
+			zc.Zombie, zc.Score = &zombie, &score
+			zc.State, zc.Stale = c.zombie.State, c.zombie.Stale
+		case c.err == errNotFound:
+			zc.Error = errCheckNotFound
+		case errors.Is(c.err, context.DeadlineExceeded):
+			zc.Error = errCheckTimeout
+		default:
+			logger.Error().Err(c.err).Int64("id", zc.ID).Msg("zombie check failed")
+			zc.Error = errCheckInternal
+		}
+		res.Drivers[i] = zc
+	}
+	handler.EncodeJSON(w, r, res, http.StatusOK)
+}
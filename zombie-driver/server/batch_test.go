@@ -0,0 +1,125 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/testdata"
+	"github.com/rs/zerolog"
+)
+
+// mock responses of driver-location by driver-ID
+var batchLocations = map[string]string{
+	"1": testdata.Drives[0].Loc, // 116.51m
+	"2": testdata.Drives[2].Loc, // 466.04m
+	"3": "null",
+	"4": `{"foo":"bar"`,
+	"7": `[{"updated_at":"2019-10-15T07:00:07Z","latitude":0.40059538,"longitude":9.43746775}]`,
+}
+
+var batchTests = []struct {
+	d string // description of test case
+	b string // request body
+	r string // expected response data
+	s int    // expected response status code
+}{
+	{
+		d: "expect verdicts and errors in order of request",
+		b: `{"ids":[1,2,3,4,5]}`,
+		r: `{"drivers":[{"id":1,"zombie":true,"score":0.774,"state":"zombie"},{"id":2,"zombie":false,"score":0.462,"state":"active"},{"id":3,"error":"not_found"},{"id":4,"error":"internal_error"},{"id":5,"error":"not_found"}]}`,
+		s: http.StatusOK,
+	},
+	{
+		d: "expect unknown state for insufficient location updates",
+		b: `{"ids":[7]}`,
+		r: `{"drivers":[{"id":7,"zombie":false,"score":0.5,"state":"unknown"}]}`,
+		s: http.StatusOK,
+	},
+	{
+		d: "expect empty result for empty request",
+		b: `{"ids":[]}`,
+		r: `{"drivers":[]}`,
+		s: http.StatusOK,
+	},
+	{
+		d: "expect timeout error after deadline",
+		b: `{"ids":[6]}`,
+		r: `{"drivers":[{"id":6,"error":"timeout"}]}`,
+		s: http.StatusOK,
+	},
+	{
+		d: "expect StatusBadRequest for too many drivers",
+		b: `{"ids":[1,2,3,4,5,6,7,8,9,10,11]}`,
+		r: `{"error":"bad_request"}`,
+		s: http.StatusBadRequest,
+	},
+	{
+		d: "expect StatusBadRequest for malformatted JSON",
+		b: `{"ids":[1,2`,
+		r: `{"error":"bad_request"}`,
+		s: http.StatusBadRequest,
+	},
+}
+
+func TestBatchHandler(t *testing.T) {
+	// mute logger in tests
+	logger := zerolog.New(ioutil.Discard)
+	log.SetFlags(0)
+	log.SetOutput(logger)
+
+	driverLocationSrvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Split(r.URL.Path, "/")[2]
+		// exceed the deadline of the batch check
+		if id == "6" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		if l, ok := batchLocations[id]; ok {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(recent(l)))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer driverLocationSrvc.Close()
+
+	cfg := &Config{
+		DriverLocationURL: driverLocationSrvc.URL,
+		ZombieRadius:      400,
+		ZombieTime:        5,
+		BatchWorkers:      2,
+		BatchTimeout:      50 * time.Millisecond,
+		BatchMaxIDs:       10,
+		MinSamples:        2,
+	}
+	c, err := newChecker(cfg, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h, err := newZombieHandler(cfg, c, nil, health.New(time.Second, time.Second), nil, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range batchTests {
+		t.Run(tt.d, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("POST", "/drivers/zombie-check", strings.NewReader(tt.b)))
+			if w, g := tt.s, rec.Code; w != g {
+				t.Errorf("want status code %d got %d", w, g)
+			}
+			if w, g := tt.r, strings.TrimSpace(rec.Body.String()); w != g {
+				t.Errorf("want response %s got %s", w, g)
+			}
+		})
+	}
+}
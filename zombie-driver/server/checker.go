@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/types"
+	"github.com/heetch/FabianG-technical-test/zombie-driver/cache"
+	"github.com/heetch/FabianG-technical-test/zombie-driver/detector"
+	"github.com/heetch/FabianG-technical-test/zombie-driver/history"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+var (
+	historyDroppedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "zombie_driver_history_dropped_total",
+			Help: "number of verdicts not recorded since the history queue was full",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(historyDroppedCounter)
+}
+
+// checker determines if drivers are zombies by their recent location updates.
+type checker struct {
+	driverLocation *driverLocation
+	detector       *detector.Detector
+	history        history.Store      // nil disables recording of verdicts
+	records        chan verdictRecord // verdicts waiting to be added to history
+	recorded       chan struct{}      // closed once the queued verdicts are recorded
+	recordMu       sync.RWMutex       // guards recordsClosed and closing records
+	recordsClosed  bool
+	fallbackMode   string
+	verdicts       *cache.LRU // last verdicts by driver-ID; stale fallback only
+	radius         float64    // meter
+	window         int        // minutes
+	logger         zerolog.Logger
+}
+
+func newChecker(cfg *Config, logger zerolog.Logger) (*checker, error) {
+	// the score of a zombie is undefined without a radius
+	if cfg.ZombieRadius <= 0 {
+		return nil, fmt.Errorf("zombie radius must be positive: %v", cfg.ZombieRadius)
+	}
+	dl, err := newDriverLocation(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := &checker{
+		driverLocation: dl,
+		detector: detector.New(detector.Config{
+			Radius:      cfg.ZombieRadius,
+			Window:      time.Duration(cfg.ZombieTime) * time.Minute,
+			Interval:    cfg.UpdateInterval,
+			Threshold:   cfg.ScoreThreshold,
+			MinSamples:  cfg.MinSamples,
+			MinCoverage: cfg.MinCoverage,
+			MaxAge:      cfg.MaxUpdateAge,
+			Filter:      cfg.Filter,
+			Geodesic:    cfg.Geodesic,
+		}),
+		history:      cfg.History,
+		fallbackMode: cfg.Fallback,
+		radius:       cfg.ZombieRadius,
+		window:       cfg.ZombieTime,
+		logger:       logger,
+	}
+	if cfg.Fallback == FallbackStale && cfg.StaleSize > 0 {
+		c.verdicts = cache.New(cfg.StaleSize, cfg.StaleTTL)
+	}
+	if cfg.History != nil {
+		size := cfg.HistoryQueueSize
+		if size < 1 {
+			size = 1
+		}
+		c.records = make(chan verdictRecord, size)
+		c.recorded = make(chan struct{})
+	}
+	return c, nil
+}
+
+// detect fetches the location updates of the driver identified by id and
+// determines if the driver is a zombie. If there are no location udpates
+// available, we *do not* assume that the driver is a zombie but return
+// errNotFound. If the available updates are insufficient, the state of the
+// driver is unknown.
+func (c *checker) detect(ctx context.Context, id int64) (types.ZombieDriver, error) {
+	locs, err := c.driverLocation.locations(ctx, strconv.FormatInt(id, 10))
+	if err != nil {
+		return types.ZombieDriver{}, err
+	}
+	// no data found for the driver-ID
+	if len(locs) == 0 {
+		return types.ZombieDriver{}, errNotFound
+	}
+	now := time.Now()
+	v := c.detector.Detect(locs, now)
+	c.record(id, v, now)
+	return types.ZombieDriver{
+		ID:     id,
+		Zombie: v.Zombie,
+		Score:  v.Score,
+		State:  state(v),
+	}, nil
+}
+
+func state(v detector.Verdict) string {
+	switch {
+	case v.Unknown:
+		return types.StateUnknown
+	case v.Zombie:
+		return types.StateZombie
+	default:
+		return types.StateActive
+	}
+}
+
+// verdictRecord is a verdict waiting to be added to the history.
+type verdictRecord struct {
+	t time.Time
+	v types.ZombieVerdict
+}
+
+// record queues the verdict v of the driver identified by id to be added to
+// the history by recordVerdicts. Checks do not wait for the history: the
+// verdict is dropped if the queue is full or closed by stopRecording.
+func (c *checker) record(id int64, v detector.Verdict, now time.Time) {
+	if c.history == nil {
+		return
+	}
+	r := verdictRecord{t: now, v: types.ZombieVerdict{
+		ID:        id,
+		Zombie:    v.Zombie,
+		Score:     v.Score,
+		State:     state(v),
+		CheckedAt: now.UTC().Format(time.RFC3339Nano),
+		Radius:    c.radius,
+		Window:    c.window,
+		Threshold: c.detector.Threshold,
+		Version:   detector.Version,
+	}}
+	c.recordMu.RLock()
+	defer c.recordMu.RUnlock()
+	if c.recordsClosed {
+		historyDroppedCounter.Inc()
+		return
+	}
+	select {
+	case c.records <- r:
+	default:
+		historyDroppedCounter.Inc()
+	}
+}
+
+// recordVerdicts adds the queued verdicts to the history until the queue is
+// closed by stopRecording and drained. Failing to record a verdict does not
+// fail the check.
+func (c *checker) recordVerdicts() {
+	defer close(c.recorded)
+	for r := range c.records {
+		if err := c.history.Add(r.t, r.v); err != nil {
+			c.logger.Error().Err(err).Int64("id", r.v.ID).Msg("could not record zombie verdict")
+		}
+	}
+}
+
+// stopRecording stops queueing verdicts and waits until the queued ones are
+// added to the history by recordVerdicts or ctx is done. It must be called
+// once, after recordVerdicts was started.
+func (c *checker) stopRecording(ctx context.Context) error {
+	c.recordMu.Lock()
+	c.recordsClosed = true
+	close(c.records)
+	c.recordMu.Unlock()
+
+	select {
+	case <-c.recorded:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// result is the outcome of checking a single driver.
+type result struct {
+	zombie types.ZombieDriver
+	path   string // primary or fallback
+	err    error
+}
+
+// checkAll checks all drivers identified by ids using a pool of at most
+// workers concurrent checks. The results are in the order of ids. Checks
+// that did not start before ctx is done fail with the error of ctx.
+func (c *checker) checkAll(ctx context.Context, ids []int64, workers int) []result {
+	results := make([]result, len(ids))
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(ids); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					results[i] = result{err: err}
+					continue
+				}
+				results[i] = c.check(ctx, ids[i])
+			}
+		}()
+	}
+	for i := range ids {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
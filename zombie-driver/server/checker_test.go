@@ -0,0 +1,31 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestNewChecker(t *testing.T) {
+	for _, tt := range []struct {
+		d  string  // description of test case
+		zr float64 // zombie radius
+		e  bool    // expect error
+	}{
+		{d: "expect error for zero radius", zr: 0, e: true},
+		{d: "expect error for negative radius", zr: -1, e: true},
+		{d: "expect checker for positive radius", zr: 400},
+	} {
+		t.Run(tt.d, func(t *testing.T) {
+			cfg := &Config{
+				DriverLocationURL: "http://localhost",
+				ZombieRadius:      tt.zr,
+				ZombieTime:        5,
+			}
+			_, err := newChecker(cfg, zerolog.Nop())
+			if w, g := tt.e, err != nil; w != g {
+				t.Errorf("want error %t got %v", w, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/heetch/FabianG-technical-test/driver-location/client"
+	"github.com/heetch/FabianG-technical-test/tracing"
+	"github.com/heetch/FabianG-technical-test/types"
+	"github.com/heetch/FabianG-technical-test/zombie-driver/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	cacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "zombie_driver_location_cache",
+			Help: "counts driver location cache lookups by result; hit or miss",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(cacheCounter)
+}
+
+// errNotFound is returned if the driver-location service responds with
+// http.StatusNotFound.
+var errNotFound = errors.New("not found")
+
+// driverLocation fetches data from the driver-location service guarded by a
+// circuit-breaker. Location updates are cached per driver, if a cache is
+// configured. Concurrent lookups of the same driver share one upstream call.
+type driverLocation struct {
+	client  *client.Client
+	window  time.Duration
+	timeout time.Duration // deadline of shared calls
+	cache   *cache.LRU    // optional
+	group   singleflight.Group
+}
+
+// defaultFetchTimeout is the deadline of shared calls if none is configured.
+const defaultFetchTimeout = time.Second
+
+func newDriverLocation(cfg *Config) (*driverLocation, error) {
+	// the client certificate is presented to driver-location services
+	// requiring mutual TLS
+	var hc *http.Client
+	if cfg.ClientTLS != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = cfg.ClientTLS
+		hc = &http.Client{Transport: &tracing.Transport{Base: t}}
+	}
+	c, err := client.New(cfg.DriverLocationURL, hc)
+	if err != nil {
+		return nil, err
+	}
+	d := &driverLocation{
+		client:  c,
+		window:  time.Duration(cfg.ZombieTime) * time.Minute,
+		timeout: cfg.FetchTimeout,
+	}
+	if d.timeout <= 0 {
+		d.timeout = defaultFetchTimeout
+	}
+	if cfg.CacheSize > 0 {
+		d.cache = cache.New(cfg.CacheSize, cfg.CacheTTL)
+	}
+	return d, nil
+}
+
+// locations returns the location updates of the driver identified by id
+// within the last zombieTime minutes. Note, the result may be shared with
+// other callers so it must not be modified.
+func (d *driverLocation) locations(ctx context.Context, id string) ([]types.LocationUpdate, error) {
+	if d.cache != nil {
+		if locs, ok := d.cache.Get(id); ok {
+			cacheCounter.With(prometheus.Labels{"result": "hit"}).Inc()
+			return locs.([]types.LocationUpdate), nil
+		}
+	}
+	// the shared call must not fail with the context of the caller which
+	// started it, so it is detached from the callers but keeps their trace;
+	// each caller still stops waiting when its own context is done
+	ch := d.group.DoChan(id, func() (interface{}, error) {
+		if d.cache != nil {
+			cacheCounter.With(prometheus.Labels{"result": "miss"}).Inc()
+		}
+		fctx, cancel := context.WithTimeout(tracing.ContextWithRemoteSpanContext(context.Background(), tracing.SpanContextFromContext(ctx)), d.timeout)
+		defer cancel()
+		locs, err := d.fetch(fctx, id)
+		if err == nil && d.cache != nil {
+			d.cache.Add(id, locs)
+		}
+		return locs, err
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]types.LocationUpdate), nil
+	}
+}
+
+// fetch requests the location updates of the driver identified by id from
+// the driver-location service.
+func (d *driverLocation) fetch(ctx context.Context, id string) ([]types.LocationUpdate, error) {
+	v, err := d.do(ctx, func(ctx context.Context) (interface{}, error) {
+		return d.client.Locations(ctx, id, d.window)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]types.LocationUpdate), nil
+}
+
+// active returns the IDs of all drivers which sent location updates within
+// the last zombieTime minutes.
+func (d *driverLocation) active(ctx context.Context) ([]string, error) {
+	v, err := d.do(ctx, func(ctx context.Context) (interface{}, error) {
+		return d.client.Active(ctx, d.window)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]string), nil
+}
+
+// do runs f guarded by the circuit-breaker. Client errors of the
+// driver-location service do not count as failures of the circuit. Note, f
+// may still be running when the circuit-breaker times out, so its result is
+// passed on a channel.
+func (d *driverLocation) do(ctx context.Context, f func(context.Context) (interface{}, error)) (interface{}, error) {
+	type result struct {
+		v   interface{}
+		err error
+	}
+	out := make(chan result, 1)
+	if err := hystrix.DoC(ctx, "driver_location", func(ctx context.Context) error {
+		v, err := f(ctx)
+		out <- result{v, err}
+		if c := client.StatusCode(err); c != 0 && c < http.StatusInternalServerError {
+			return nil
+		}
+		return err
+	}, nil); err != nil {
+		return nil, err
+	}
+	res := <-out
+	if client.IsNotFound(res.err) {
+		return nil, errNotFound
+	}
+	return res.v, res.err
+}
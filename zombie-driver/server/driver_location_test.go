@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/driver-location/client"
+	"github.com/heetch/FabianG-technical-test/types"
+)
+
+var cacheTests = []struct {
+	d string // description of test case
+	n int    // concurrent lookups of the same driver
+	s int    // cache size
+	c int    // expected calls to driver-location
+}{
+	{
+		d: "expect a burst of lookups to reach driver-location once",
+		n: 50,
+		s: 10,
+		c: 1,
+	},
+	{
+		d: "expect a single lookup to reach driver-location once",
+		n: 1,
+		s: 10,
+		c: 1,
+	},
+}
+
+func TestLocationsCache(t *testing.T) {
+	for _, tt := range cacheTests {
+		t.Run(tt.d, func(t *testing.T) {
+			f := client.NewFake()
+			defer f.Close()
+			f.SetLocations("1", []types.LocationUpdate{{UpdatedAt: "2019-10-15T07:00:07Z"}})
+
+			dl, err := newDriverLocation(&Config{
+				DriverLocationURL: f.URL,
+				ZombieTime:        5,
+				CacheSize:         tt.s,
+				CacheTTL:          time.Minute,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < tt.n; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					locs, err := dl.locations(context.Background(), "1")
+					if err != nil {
+						t.Errorf("unexpected error: %v", err)
+					}
+					if w, g := 1, len(locs); w != g {
+						t.Errorf("want %d locations got %d", w, g)
+					}
+				}()
+			}
+			wg.Wait()
+			// served from cache
+			if _, err := dl.locations(context.Background(), "1"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if w, g := tt.c, f.Calls("1"); w != g {
+				t.Errorf("want %d calls got %d", w, g)
+			}
+		})
+	}
+}
+
+func TestLocationsCancel(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		fmt.Fprint(w, `[{"latitude":48.864193,"longitude":2.350498,"updated_at":"2019-10-15T07:00:07Z"}]`)
+	}))
+	defer srv.Close()
+	dl, err := newDriverLocation(&Config{DriverLocationURL: srv.URL, ZombieTime: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the first caller starts the shared call and gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := dl.locations(ctx, "1")
+		first <- err
+	}()
+	<-started
+	second := make(chan error, 1)
+	go func() {
+		locs, err := dl.locations(context.Background(), "1")
+		if err == nil && len(locs) != 1 {
+			err = fmt.Errorf("want 1 location got %d", len(locs))
+		}
+		second <- err
+	}()
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("want first caller to fail with %v got %v", context.Canceled, err)
+	}
+
+	// the shared call is not cancelled with the first caller
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("want second caller to succeed got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/heetch/FabianG-technical-test/driver-location/client"
+	"github.com/heetch/FabianG-technical-test/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fallbacks of zombie checks if the driver-location service fails
+const (
+	FallbackClosed = "closed" // fail the check
+	FallbackOpen   = "open"   // assume the driver is no zombie
+	FallbackStale  = "stale"  // serve the last verdict of the driver, else fail
+)
+
+// paths a zombie check took; either the primary path or a fallback
+const pathPrimary = "primary"
+
+// checkPathHeader is the response header which carries the path a zombie
+// check took.
+const checkPathHeader = "X-Zombie-Check-Path"
+
+var (
+	checkPathCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "zombie_driver_check_path",
+			Help: "counts zombie checks by path; primary, stale, open or closed",
+		},
+		[]string{"path"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(checkPathCounter)
+}
+
+// check determines if the driver identified by id is a zombie. If the
+// driver-location service fails, the fallback of c is applied. Unknown drivers,
+// client errors and cancelled checks do not fall back.
+func (c *checker) check(ctx context.Context, id int64) result {
+	z, err := c.detect(ctx, id)
+	if err == nil || err == errNotFound || ctx.Err() != nil || !fallsBack(err) {
+		if err == nil && c.verdicts != nil {
+			c.verdicts.Add(strconv.FormatInt(id, 10), z)
+		}
+		checkPathCounter.With(prometheus.Labels{"path": pathPrimary}).Inc()
+		return result{zombie: z, path: pathPrimary, err: err}
+	}
+
+	res := c.fallback(id, err)
+	checkPathCounter.With(prometheus.Labels{"path": res.path}).Inc()
+	if res.path != FallbackClosed {
+		c.logger.Warn().Err(err).Int64("id", id).Str("path", res.path).Msg("zombie check fell back")
+	}
+	return res
+}
+
+// fallsBack reports whether err is a failure of the driver-location service,
+// i.e. an open circuit, a timeout, a transport error or a server error, rather
+// than a client error.
+func fallsBack(err error) bool {
+	code := client.StatusCode(err)
+	return code == 0 || code >= http.StatusInternalServerError
+}
+
+func (c *checker) fallback(id int64, err error) result {
+	switch c.fallbackMode {
+	case FallbackOpen:
+		return result{
+			zombie: types.ZombieDriver{
+				ID:     id,
+				Zombie: false,
+				Score:  0,
+				State:  types.StateActive,
+			},
+			path: FallbackOpen,
+		}
+	case FallbackStale:
+		if c.verdicts == nil {
+			break
+		}
+		if v, ok := c.verdicts.Get(strconv.FormatInt(id, 10)); ok {
+			z := v.(types.ZombieDriver)
+			z.Stale = true
+			return result{zombie: z, path: FallbackStale}
+		}
+	}
+	return result{path: FallbackClosed, err: err}
+}
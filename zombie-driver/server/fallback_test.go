@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/driver-location/client"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/testdata"
+	"github.com/heetch/FabianG-technical-test/types"
+	"github.com/rs/zerolog"
+)
+
+var fallbackTests = []struct {
+	d string // description of test case
+	f string // fallback
+	w bool   // warm up with a successful check
+	c int    // status code of driver-location; defaults to 503
+	p string // expected path
+	r string // expected response data
+	s int    // expected response status code
+}{
+	{
+		d: "expect failure without fallback",
+		f: "",
+		w: true,
+		p: FallbackClosed,
+		r: `{"error":"internal_error"}`,
+		s: http.StatusInternalServerError,
+	},
+	{
+		d: "expect failure for closed fallback",
+		f: FallbackClosed,
+		w: true,
+		p: FallbackClosed,
+		r: `{"error":"internal_error"}`,
+		s: http.StatusInternalServerError,
+	},
+	{
+		d: "expect no zombie for open fallback",
+		f: FallbackOpen,
+		p: FallbackOpen,
+		r: `{"id":1,"zombie":false,"score":0,"state":"active"}`,
+		s: http.StatusOK,
+	},
+	{
+		d: "expect no fallback for client errors",
+		f: FallbackOpen,
+		c: http.StatusBadRequest,
+		p: pathPrimary,
+		r: `{"error":"internal_error"}`,
+		s: http.StatusInternalServerError,
+	},
+	{
+		d: "expect last verdict for stale fallback",
+		f: FallbackStale,
+		w: true,
+		p: FallbackStale,
+		r: `{"id":1,"zombie":true,"score":0.774,"state":"zombie","stale":true}`,
+		s: http.StatusOK,
+	},
+	{
+		d: "expect failure for stale fallback without last verdict",
+		f: FallbackStale,
+		p: FallbackClosed,
+		r: `{"error":"internal_error"}`,
+		s: http.StatusInternalServerError,
+	},
+}
+
+func TestFallback(t *testing.T) {
+	// mute logger in tests
+	logger := zerolog.New(ioutil.Discard)
+	log.SetFlags(0)
+	log.SetOutput(logger)
+
+	var locs []types.LocationUpdate
+	if err := json.Unmarshal([]byte(recent(testdata.Drives[0].Loc)), &locs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range fallbackTests {
+		t.Run(tt.d, func(t *testing.T) {
+			driverLocationSrvc := client.NewFake()
+			defer driverLocationSrvc.Close()
+			driverLocationSrvc.SetLocations("1", locs)
+
+			cfg := &Config{
+				DriverLocationURL: driverLocationSrvc.URL,
+				ZombieRadius:      400,
+				ZombieTime:        5,
+				Fallback:          tt.f,
+				StaleSize:         10,
+				StaleTTL:          time.Minute,
+			}
+			c, err := newChecker(cfg, zerolog.Nop())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			h, err := newZombieHandler(cfg, c, nil, health.New(time.Second, time.Second), nil, logger)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.w {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest("GET", "/drivers/1", nil))
+				if w, g := pathPrimary, rec.Header().Get(checkPathHeader); w != g {
+					t.Fatalf("want path %s got %s", w, g)
+				}
+			}
+
+			code := tt.c
+			if code == 0 {
+				code = http.StatusServiceUnavailable
+			}
+			driverLocationSrvc.SetError("1", code)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", "/drivers/1", nil))
+			if w, g := tt.s, rec.Code; w != g {
+				t.Errorf("want status code %d got %d", w, g)
+			}
+			if w, g := tt.p, rec.Header().Get(checkPathHeader); w != g {
+				t.Errorf("want path %s got %s", w, g)
+			}
+			if w, g := tt.r, strings.TrimSpace(rec.Body.String()); w != g {
+				t.Errorf("want response %s got %s", w, g)
+			}
+		})
+	}
+}
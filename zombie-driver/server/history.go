@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/heetch/FabianG-technical-test/handler"
+	"github.com/heetch/FabianG-technical-test/zombie-driver/history"
+)
+
+// defaultHistoryRange is the period of verdicts returned if the request does
+// not specify a start.
+const defaultHistoryRange = 24 * time.Hour
+
+// historyHandler serves the recorded zombie verdicts of a driver.
+type historyHandler struct {
+	store history.Store
+}
+
+// ServeHTTP responds with the verdicts of the driver recorded between the
+// RFC3339 times given by the `from` and `to` query params. `to` defaults to
+// now and `from` to 24 hours before `to`.
+func (h *historyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// note, type check of `id` query param is performed by router only
+	driverId, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		handler.WriteError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	to := time.Now()
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			handler.WriteError(w, r, err, http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.Add(-defaultHistoryRange)
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			handler.WriteError(w, r, err, http.StatusBadRequest)
+			return
+		}
+	}
+	if from.After(to) {
+		handler.WriteError(w, r, fmt.Errorf("from %s is after to %s", from, to), http.StatusBadRequest)
+		return
+	}
+
+	verdicts, err := h.store.Range(driverId, from, to)
+	if err != nil {
+		handler.WriteError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	handler.EncodeJSON(w, r, verdicts, http.StatusOK)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/driver-location/client"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/httpserver"
+	"github.com/heetch/FabianG-technical-test/testdata"
+	"github.com/heetch/FabianG-technical-test/types"
+	"github.com/heetch/FabianG-technical-test/zombie-driver/detector"
+	"github.com/heetch/FabianG-technical-test/zombie-driver/history"
+	"github.com/rs/zerolog"
+)
+
+var historyTests = []struct {
+	d string // description of test case
+	p string // request path
+	n int    // expected number of verdicts
+	s int    // expected response status code
+}{
+	{
+		d: "expect verdicts of the last 24 hours by default",
+		p: "/drivers/1/zombie-history",
+		n: 2,
+		s: http.StatusOK,
+	},
+	{
+		d: "expect verdicts within range",
+		p: "/drivers/1/zombie-history?from=2019-10-15T07:00:00Z&to=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		n: 2,
+		s: http.StatusOK,
+	},
+	{
+		d: "expect no verdicts before the checks",
+		p: "/drivers/1/zombie-history?from=2019-10-15T07:00:00Z&to=2019-10-15T08:00:00Z",
+		n: 0,
+		s: http.StatusOK,
+	},
+	{
+		d: "expect no verdicts of unchecked driver",
+		p: "/drivers/2/zombie-history",
+		n: 0,
+		s: http.StatusOK,
+	},
+	{
+		d: "expect StatusBadRequest for invalid time",
+		p: "/drivers/1/zombie-history?from=yesterday",
+		s: http.StatusBadRequest,
+	},
+	{
+		d: "expect StatusBadRequest for from after to",
+		p: "/drivers/1/zombie-history?from=2019-10-15T08:00:00Z&to=2019-10-15T07:00:00Z",
+		s: http.StatusBadRequest,
+	},
+}
+
+func TestHistoryHandler(t *testing.T) {
+	// mute logger in tests
+	logger := zerolog.New(ioutil.Discard)
+	log.SetFlags(0)
+	log.SetOutput(logger)
+
+	driverLocationSrvc := client.NewFake()
+	defer driverLocationSrvc.Close()
+	var locs []types.LocationUpdate
+	if err := json.Unmarshal([]byte(recent(testdata.Drives[0].Loc)), &locs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	driverLocationSrvc.SetLocations("1", locs)
+
+	cfg := &Config{
+		DriverLocationURL: driverLocationSrvc.URL,
+		ZombieRadius:      400,
+		ZombieTime:        5,
+		History:           history.NewMemory(time.Hour, 10),
+		HistoryQueueSize:  10,
+	}
+	c, err := newChecker(cfg, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h, err := newZombieHandler(cfg, c, nil, health.New(time.Second, time.Second), nil, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	go c.recordVerdicts()
+
+	// record two verdicts
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/drivers/1", nil))
+		if w, g := http.StatusOK, rec.Code; w != g {
+			t.Fatalf("want status code %d got %d", w, g)
+		}
+	}
+	// verdicts are recorded asynchronously
+	if err := c.stopRecording(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range historyTests {
+		t.Run(tt.d, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", tt.p, nil))
+			if w, g := tt.s, rec.Code; w != g {
+				t.Fatalf("want status code %d got %d", w, g)
+			}
+			if tt.s != http.StatusOK {
+				return
+			}
+			var verdicts []types.ZombieVerdict
+			if err := json.Unmarshal(rec.Body.Bytes(), &verdicts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w, g := tt.n, len(verdicts); w != g {
+				t.Fatalf("want %d verdicts got %d", w, g)
+			}
+			for _, v := range verdicts {
+				if v.ID != 1 || !v.Zombie || v.Radius != 400 || v.Window != 5 || v.Threshold != 0.5 || v.Version != detector.Version {
+					t.Errorf("unexpected verdict %+v", v)
+				}
+			}
+		})
+	}
+}
+
+// slowStore is a history.Store which takes d to add a verdict.
+type slowStore struct {
+	history.Store
+	d time.Duration
+}
+
+func (s slowStore) Add(t time.Time, v types.ZombieVerdict) error {
+	time.Sleep(s.d)
+	return s.Store.Add(t, v)
+}
+
+func TestHistoryShutdown(t *testing.T) {
+	cfg := &Config{
+		DriverLocationURL: "http://localhost",
+		ZombieRadius:      400,
+		ZombieTime:        5,
+		History:           slowStore{Store: history.NewMemory(time.Hour, 10), d: 10 * time.Millisecond},
+		HistoryQueueSize:  10,
+	}
+	s, err := New("localhost:0", httpserver.Config{}, cfg, health.New(time.Second, time.Second), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// enqueue verdicts faster than they are recorded
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		s.checker.record(1, detector.Verdict{Zombie: true, Score: 1}, now.Add(time.Duration(i)*time.Second))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.Shutdown(ctx)
+
+	vs, err := cfg.History.Range(1, now, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, g := 5, len(vs); w != g {
+		t.Errorf("want %d recorded verdicts got %d", w, g)
+	}
+
+	// verdicts of checks after shutdown are dropped
+	s.checker.record(1, detector.Verdict{}, now)
+}
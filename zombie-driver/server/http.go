@@ -2,44 +2,124 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
+	"time"
 
+	"github.com/heetch/FabianG-technical-test/geo"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/httpserver"
+	"github.com/heetch/FabianG-technical-test/zombie-driver/detector"
+	"github.com/heetch/FabianG-technical-test/zombie-driver/history"
 	"github.com/rs/zerolog"
 )
 
+// Config represents the configuration of the zombie-driver service.
+type Config struct {
+	DriverLocationURL string        // base URL of the driver-location service
+	ZombieRadius      float64       // meter
+	ZombieTime        int           // minutes
+	ScanInterval      time.Duration // zero disables the zombie scanner
+	BatchWorkers      int           // concurrent checks per batch or scan
+	BatchTimeout      time.Duration // deadline of a batch check
+	BatchMaxIDs       int           // max drivers per batch check
+	CacheSize         int           // max cached drivers; zero disables the cache
+	CacheTTL          time.Duration // max age of cached location updates
+	FetchTimeout      time.Duration // deadline of shared requests of location updates; zero defaults to 1s
+	UpdateInterval    time.Duration // expected interval of location updates
+	ScoreThreshold    float64       // score above which drivers are zombies
+	MinSamples        int           // min location updates of a verdict
+	MinCoverage       float64       // min fraction of ZombieTime spanned by location updates
+	MaxUpdateAge      time.Duration // max age of the latest location update of a verdict; zero disables
+	Filter            detector.FilterConfig
+	Geodesic          geo.DistanceFunc // nil defaults to geo.Haversine
+	History           history.Store    // nil disables the verdict history
+	HistoryQueueSize  int              // max verdicts waiting to be recorded
+	Fallback          string           // fallback if driver-location fails; empty fails checks
+	StaleSize         int              // max drivers with a stale verdict
+	StaleTTL          time.Duration    // max age of stale verdicts
+	MaxBodyBytes      int64            // max size of request bodies; zero disables the limit
+	ClientTLS         *tls.Config      // TLS of https requests to driver-location; nil uses defaults
+}
+
 type HTTPServer struct {
-	server *http.Server
-	logger zerolog.Logger
+	server  *http.Server
+	checker *checker
+	scanner *scanner
+	ctx     context.Context // cancelled on shutdown
+	cancel  context.CancelFunc
+	logger  zerolog.Logger
 }
 
-func New(addr, driverLocationURL string, zombieRadius float64, zombieTime int, logger zerolog.Logger) (*HTTPServer, error) {
-	router, err := newZombieHandler(driverLocationURL, zombieRadius, zombieTime, logger)
+// New returns an HTTPServer configured by srvCfg. The readiness of the server
+// is reported by hc, which is extended by a check of the driver-location
+// service; the check is optional if checks fall back to an open or stale verdict.
+func New(addr string, srvCfg httpserver.Config, cfg *Config, hc *health.Health, logger zerolog.Logger) (*HTTPServer, error) {
+	// the checker is shared so that the zombie scanner and the http handlers
+	// make use of the same cache
+	c, err := newChecker(cfg, logger)
 	if err != nil {
 		return nil, err
 	}
-	server := &http.Server{
-		Addr:    addr,
-		Handler: router,
+	var sc *scanner
+	if cfg.ScanInterval > 0 {
+		sc = newScanner(c, cfg, logger)
+	}
+	// with fallbacks, checks are served while driver-location is down, so it
+	// is reported without affecting readiness
+	if cfg.Fallback != "" && cfg.Fallback != FallbackClosed {
+		hc.RegisterOptional("driver-location", c.driverLocation.client.Ready)
+	} else {
+		hc.Register("driver-location", c.driverLocation.client.Ready)
+	}
+	router, err := newZombieHandler(cfg, c, sc, hc, srvCfg.AccessLogSampler, logger)
+	if err != nil {
+		return nil, err
 	}
+	server := httpserver.New(addr, router, srvCfg)
+	// the recorder runs from the start so that Shutdown can always drain it
+	if c.history != nil {
+		go c.recordVerdicts()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &HTTPServer{
-		server: server,
-		logger: logger,
+		server:  server,
+		checker: c,
+		scanner: sc,
+		ctx:     ctx,
+		cancel:  cancel,
+		logger:  logger,
 	}, nil
 }
 
-func (s *HTTPServer) Run() {
+// Run serves http requests and runs the zombie scanner until s is shut down.
+func (s *HTTPServer) Run() error {
+	if s.scanner != nil {
+		go s.scanner.run(s.ctx)
+	}
 	s.logger.Info().Msgf("http server listening on %s", s.server.Addr)
-	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
-		s.logger.Fatal().Err(err).Msg("http server exited with error")
+	if err := httpserver.ListenAndServe(s.server); err != http.ErrServerClosed {
+		return err
 	}
+	return nil
 }
 
 func (s *HTTPServer) Shutdown(ctx context.Context) {
 	s.logger.Info().Msg("shutting down http server down")
 
+	// stop scanning before we stop serving the results
+	s.cancel()
+
 	// this stops accepting new requests and waits for the running ones to
 	// finish before returning. See net/http docs for details.
 	if err := s.server.Shutdown(ctx); err != nil {
 		s.logger.Error().Err(err).Msg("http server shutdown error")
 	}
+
+	// the verdicts of the finished checks are still queued
+	if s.checker.history != nil {
+		if err := s.checker.stopRecording(ctx); err != nil {
+			s.logger.Error().Err(err).Int("pending", len(s.checker.records)).Msg("could not record queued verdicts")
+		}
+	}
 }
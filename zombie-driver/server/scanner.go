@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/handler"
+	"github.com/heetch/FabianG-technical-test/tracing"
+	"github.com/heetch/FabianG-technical-test/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+var (
+	zombieGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "zombie_drivers_total",
+			Help: "number of zombie drivers found by the latest scan",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(zombieGauge)
+}
+
+// scanner periodically evaluates all drivers which recently sent location
+// updates and keeps the set of zombies found by the latest scan.
+type scanner struct {
+	*checker
+	interval time.Duration
+	workers  int // concurrent checks
+	logger   zerolog.Logger
+
+	mu      sync.RWMutex
+	zombies types.Zombies
+}
+
+func newScanner(c *checker, cfg *Config, logger zerolog.Logger) *scanner {
+	return &scanner{
+		checker:  c,
+		interval: cfg.ScanInterval,
+		workers:  cfg.BatchWorkers,
+		logger:   logger.With().Str("component", "scanner").Logger(),
+		zombies: types.Zombies{
+			IDs: []int64{},
+		},
+	}
+}
+
+// run scans for zombies every interval until ctx is done.
+func (s *scanner) run(ctx context.Context) {
+	s.logger.Info().Msgf("scanning for zombies every %s", s.interval)
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		s.scan(ctx)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			s.logger.Info().Msg("stopping zombie scanner")
+			return
+		}
+	}
+}
+
+// scan evaluates all active drivers and replaces the current zombie set. If
+// the active drivers can not be fetched, the previous result is kept. Drivers
+// that fail to be evaluated are skipped.
+func (s *scanner) scan(ctx context.Context) {
+	ctx, span := tracing.Start(ctx, "zombie scan", tracing.KindInternal)
+	defer span.End()
+	start := time.Now()
+	active, err := s.driverLocation.active(ctx)
+	if err != nil {
+		span.SetError(err)
+		s.logger.Error().Err(err).Msg("failed to fetch active drivers")
+		return
+	}
+	ids := make([]int64, 0, len(active))
+	for _, id := range active {
+		driverID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			s.logger.Error().Err(err).Str("id", id).Msg("invalid driver id")
+			continue
+		}
+		ids = append(ids, driverID)
+	}
+
+	zombies := make([]int64, 0)
+	for i, res := range s.checkAll(ctx, ids, s.workers) {
+		// see zombieHandler; we do not consider drivers without updates
+		if res.err == errNotFound {
+			continue
+		}
+		if res.err != nil {
+			s.logger.Error().Err(res.err).Int64("id", ids[i]).Msg("failed to check driver")
+			continue
+		}
+		if res.zombie.Zombie {
+			zombies = append(zombies, ids[i])
+		}
+	}
+	sort.Slice(zombies, func(i, j int) bool { return zombies[i] < zombies[j] })
+
+	s.mu.Lock()
+	s.zombies = types.Zombies{
+		ScannedAt: start.UTC().Format(time.RFC3339),
+		IDs:       zombies,
+	}
+	s.mu.Unlock()
+	zombieGauge.Set(float64(len(zombies)))
+
+	s.logger.Debug().
+		Int("drivers", len(ids)).
+		Int("zombies", len(zombies)).
+		Dur("duration", time.Since(start)).
+		Msg("zombie scan finished")
+}
+
+// ServeHTTP responds with the zombies found by the latest scan.
+func (s *scanner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	zombies := s.zombies
+	s.mu.RUnlock()
+	handler.EncodeJSON(w, r, zombies, http.StatusOK)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heetch/FabianG-technical-test/driver-location/client"
+	"github.com/heetch/FabianG-technical-test/health"
+	"github.com/heetch/FabianG-technical-test/testdata"
+	"github.com/heetch/FabianG-technical-test/types"
+	"github.com/rs/zerolog"
+)
+
+// drivers of the driver-location fake by driver-ID
+var scanTests = map[string]struct {
+	d string // description of test case
+	l string // locations of the driver
+	s int    // status code of driver-location
+}{
+	"1": {
+		d: "zombie",
+		l: testdata.Drives[0].Loc, // 116.51m
+	},
+	"2": {
+		d: "no zombie",
+		l: testdata.Drives[2].Loc, // 466.04m
+	},
+	"3": {
+		d: "zombie",
+		l: testdata.Drives[1].Loc, // 233.02m
+	},
+	"4": {
+		d: "no location updates",
+		l: "null",
+	},
+	"5": {
+		d: "driver-location error",
+		l: "null",
+		s: http.StatusInternalServerError,
+	},
+}
+
+func TestScanner(t *testing.T) {
+	// mute logger in tests
+	logger := zerolog.New(ioutil.Discard)
+	log.SetFlags(0)
+	log.SetOutput(logger)
+
+	driverLocationSrvc := client.NewFake()
+	defer driverLocationSrvc.Close()
+	for id, tt := range scanTests {
+		var locs []types.LocationUpdate
+		if err := json.Unmarshal([]byte(recent(tt.l)), &locs); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		driverLocationSrvc.SetLocations(id, locs)
+		if tt.s != 0 {
+			driverLocationSrvc.SetError(id, tt.s)
+		}
+	}
+
+	cfg := &Config{
+		DriverLocationURL: driverLocationSrvc.URL,
+		ZombieRadius:      400,
+		ZombieTime:        5,
+	}
+	c, err := newChecker(cfg, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sc := newScanner(c, cfg, logger)
+	h, err := newZombieHandler(cfg, c, sc, health.New(time.Second, time.Second), nil, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// expect an empty set before the first scan
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/zombies", nil))
+	if w, g := `{"scanned_at":"","ids":[]}`, strings.TrimSpace(rec.Body.String()); w != g {
+		t.Errorf("want response %s got %s", w, g)
+	}
+
+	sc.scan(context.Background())
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/zombies", nil))
+	if w, g := http.StatusOK, rec.Code; w != g {
+		t.Errorf("want status code %d got %d", w, g)
+	}
+	if w, g := `"ids":[1,3]}`, strings.TrimSpace(rec.Body.String()); !strings.HasSuffix(g, w) {
+		t.Errorf("want response to end with %s got %s", w, g)
+	}
+}
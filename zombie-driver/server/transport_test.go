@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -8,21 +9,41 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/heetch/FabianG-technical-test/health"
 	"github.com/heetch/FabianG-technical-test/testdata"
+	"github.com/heetch/FabianG-technical-test/types"
 	"github.com/rs/zerolog"
 )
 
-func TestHaversine(t *testing.T) {
-	for _, tt := range testdata.Distances {
-		var dist float64
-		for i := 0; i < len(tt.L)-1; i++ {
-			dist += haversineKm(tt.L[i].Lat, tt.L[i].Long, tt.L[i+1].Lat, tt.L[i+1].Long)
-		}
-		if w, g := tt.D, dist; w != g {
-			t.Errorf("haversine distance: want %f but got %f", w, g)
+// recent returns the JSON encoded location updates loc with update times
+// shifted so that the latest update happens now. So the zombie score does not
+// suffer from outdated test data. Invalid input is returned unchanged.
+func recent(loc string) string {
+	var locs []types.LocationUpdate
+	if err := json.Unmarshal([]byte(loc), &locs); err != nil || len(locs) == 0 {
+		return loc
+	}
+	last, err := time.Parse(time.RFC3339, locs[len(locs)-1].UpdatedAt)
+	if err != nil {
+		return loc
+	}
+	// update times have a resolution of seconds; round up so that the latest
+	// update is not in the past
+	shift := time.Since(last).Truncate(time.Second) + time.Second
+	for i, l := range locs {
+		t, err := time.Parse(time.RFC3339, l.UpdatedAt)
+		if err != nil {
+			return loc
 		}
+		locs[i].UpdatedAt = t.Add(shift).UTC().Format(time.RFC3339)
 	}
+	b, err := json.Marshal(locs)
+	if err != nil {
+		return loc
+	}
+	return string(b)
 }
 
 // testdata by driver-ID and minutes
@@ -36,18 +57,20 @@ var zombieTests = map[string]map[int]struct {
 }{
 	"0": { // driver ID 0; test faulty driver-location service
 		1: { // 1 minute
-			d: "expect InternalServerError when the driver-location mock service is not reachable",
-			p: "/drivers/0",
-			r: `{"error":"internal_error"}`,
-			s: http.StatusInternalServerError,
+			d:  "expect InternalServerError when the driver-location mock service is not reachable",
+			p:  "/drivers/0",
+			r:  `{"error":"internal_error"}`,
+			zr: 400.0,
+			s:  http.StatusInternalServerError,
 		},
 	},
 	"1": { // test empty results
 		1: {
-			l: "null",
-			d: "expect null response from location-service to result in StatusNotFound",
-			p: "/drivers/1",
-			s: http.StatusNotFound,
+			l:  "null",
+			d:  "expect null response from location-service to result in StatusNotFound",
+			p:  "/drivers/1",
+			zr: 400.0,
+			s:  http.StatusNotFound,
 		},
 	},
 	"2": {
@@ -55,7 +78,7 @@ var zombieTests = map[string]map[int]struct {
 			l:  testdata.Drives[0].Loc, // 116.51m
 			d:  "expect driver 2 to be a zombie; #1",
 			p:  "/drivers/2",
-			r:  `{"id":2,"zombie":true}`,
+			r:  `{"id":2,"zombie":true,"score":0.774,"state":"zombie"}`,
 			zr: 400.0,
 			s:  http.StatusOK,
 		},
@@ -63,7 +86,7 @@ var zombieTests = map[string]map[int]struct {
 			l:  testdata.Drives[1].Loc, // 233.02m
 			d:  "expect driver 2 to be a zombie; #2",
 			p:  "/drivers/2",
-			r:  `{"id":2,"zombie":true}`,
+			r:  `{"id":2,"zombie":true,"score":0.632,"state":"zombie"}`,
 			zr: 400.0,
 			s:  http.StatusOK,
 		},
@@ -71,34 +94,37 @@ var zombieTests = map[string]map[int]struct {
 			l:  testdata.Drives[2].Loc, // 466.04m
 			d:  "expect driver 2 to not be a zombie",
 			p:  "/drivers/2",
-			r:  `{"id":2,"zombie":false}`,
+			r:  `{"id":2,"zombie":false,"score":0.462,"state":"active"}`,
 			zr: 400.0,
 			s:  http.StatusOK,
 		},
 	},
 	"3": { // test unknown ID
 		1: {
-			d: "expect StatusNotFound for unknown user",
-			p: "/drivers/404",
-			s: http.StatusNotFound,
+			d:  "expect StatusNotFound for unknown user",
+			p:  "/drivers/404",
+			zr: 400.0,
+			s:  http.StatusNotFound,
 		},
 	},
 	"4": { // test malformatted json
 		1: {
-			l: `{"foo":"bar"`,
-			d: "expect InternalServerError for unexpected end of JSON input",
-			p: "/drivers/4",
-			r: `{"error":"internal_error"}`,
-			s: http.StatusInternalServerError,
+			l:  `{"foo":"bar"`,
+			d:  "expect InternalServerError for unexpected end of JSON input",
+			p:  "/drivers/4",
+			r:  `{"error":"internal_error"}`,
+			zr: 400.0,
+			s:  http.StatusInternalServerError,
 		},
 	},
 	"5": { // test wrong type of query param id
 		1: { // Note, type check of ID query param is performed by router so we expect 404 instead of 500
-			l: testdata.Drives[2].Loc, // 466.04m
-			d: "expect StatusNotFound for non-int query param ID",
-			p: "/drivers/invalidIdType",
-			r: "404 page not found",
-			s: http.StatusNotFound,
+			l:  testdata.Drives[2].Loc, // 466.04m
+			d:  "expect StatusNotFound for non-int query param ID",
+			p:  "/drivers/invalidIdType",
+			r:  "404 page not found",
+			zr: 400.0,
+			s:  http.StatusNotFound,
 		},
 	},
 }
@@ -143,7 +169,7 @@ func TestServeHTTP(t *testing.T) {
 		if tt, ok := zombieTests[id][m]; ok {
 			w.WriteHeader(http.StatusOK)
 			w.Header().Set("Content-Type", "application/json")
-			_, err := w.Write([]byte(tt.l))
+			_, err := w.Write([]byte(recent(tt.l)))
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 				return
@@ -160,9 +186,18 @@ func TestServeHTTP(t *testing.T) {
 				tt := zombieTests[id][minutes]
 
 				// proxy handler to test
-				driverLocationURL := driverLocationSrvc.URL + "/drivers/%s/locations?minutes=%d"
+				driverLocationURL := driverLocationSrvc.URL
 				// we use the zombie radius and the minutes of the test data to configure the handler
-				h, err := newZombieHandler(driverLocationURL, tt.zr, minutes, logger)
+				cfg := &Config{
+					DriverLocationURL: driverLocationURL,
+					ZombieRadius:      tt.zr,
+					ZombieTime:        minutes,
+				}
+				c, err := newChecker(cfg, zerolog.Nop())
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				h, err := newZombieHandler(cfg, c, nil, health.New(time.Second, time.Second), nil, logger)
 				if err != nil {
 					t.Fatalf("unexpected error: %v", err)
 				}